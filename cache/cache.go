@@ -47,6 +47,12 @@ type Inter interface {
 	//SMembers  获取集合
 	SMembers(key string) (r []string, e error)
 
+	//Expire  设置过期时间 单位秒
+	Expire(key string, tm int64) error
+
+	//TTL  获取剩余的过期时间 单位秒 没有过期时间或者不存在时返回0
+	TTL(key string) (int64, error)
+
 	//Close 关闭
 	Close()
 }
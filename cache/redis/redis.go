@@ -289,3 +289,28 @@ func (pointer *Redis) LRange(key string, start, stop int64) ([]string, error) {
 	}
 	return pointer.client.LRange(key, start, stop).Result()
 }
+
+//Expire  设置过期时间 单位秒
+func (pointer *Redis) Expire(key string, tm int64) error {
+	if pointer.client == nil {
+		//进行重连
+		pointer.funcConnect()
+	}
+	return pointer.client.Expire(key, time.Second*time.Duration(tm)).Err()
+}
+
+//TTL  获取剩余的过期时间 单位秒 没有过期时间或者不存在时返回0
+func (pointer *Redis) TTL(key string) (int64, error) {
+	if pointer.client == nil {
+		//进行重连
+		pointer.funcConnect()
+	}
+	ttl, err := pointer.client.TTL(key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return int64(ttl / time.Second), nil
+}
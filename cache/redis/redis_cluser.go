@@ -290,3 +290,28 @@ func (pointer *Cluster) LRange(key string, start, stop int64) ([]string, error)
 	}
 	return pointer.clients.LRange(key, start, stop).Result()
 }
+
+//Expire  设置过期时间 单位秒
+func (pointer *Cluster) Expire(key string, tm int64) error {
+	if pointer.clients == nil {
+		//进行重连
+		pointer.funcConnect()
+	}
+	return pointer.clients.Expire(key, time.Second*time.Duration(tm)).Err()
+}
+
+//TTL  获取剩余的过期时间 单位秒 没有过期时间或者不存在时返回0
+func (pointer *Cluster) TTL(key string) (int64, error) {
+	if pointer.clients == nil {
+		//进行重连
+		pointer.funcConnect()
+	}
+	ttl, err := pointer.clients.TTL(key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return int64(ttl / time.Second), nil
+}
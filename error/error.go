@@ -7,10 +7,16 @@ const (
 	SuccessCode = 200
 	//ConnectClose 链接关闭
 	ConnectClose = 400
+	//Unauthorized 身份验证失败
+	Unauthorized = 401
+	//Forbidden 没有访问权限
+	Forbidden = 403
 	//RPCNotFind 没有找到方法
 	RPCNotFind = 404
 	//RequestTimeout 请求超时
 	RequestTimeout = 408
+	//RequestTooLarge 请求内容过大
+	RequestTooLarge = 413
 	//InternalServerError 服务错误
 	InternalServerError = 500
 	//UnknownError 未知错误
@@ -18,6 +18,7 @@ require (
 	github.com/golang/groupcache v0.0.0-20200121045136-8c9f03a8e57e // indirect
 	github.com/google/btree v1.0.1 // indirect
 	github.com/google/uuid v1.2.0 // indirect
+	github.com/gorilla/websocket v1.4.2
 	github.com/grpc-ecosystem/go-grpc-middleware v1.2.2 // indirect
 	github.com/grpc-ecosystem/grpc-gateway v1.16.0 // indirect
 	github.com/hashicorp/consul/api v1.8.1
@@ -41,6 +42,9 @@ require (
 	golang.org/x/sys v0.0.0-20210309074719-68d13333faf2
 	golang.org/x/time v0.0.0-20201208040808-7e3f01d25324
 	google.golang.org/genproto v0.0.0-20210113195801-ae06605f4595 // indirect
+	// grpc-gateway v1.16.0要求v1.33.1 实际编译使用下面replace固定的v1.26.0
+	google.golang.org/grpc v1.33.1
+	google.golang.org/protobuf v1.24.0
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 	sigs.k8s.io/yaml v1.2.0 // indirect
 	xorm.io/core v0.7.3
@@ -50,5 +54,6 @@ require (
 replace (
 	github.com/coreos/bbolt v1.3.4 => go.etcd.io/bbolt v1.3.4
 	github.com/mitchellh/cli v1.1.0 => github.com/mitchellh/cli v1.1.2
+	// etcd客户端不兼容更高版本的grpc 网关gRPC入口按v1.26.0的API实现
 	google.golang.org/grpc => google.golang.org/grpc v1.26.0
 )
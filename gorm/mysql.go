@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"time"
 
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/pkg/config"
 	"github.com/tang-go/go-dog/plugins"
 
 	"github.com/jinzhu/gorm"
@@ -12,56 +14,51 @@ import (
 
 //Mysql 数据库
 type Mysql struct {
-	read  *gorm.DB
-	write *gorm.DB
+	read        *gorm.DB
+	write       *gorm.DB
+	shadowRead  *gorm.DB
+	shadowWrite *gorm.DB
 }
 
 //NewMysql 初始化数据库
 func NewMysql(cfg plugins.Cfg) *Mysql {
 	mysql := new(Mysql)
 	//初始化读数据库
-	readurl := fmt.Sprintf(`%s:%s@tcp(%s)/%s?charset=utf8&parseTime=True&loc=Local`,
-		cfg.GetReadMysql().DbUser,
-		cfg.GetReadMysql().DbPWd,
-		cfg.GetReadMysql().DbIP,
-		cfg.GetReadMysql().DbName)
-	read, err := gorm.Open("mysql", readurl)
-	if err != nil {
-		panic("connect to mysql error:" + err.Error())
-	}
-	//设置最大空闲连接数
-	read.DB().SetMaxIdleConns(cfg.GetReadMysql().MaxIdleConns)
-	//设置数据库最大打开连接数
-	read.DB().SetMaxOpenConns(cfg.GetReadMysql().MaxOpenConns)
-	//设置链接可重用时间
-	read.DB().SetConnMaxLifetime(time.Duration(cfg.GetReadMysql().ConnMaxLifetime) * time.Second)
-	//设置日志
-	read.LogMode(cfg.GetReadMysql().OpenLog)
-	//不为表增加s
-	read.SingularTable(true)
+	mysql.read = open(cfg.GetReadMysql(), cfg.GetReadMysql().DbName)
 	//初始化写数据库
-	writeurl := fmt.Sprintf(`%s:%s@tcp(%s)/%s?charset=utf8&parseTime=True&loc=Local`,
-		cfg.GetWriteMysql().DbUser,
-		cfg.GetWriteMysql().DbPWd,
-		cfg.GetWriteMysql().DbIP,
-		cfg.GetWriteMysql().DbName)
-	write, err := gorm.Open("mysql", writeurl)
+	mysql.write = open(cfg.GetWriteMysql(), cfg.GetWriteMysql().DbName)
+	//初始化影子数据库
+	if cfg.GetReadMysql().ShadowDbName != "" {
+		mysql.shadowRead = open(cfg.GetReadMysql(), cfg.GetReadMysql().ShadowDbName)
+	}
+	if cfg.GetWriteMysql().ShadowDbName != "" {
+		mysql.shadowWrite = open(cfg.GetWriteMysql(), cfg.GetWriteMysql().ShadowDbName)
+	}
+	return mysql
+}
+
+//open 打开数据库链接
+func open(cfg *config.MysqlCfg, name string) *gorm.DB {
+	url := fmt.Sprintf(`%s:%s@tcp(%s)/%s?charset=utf8&parseTime=True&loc=Local`,
+		cfg.DbUser,
+		cfg.DbPWd,
+		cfg.DbIP,
+		name)
+	db, err := gorm.Open("mysql", url)
 	if err != nil {
 		panic("connect to mysql error:" + err.Error())
 	}
 	//设置最大空闲连接数
-	write.DB().SetMaxIdleConns(cfg.GetWriteMysql().MaxIdleConns)
+	db.DB().SetMaxIdleConns(cfg.MaxIdleConns)
 	//设置数据库最大打开连接数
-	write.DB().SetMaxOpenConns(cfg.GetWriteMysql().MaxOpenConns)
+	db.DB().SetMaxOpenConns(cfg.MaxOpenConns)
 	//设置链接可重用时间
-	write.DB().SetConnMaxLifetime(time.Duration(cfg.GetWriteMysql().ConnMaxLifetime) * time.Second)
+	db.DB().SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
 	//设置日志
-	write.LogMode(cfg.GetWriteMysql().OpenLog)
+	db.LogMode(cfg.OpenLog)
 	//不为表增加s
-	write.SingularTable(true)
-	mysql.write = write
-	mysql.read = read
-	return mysql
+	db.SingularTable(true)
+	return db
 }
 
 //GetReadEngine 获取读Mysql
@@ -73,3 +70,25 @@ func (m *Mysql) GetReadEngine() *gorm.DB {
 func (m *Mysql) GetWriteEngine() *gorm.DB {
 	return m.write
 }
+
+//GetReadEngineByContext 通过请求获取读Mysql 测试请求只使用影子数据库 没有配置影子数据库时返回错误
+func (m *Mysql) GetReadEngineByContext(ctx plugins.Context) (*gorm.DB, error) {
+	if !ctx.GetIsTest() {
+		return m.read, nil
+	}
+	if m.shadowRead == nil {
+		return nil, customerror.EnCodeError(customerror.InternalServerError, "测试请求没有配置影子数据库")
+	}
+	return m.shadowRead, nil
+}
+
+//GetWriteEngineByContext 通过请求获取写Mysql 测试请求只使用影子数据库 没有配置影子数据库时返回错误
+func (m *Mysql) GetWriteEngineByContext(ctx plugins.Context) (*gorm.DB, error) {
+	if !ctx.GetIsTest() {
+		return m.write, nil
+	}
+	if m.shadowWrite == nil {
+		return nil, customerror.EnCodeError(customerror.InternalServerError, "测试请求没有配置影子数据库")
+	}
+	return m.shadowWrite, nil
+}
@@ -20,6 +20,11 @@ type Request struct {
 	Method  string
 	Arg     []byte
 	Code    string
+	Stream  bool //流式请求 服务端持续返回响应直到End
+	Cancel  bool //取消ID对应的流式请求或者丢弃ID对应的上传文件
+	Chunk   bool //上传文件的分片 Arg为分片内容 Part为文件序号
+	Part    int  //分片所属文件的序号
+	Upload  bool //请求包含ID相同的分片上传的文件
 }
 
 //Response MsgPack响应
@@ -30,6 +35,8 @@ type Response struct {
 	Reply  []byte
 	Code   string
 	Error  *customerror.Error
+	Stream bool //流式响应 Reply为空时为心跳
+	End    bool //流式响应结束
 }
 
 type key int
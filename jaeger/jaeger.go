@@ -1,7 +1,9 @@
 package jaeger
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/opentracing/opentracing-go"
@@ -77,6 +79,8 @@ func (j *Jaeger) Request(ctx plugins.Context, servicename, method string, reques
 	if j.cfg.GetRunmode() == "trace" && j.cfg.GetJaeger() != "" {
 		span, err := j.StartSpan(ctx, servicename+"."+method)
 		if err == nil {
+			//服务传入的参数已经脱敏
+			span.LogKV("request", payload(request))
 			ctx.SetShare("Span", span)
 		}
 	}
@@ -87,11 +91,26 @@ func (j *Jaeger) Request(ctx plugins.Context, servicename, method string, reques
 func (j *Jaeger) Respone(ctx plugins.Context, servicename, method string, respone interface{}, err error) {
 	if j.cfg.GetRunmode() == "trace" && j.cfg.GetJaeger() != "" {
 		if span, ok := ctx.GetShareByKey("Span").(opentracing.Span); ok {
+			if err != nil {
+				span.SetTag("error", true)
+				span.LogKV("error", err.Error())
+			} else {
+				span.LogKV("respone", payload(respone))
+			}
 			span.Finish()
 		}
 	}
 }
 
+//payload 请求以及响应的json
+func payload(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%T", v)
+	}
+	return string(data)
+}
+
 //Close 关闭
 func (j *Jaeger) Close() error {
 	if j.closer != nil {
@@ -32,6 +32,14 @@ const (
 	RequestBytes = "request_bytes"
 	//响应byte总大小
 	ResponseBytes = "response_bytes"
+	//镜像请求数
+	MirrorCount = "mirror_count"
+	//合并请求数
+	CoalesceCount = "coalesce_count"
+	//服务间调用拒绝数
+	PolicyDenyCount = "policy_deny_count"
+	//防火墙拦截数
+	FirewallBlockCount = "firewall_block_count"
 )
 
 //默认label
@@ -40,6 +48,8 @@ const (
 	Name    = "name"
 	Success = "success"
 	Code    = "code"
+	Caller  = "caller"
+	Rule    = "rule"
 )
 
 //注册默认指标
@@ -83,6 +93,30 @@ var defaultMetricsValues = []*MetricValue{
 		Help:      "Summary. total response bytes size",
 		Labels:    []string{Name, Method},
 	},
+	{
+		ValueType: Counter,
+		Name:      MirrorCount,
+		Help:      "Counter. total mirror request count",
+		Labels:    []string{Name, Method, Success, Code},
+	},
+	{
+		ValueType: Counter,
+		Name:      CoalesceCount,
+		Help:      "Counter. total coalesced request count",
+		Labels:    []string{Name, Method},
+	},
+	{
+		ValueType: Counter,
+		Name:      PolicyDenyCount,
+		Help:      "Counter. total denied service call count",
+		Labels:    []string{Name, Method, Caller},
+	},
+	{
+		ValueType: Counter,
+		Name:      FirewallBlockCount,
+		Help:      "Counter. total firewall blocked request count",
+		Labels:    []string{Name, Method, Rule},
+	},
 }
 
 //MetricResponseBytes 响应时间指标
@@ -125,6 +159,38 @@ func MetricResponseCount(name, method, success, code string) {
 	}
 }
 
+//MetricMirrorCount 镜像请求数指标
+func MetricMirrorCount(name, method, success, code string) {
+	metric, err := GetManager().GetMetric(MirrorCount)
+	if err == nil && metric != nil {
+		metric.IncWithLabel(map[string]string{Name: name, Method: method, Success: success, Code: code})
+	}
+}
+
+//MetricCoalesceCount 合并请求数指标
+func MetricCoalesceCount(name, method string) {
+	metric, err := GetManager().GetMetric(CoalesceCount)
+	if err == nil && metric != nil {
+		metric.IncWithLabel(map[string]string{Name: name, Method: method})
+	}
+}
+
+//MetricPolicyDenyCount 服务间调用拒绝数指标
+func MetricPolicyDenyCount(name, method, caller string) {
+	metric, err := GetManager().GetMetric(PolicyDenyCount)
+	if err == nil && metric != nil {
+		metric.IncWithLabel(map[string]string{Name: name, Method: method, Caller: caller})
+	}
+}
+
+//MetricFirewallBlockCount 防火墙拦截数指标
+func MetricFirewallBlockCount(name, method, rule string) {
+	metric, err := GetManager().GetMetric(FirewallBlockCount)
+	if err == nil && metric != nil {
+		metric.IncWithLabel(map[string]string{Name: name, Method: method, Rule: rule})
+	}
+}
+
 //MetricRequestCount 请求数指标
 func MetricRequestCount(name, method string) {
 	metric, err := GetManager().GetMetric(RequestCount)
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+const (
+	//defaultRefresh JWKS默认刷新间隔 单位秒
+	defaultRefresh = 300
+	//defaultRoles 默认角色字段
+	defaultRoles = "roles"
+	//defaultPermissions 默认权限字段
+	defaultPermissions = "permissions"
+)
+
+//jwtConfig 配置文件中的jwt字段
+type jwtConfig struct {
+	//HS256 HS384 HS512使用的密钥
+	Secret string `json:"secret"`
+	//JWKS地址 RS PS ES算法的公钥 按kid轮换
+	JWKS string `json:"jwks"`
+	//JWKS刷新间隔 单位秒
+	Refresh int64 `json:"refresh"`
+	//签发者 为空时不校验
+	Issuer string `json:"issuer"`
+	//接收方 为空时不校验
+	Audience string `json:"audience"`
+	//时间误差 单位秒
+	Leeway int64 `json:"leeway"`
+	//角色字段名
+	Roles string `json:"roles"`
+	//权限字段名
+	Permissions string `json:"permissions"`
+}
+
+//Auth 身份验证插件 支持jwt以及不透明token
+type Auth struct {
+	cfg    jwtConfig
+	keys   map[string]interface{}
+	jwks   *jwks
+	opaque func(ctx plugins.Context, token string) (*plugins.Claims, error)
+	lock   sync.RWMutex
+}
+
+//NewAuth 创建身份验证插件 读取配置的jwt字段 配置变化时重新加载
+func NewAuth(cfg plugins.Cfg) *Auth {
+	a := &Auth{
+		keys: make(map[string]interface{}),
+	}
+	a.load(cfg)
+	cfg.Listen(func() {
+		a.load(cfg)
+	})
+	return a
+}
+
+//load 加载配置 环境变量优先
+func (a *Auth) load(cfg plugins.Cfg) {
+	c := struct {
+		JWT jwtConfig `json:"jwt"`
+	}{}
+	if err := cfg.Unmarshal(&c); err != nil {
+		log.Traceln("读取jwt配置失败", err.Error())
+	}
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		c.JWT.Secret = secret
+	}
+	if url := os.Getenv("JWT_JWKS"); url != "" {
+		c.JWT.JWKS = url
+	}
+	if c.JWT.Refresh <= 0 {
+		c.JWT.Refresh = defaultRefresh
+	}
+	if c.JWT.Roles == "" {
+		c.JWT.Roles = defaultRoles
+	}
+	if c.JWT.Permissions == "" {
+		c.JWT.Permissions = defaultPermissions
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.cfg = c.JWT
+	if c.JWT.JWKS == "" {
+		a.jwks = nil
+		return
+	}
+	if a.jwks == nil || a.jwks.url != c.JWT.JWKS {
+		a.jwks = newJWKS(c.JWT.JWKS)
+	}
+	a.jwks.setRefresh(time.Duration(c.JWT.Refresh) * time.Second)
+}
+
+//PublicKey 添加RS PS ES算法的公钥 支持PKIX公钥以及证书
+func (a *Auth) PublicKey(kid string, data []byte) error {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return errors.New("公钥格式错误")
+	}
+	var key interface{}
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+		key = cert.PublicKey
+	} else {
+		k, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return err
+		}
+		key = k
+	}
+	a.lock.Lock()
+	a.keys[kid] = key
+	a.lock.Unlock()
+	return nil
+}
+
+//Opaque 设置不透明token的验证函数 例如调用认证服务或者查询缓存
+func (a *Auth) Opaque(f func(ctx plugins.Context, token string) (*plugins.Claims, error)) {
+	a.opaque = f
+}
+
+//Verify 验证token并返回身份信息
+func (a *Auth) Verify(ctx plugins.Context, token string) (*plugins.Claims, error) {
+	token = strings.TrimSpace(strings.TrimPrefix(token, "Bearer "))
+	if strings.Count(token, ".") == 2 {
+		return a.verifyJWT(token)
+	}
+	if a.opaque == nil {
+		return nil, errors.New("不支持的token")
+	}
+	claims, err := a.opaque(ctx, token)
+	if err == nil && claims == nil {
+		err = errors.New("token不正确")
+	}
+	return claims, err
+}
+
+//config 获取当前配置
+func (a *Auth) config() (jwtConfig, *jwks) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.cfg, a.jwks
+}
+
+//Claims 获取Context中的身份信息
+func Claims(ctx plugins.Context) (*plugins.Claims, bool) {
+	claims := new(plugins.Claims)
+	if err := ctx.GetDataByKey(plugins.ClaimsKey, claims); err != nil {
+		return nil, false
+	}
+	return claims, true
+}
+
+//Check 校验身份信息是否满足访问权限要求 角色满足其一 权限需要全部满足 权限*表示全部权限
+func Check(claims *plugins.Claims, access *serviceinfo.Access) error {
+	if access == nil {
+		return nil
+	}
+	if claims == nil {
+		return customerror.EnCodeError(customerror.Unauthorized, "缺少身份信息")
+	}
+	if len(access.Roles) > 0 && !containsAny(claims.Roles, access.Roles) {
+		return customerror.EnCodeError(customerror.Forbidden, "没有访问角色")
+	}
+	if containsAny(claims.Permissions, []string{"*"}) {
+		return nil
+	}
+	for _, permission := range access.Permissions {
+		if !containsAny(claims.Permissions, []string{permission}) {
+			return customerror.EnCodeError(customerror.Forbidden, "缺少权限:"+permission)
+		}
+	}
+	return nil
+}
+
+//containsAny have中是否包含want中的任意一个
+func containsAny(have []string, want []string) bool {
+	for _, h := range have {
+		for _, w := range want {
+			if h == w {
+				return true
+			}
+		}
+	}
+	return false
+}
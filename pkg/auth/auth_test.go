@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+//testSecret 测试使用的HS密钥
+const testSecret = "secret"
+
+//newTestAuth 创建测试使用的身份验证插件
+func newTestAuth(cfg jwtConfig) *Auth {
+	if cfg.Roles == "" {
+		cfg.Roles = defaultRoles
+	}
+	if cfg.Permissions == "" {
+		cfg.Permissions = defaultPermissions
+	}
+	return &Auth{cfg: cfg, keys: make(map[string]interface{})}
+}
+
+//encode base64url编码的json
+func encode(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+//sign 按算法签名jwt
+func sign(t *testing.T, alg, kid string, payload map[string]interface{}, key interface{}) string {
+	head := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		head["kid"] = kid
+	}
+	signed := encode(head) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch k := key.(type) {
+	case string:
+		mac := hmac.New(sha256.New, []byte(k))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerifyJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newTestAuth(jwtConfig{Secret: testSecret, Issuer: "go-dog", Audience: "api", Leeway: 5})
+	for kid, key := range map[string]interface{}{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey} {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.PublicKey(kid, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().Unix()
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub":         "u1",
+			"iss":         "go-dog",
+			"aud":         []string{"web", "api"},
+			"exp":         now + 60,
+			"roles":       []string{"admin"},
+			"permissions": "user:read user:write",
+		}
+	}
+	with := func(key string, value interface{}) map[string]interface{} {
+		payload := valid()
+		if value == nil {
+			delete(payload, key)
+		} else {
+			payload[key] = value
+		}
+		return payload
+	}
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"hs256", sign(t, "HS256", "", valid(), testSecret), true},
+		{"bearer prefix", "Bearer " + sign(t, "HS256", "", valid(), testSecret), true},
+		{"rs256", sign(t, "RS256", "rsa", valid(), rsaKey), true},
+		{"rs256 without kid", sign(t, "RS256", "", valid(), rsaKey), true},
+		{"es256", sign(t, "ES256", "ec", valid(), ecKey), true},
+		{"leeway", sign(t, "HS256", "", with("exp", now-2), testSecret), true},
+		{"expired", sign(t, "HS256", "", with("exp", now-60), testSecret), false},
+		{"not before", sign(t, "HS256", "", with("nbf", now+60), testSecret), false},
+		{"wrong secret", sign(t, "HS256", "", valid(), "forged"), false},
+		{"wrong rsa key", sign(t, "RS256", "rsa", valid(), otherKey), false},
+		{"unknown kid", sign(t, "RS256", "other", valid(), rsaKey), false},
+		{"ec key for rsa alg", sign(t, "RS256", "ec", valid(), rsaKey), false},
+		{"issuer", sign(t, "HS256", "", with("iss", "other"), testSecret), false},
+		{"audience", sign(t, "HS256", "", with("aud", "web"), testSecret), false},
+		{"alg none", encode(map[string]string{"alg": "none"}) + "." + encode(valid()) + ".", false},
+		{"unsupported alg", sign(t, "HS1", "", valid(), testSecret), false},
+		{"tampered payload", func() string {
+			parts := strings.Split(sign(t, "HS256", "", valid(), testSecret), ".")
+			parts[1] = encode(with("roles", []string{"root"}))
+			return strings.Join(parts, ".")
+		}(), false},
+		{"bad segment", "a.b.c", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := a.Verify(nil, test.token)
+			if (err == nil) != test.ok {
+				t.Fatalf("Verify err=%v want ok=%t", err, test.ok)
+			}
+			if !test.ok {
+				return
+			}
+			if claims.Subject != "u1" || len(claims.Roles) != 1 || claims.Roles[0] != "admin" || len(claims.Permissions) != 2 {
+				t.Fatalf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyOpaque(t *testing.T) {
+	a := newTestAuth(jwtConfig{})
+	if _, err := a.Verify(nil, "opaque"); err == nil {
+		t.Fatal("opaque token accepted without verifier")
+	}
+	a.Opaque(func(ctx plugins.Context, token string) (*plugins.Claims, error) {
+		if token == "good" {
+			return &plugins.Claims{Subject: "u1"}, nil
+		}
+		return nil, nil
+	})
+	if claims, err := a.Verify(nil, "good"); err != nil || claims.Subject != "u1" {
+		t.Fatalf("Verify good = %v, %v", claims, err)
+	}
+	if _, err := a.Verify(nil, "bad"); err == nil {
+		t.Fatal("nil claims accepted")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	keys := make([]*rsa.PrivateKey, 2)
+	for i := range keys {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	var current, fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		i := atomic.LoadInt32(&current)
+		key := keys[i]
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": fmt.Sprintf("k%d", i),
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	defer server.Close()
+	a := newTestAuth(jwtConfig{JWKS: server.URL})
+	a.jwks = newJWKS(server.URL)
+	payload := map[string]interface{}{"sub": "u1", "exp": time.Now().Unix() + 60}
+	if _, err := a.Verify(nil, sign(t, "RS256", "k0", payload, keys[0])); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Verify(nil, sign(t, "RS256", "k0", payload, keys[1])); err == nil {
+		t.Fatal("forged token accepted")
+	}
+	//未知kid在最小刷新间隔内不重复请求
+	if _, err := a.Verify(nil, sign(t, "RS256", "k1", payload, keys[1])); err == nil {
+		t.Fatal("unknown kid accepted")
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("fetches = %d want 1", n)
+	}
+	//公钥轮换后未知kid触发刷新
+	atomic.StoreInt32(&current, 1)
+	a.jwks.last = time.Now().Add(-jwksMinRefresh - time.Second)
+	if _, err := a.Verify(nil, sign(t, "RS256", "k1", payload, keys[1])); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Verify(nil, sign(t, "RS256", "k0", payload, keys[0])); err == nil {
+		t.Fatal("rotated key accepted")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	claims := &plugins.Claims{Roles: []string{"user"}, Permissions: []string{"order:read", "order:write"}}
+	tests := []struct {
+		name   string
+		claims *plugins.Claims
+		access *serviceinfo.Access
+		ok     bool
+	}{
+		{"no access", nil, nil, true},
+		{"no claims", nil, &serviceinfo.Access{Roles: []string{"user"}}, false},
+		{"role", claims, &serviceinfo.Access{Roles: []string{"admin", "user"}}, true},
+		{"missing role", claims, &serviceinfo.Access{Roles: []string{"admin"}}, false},
+		{"permissions", claims, &serviceinfo.Access{Permissions: []string{"order:read", "order:write"}}, true},
+		{"missing permission", claims, &serviceinfo.Access{Permissions: []string{"order:read", "order:delete"}}, false},
+		{"all permissions", &plugins.Claims{Permissions: []string{"*"}}, &serviceinfo.Access{Permissions: []string{"order:delete"}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := Check(test.claims, test.access); (err == nil) != test.ok {
+				t.Fatalf("Check err=%v want ok=%t", err, test.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tang-go/go-dog/log"
+)
+
+const (
+	//jwksTimeout 获取JWKS超时时间
+	jwksTimeout = 5 * time.Second
+	//jwksMinRefresh 出现未知kid时两次刷新的最小间隔
+	jwksMinRefresh = 10 * time.Second
+)
+
+//jwk JWKS中的公钥
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+//jwks 远程公钥集合 定时刷新 出现未知kid时提前刷新
+type jwks struct {
+	url     string
+	refresh time.Duration
+	keys    map[string]interface{}
+	last    time.Time
+	client  *http.Client
+	//进行中的刷新 刷新完成时关闭
+	wait chan struct{}
+	lock sync.Mutex
+}
+
+func newJWKS(url string) *jwks {
+	return &jwks{
+		url:     url,
+		refresh: defaultRefresh * time.Second,
+		keys:    make(map[string]interface{}),
+		client:  &http.Client{Timeout: jwksTimeout},
+	}
+}
+
+//setRefresh 设置刷新间隔
+func (j *jwks) setRefresh(refresh time.Duration) {
+	j.lock.Lock()
+	j.refresh = refresh
+	j.lock.Unlock()
+}
+
+//key 按kid查找公钥 没有kid时使用第一个类型匹配的公钥
+//同时只有一个刷新 刷新期间已有公钥的请求使用旧的公钥 没有公钥的请求等待刷新完成
+func (j *jwks) key(kid string, match func(key interface{}) bool) interface{} {
+	j.lock.Lock()
+	since := time.Since(j.last)
+	_, ok := j.keys[kid]
+	missing := !ok && (kid != "" || len(j.keys) <= 0)
+	wait := j.wait
+	if wait == nil && (since > j.refresh || (kid != "" && !ok && since > jwksMinRefresh)) {
+		j.last = time.Now()
+		wait = make(chan struct{})
+		j.wait = wait
+		j.lock.Unlock()
+		if missing {
+			j.update(wait)
+		} else {
+			//已有公钥时在后台刷新
+			go j.update(wait)
+		}
+	} else {
+		j.lock.Unlock()
+		if wait != nil && missing {
+			<-wait
+		}
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if key, ok := j.keys[kid]; ok && match(key) {
+		return key
+	}
+	if kid == "" {
+		for _, key := range j.keys {
+			if match(key) {
+				return key
+			}
+		}
+	}
+	return nil
+}
+
+//update 在锁外获取JWKS 完成后替换公钥并通知等待的请求
+func (j *jwks) update(wait chan struct{}) {
+	keys, err := j.fetch()
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if err != nil {
+		//刷新失败时继续使用旧的公钥
+		log.Errorf("获取JWKS失败 | %s | %s ", j.url, err.Error())
+	} else {
+		j.keys = keys
+	}
+	j.wait = nil
+	close(wait)
+}
+
+//fetch 获取并解析JWKS
+func (j *jwks) fetch() (map[string]interface{}, error) {
+	resp, err := j.client.Get(j.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("状态码%d", resp.StatusCode)
+	}
+	set := struct {
+		Keys []*jwk `json:"keys"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Traceln("解析JWKS公钥失败", k.Kid, err.Error())
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	log.Tracef("JWKS刷新完成 | %s | %d ", j.url, len(keys))
+	return keys, nil
+}
+
+//publicKey 转换为公钥
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("不支持的曲线:" + k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("公钥不在曲线上")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, errors.New("不支持的公钥类型:" + k.Kty)
+}
+
+//decodeInt 解析base64url编码的大整数
+func decodeInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	//注册sha256
+	_ "crypto/sha256"
+	//注册sha384 sha512
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/tang-go/go-dog/plugins"
+)
+
+//hashes 算法后缀对应的hash
+var hashes = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+//jwtHeader jwt头部
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+//verifyJWT 验证jwt的签名以及有效期 签发者 接收方
+func (a *Auth) verifyJWT(token string) (*plugins.Claims, error) {
+	cfg, jwks := a.config()
+	parts := strings.Split(token, ".")
+	head := new(jwtHeader)
+	if err := decodeSegment(parts[0], head); err != nil {
+		return nil, errors.New("jwt头部格式错误")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("jwt签名格式错误")
+	}
+	if err := a.verifySignature(cfg, jwks, head, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+	payload := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &payload); err != nil {
+		return nil, errors.New("jwt内容格式错误")
+	}
+	now := time.Now().Unix()
+	if exp, ok := payload["exp"].(float64); ok && now > int64(exp)+cfg.Leeway {
+		return nil, errors.New("token已过期")
+	}
+	if nbf, ok := payload["nbf"].(float64); ok && now+cfg.Leeway < int64(nbf) {
+		return nil, errors.New("token未生效")
+	}
+	claims := &plugins.Claims{
+		Extra: payload,
+	}
+	claims.Subject, _ = payload["sub"].(string)
+	claims.Issuer, _ = payload["iss"].(string)
+	if exp, ok := payload["exp"].(float64); ok {
+		claims.ExpiresAt = int64(exp)
+	}
+	if cfg.Issuer != "" && claims.Issuer != cfg.Issuer {
+		return nil, errors.New("token签发者不正确")
+	}
+	if cfg.Audience != "" && !containsAny(stringList(payload["aud"]), []string{cfg.Audience}) {
+		return nil, errors.New("token接收方不正确")
+	}
+	claims.Roles = stringList(payload[cfg.Roles])
+	claims.Permissions = append(stringList(payload[cfg.Permissions]), stringList(payload["scope"])...)
+	return claims, nil
+}
+
+//verifySignature 按算法验证签名 HS使用密钥 RS PS ES使用公钥
+func (a *Auth) verifySignature(cfg jwtConfig, jwks *jwks, head *jwtHeader, signed []byte, signature []byte) error {
+	if len(head.Alg) != 5 {
+		return errors.New("不支持的jwt算法:" + head.Alg)
+	}
+	hash, ok := hashes[head.Alg[2:]]
+	if !ok {
+		return errors.New("不支持的jwt算法:" + head.Alg)
+	}
+	switch head.Alg[:2] {
+	case "HS":
+		if cfg.Secret == "" {
+			return errors.New("没有配置jwt密钥")
+		}
+		mac := hmac.New(hash.New, []byte(cfg.Secret))
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("jwt签名不正确")
+		}
+		return nil
+	case "RS", "PS":
+		key, ok := a.key(jwks, head.Kid, func(key interface{}) bool {
+			_, ok := key.(*rsa.PublicKey)
+			return ok
+		}).(*rsa.PublicKey)
+		if !ok {
+			return errors.New("没有找到jwt公钥")
+		}
+		digest := hash.New()
+		digest.Write(signed)
+		var err error
+		if head.Alg[0] == 'R' {
+			err = rsa.VerifyPKCS1v15(key, hash, digest.Sum(nil), signature)
+		} else {
+			err = rsa.VerifyPSS(key, hash, digest.Sum(nil), signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		if err != nil {
+			return errors.New("jwt签名不正确")
+		}
+		return nil
+	case "ES":
+		key, ok := a.key(jwks, head.Kid, func(key interface{}) bool {
+			_, ok := key.(*ecdsa.PublicKey)
+			return ok
+		}).(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("没有找到jwt公钥")
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("jwt签名不正确")
+		}
+		digest := hash.New()
+		digest.Write(signed)
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest.Sum(nil), r, s) {
+			return errors.New("jwt签名不正确")
+		}
+		return nil
+	}
+	return errors.New("不支持的jwt算法:" + head.Alg)
+}
+
+//key 按kid查找公钥 没有kid时使用第一个类型匹配的公钥
+func (a *Auth) key(jwks *jwks, kid string, match func(key interface{}) bool) interface{} {
+	a.lock.RLock()
+	if key, ok := a.keys[kid]; ok && match(key) {
+		a.lock.RUnlock()
+		return key
+	}
+	if kid == "" {
+		for _, key := range a.keys {
+			if match(key) {
+				a.lock.RUnlock()
+				return key
+			}
+		}
+	}
+	a.lock.RUnlock()
+	if jwks == nil {
+		return nil
+	}
+	return jwks.key(kid, match)
+}
+
+//decodeSegment 解析base64url编码的json
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+//stringList 字段转换为字符串数组 支持数组以及空格分隔的字符串
+func stringList(value interface{}) []string {
+	var list []string
+	switch v := value.(type) {
+	case string:
+		list = strings.Fields(v)
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
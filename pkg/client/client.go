@@ -14,6 +14,7 @@ import (
 	nacosDiscovery "github.com/tang-go/go-dog/pkg/discovery/nacos"
 	"github.com/tang-go/go-dog/pkg/fusing"
 	"github.com/tang-go/go-dog/pkg/limit"
+	"github.com/tang-go/go-dog/pkg/mtls"
 	"github.com/tang-go/go-dog/pkg/selector"
 	"github.com/tang-go/go-dog/plugins"
 	"github.com/tang-go/go-dog/recover"
@@ -28,6 +29,7 @@ type Client struct {
 	fusing        plugins.Fusing
 	selector      plugins.Selector
 	limit         plugins.Limit
+	rule          *RuleEngine
 	managerclient *ManagerClient
 	wait          sync.WaitGroup
 }
@@ -54,6 +56,9 @@ func NewClient(param ...interface{}) plugins.Client {
 		if codec, ok := plugin.(plugins.Codec); ok {
 			client.codec = codec
 		}
+		if rule, ok := plugin.(*RuleEngine); ok {
+			client.rule = rule
+		}
 	}
 	if client.cfg == nil {
 		//默认配置
@@ -69,11 +74,14 @@ func NewClient(param ...interface{}) plugins.Client {
 	}
 	if client.fusing == nil {
 		//使用默认的熔断插件
-		client.fusing = fusing.NewFusing(2 * time.Second)
+		client.fusing = fusing.NewFusing(time.Duration(client.cfg.GetFusingTTL()) * time.Second)
 	}
 	if client.selector == nil {
 		//使用默认的选择器
-		client.selector = selector.NewSelector()
+		s := selector.NewSelector()
+		//优先调用本可用区的服务
+		s.SetZone(client.cfg.GetZone(), client.cfg.GetZoneFailoverThreshold())
+		client.selector = s
 	}
 	if client.limit == nil {
 		//使用默认的流量限制
@@ -83,7 +91,21 @@ func NewClient(param ...interface{}) plugins.Client {
 		//使用默认的参数编码
 		client.codec = codec.NewCodec()
 	}
-	client.managerclient = NewManagerClient(client.codec)
+	if client.rule == nil {
+		//使用默认的路由规则
+		client.rule = NewRuleEngine()
+		if rule := client.cfg.GetRouteRule(); rule != nil && rule.DataID != "" && client.cfg.GetModel() == config.NacosModel {
+			if err := client.rule.ListenNacos(rule.DataID, rule.Group); err != nil {
+				log.Errorln(err.Error())
+			}
+		}
+	}
+	//配置变化时更新限流以及熔断
+	client.cfg.Listen(func() {
+		client.limit.SetLimit(client.cfg.GetMaxClientLimitRequest())
+		client.fusing.SetFusingTTL(time.Duration(client.cfg.GetFusingTTL()) * time.Second)
+	})
+	client.managerclient = NewManagerClient(client.codec, mtls.NewTLS(client.cfg))
 	time.Sleep(2 * time.Second)
 	return client
 }
@@ -113,6 +135,35 @@ func (c *Client) GetCodec() plugins.Codec {
 	return c.codec
 }
 
+//route 按测试流量隔离以及路由规则获取服务发现
+func (c *Client) route(ctx plugins.Context, server, method string) (plugins.Discovery, error) {
+	services := c.discovery.GetRPCServiceByName(server)
+	shadow := c.shadow(ctx, services)
+	if ctx.GetIsTest() && len(shadow) <= 0 {
+		return nil, customerror.EnCodeError(customerror.InternalServerError, "没有可用的影子实例")
+	}
+	filter := c.rule.Filter(ctx, server, method, shadow)
+	if len(filter) == len(services) {
+		return c.discovery, nil
+	}
+	return &ruleDiscovery{
+		Discovery: c.discovery,
+		name:      server,
+		services:  filter,
+	}, nil
+}
+
+//shadow 测试请求只路由到影子实例,正常请求不会路由到影子实例
+func (c *Client) shadow(ctx plugins.Context, services []*serviceinfo.ServiceInfo) []*serviceinfo.ServiceInfo {
+	filter := make([]*serviceinfo.ServiceInfo, 0, len(services))
+	for _, service := range services {
+		if service.Shadow == ctx.GetIsTest() {
+			filter = append(filter, service)
+		}
+	}
+	return filter
+}
+
 //Call 调用函数
 func (c *Client) Call(ctx plugins.Context, mode plugins.Mode, server string, class string, method string, args interface{}, reply interface{}) error {
 	if class != "" {
@@ -122,12 +173,17 @@ func (c *Client) Call(ctx plugins.Context, mode plugins.Mode, server string, cla
 	if c.limit.IsLimit() {
 		return customerror.EnCodeError(customerror.ClientLimitError, "超过了每秒最大流量")
 	}
+	discovery, err := c.route(ctx, server, method)
+	if err != nil {
+		log.Traceln(err.Error())
+		return err
+	}
 	c.wait.Add(1)
 	defer c.wait.Done()
 	switch mode {
 	//随机模式
 	case plugins.RandomMode:
-		service, err := c.selector.RandomMode(c.discovery, c.fusing, server, method)
+		service, err := c.selector.RandomMode(discovery, c.fusing, server, method)
 		if err != nil {
 			log.Traceln(err.Error())
 			return err
@@ -152,7 +208,7 @@ func (c *Client) Call(ctx plugins.Context, mode plugins.Mode, server string, cla
 	//遍历模式
 	case plugins.RangeMode:
 		var e error = customerror.EnCodeError(customerror.InternalServerError, "没有服务可用")
-		e = c.selector.RangeMode(c.discovery, c.fusing, server, method, func(service *serviceinfo.ServiceInfo) bool {
+		e = c.selector.RangeMode(discovery, c.fusing, server, method, func(service *serviceinfo.ServiceInfo) bool {
 			client, err := c.managerclient.GetClient(service)
 			if err != nil {
 				log.Traceln(err.Error())
@@ -174,7 +230,7 @@ func (c *Client) Call(ctx plugins.Context, mode plugins.Mode, server string, cla
 		return e
 	//hash模式
 	case plugins.HashMode:
-		service, err := c.selector.HashMode(c.discovery, c.fusing, server, method)
+		service, err := c.selector.HashMode(discovery, c.fusing, server, method)
 		if err != nil {
 			log.Traceln(err.Error())
 			return err
@@ -198,7 +254,7 @@ func (c *Client) Call(ctx plugins.Context, mode plugins.Mode, server string, cla
 		return nil
 	//默认方式
 	default:
-		service, err := c.selector.Custom(c.discovery, c.fusing, server, method)
+		service, err := c.selector.Custom(discovery, c.fusing, server, method)
 		if err != nil {
 			log.Traceln(err.Error())
 			return err
@@ -232,12 +288,17 @@ func (c *Client) SendRequest(ctx plugins.Context, mode plugins.Mode, server stri
 	if c.limit.IsLimit() {
 		return nil, customerror.EnCodeError(customerror.ClientLimitError, "超过了每秒最大流量")
 	}
+	discovery, err := c.route(ctx, server, method)
+	if err != nil {
+		log.Traceln(err.Error())
+		return nil, err
+	}
 	c.wait.Add(1)
 	defer c.wait.Done()
 	switch mode {
 	//随机模式
 	case plugins.RandomMode:
-		service, err := c.selector.RandomMode(c.discovery, c.fusing, server, method)
+		service, err := c.selector.RandomMode(discovery, c.fusing, server, method)
 		if err != nil {
 			log.Traceln(err.Error())
 			return nil, err
@@ -263,7 +324,7 @@ func (c *Client) SendRequest(ctx plugins.Context, mode plugins.Mode, server stri
 	case plugins.RangeMode:
 		var e error = customerror.EnCodeError(customerror.InternalServerError, "没有服务可用")
 		var res []byte
-		e = c.selector.RangeMode(c.discovery, c.fusing, server, method, func(service *serviceinfo.ServiceInfo) bool {
+		e = c.selector.RangeMode(discovery, c.fusing, server, method, func(service *serviceinfo.ServiceInfo) bool {
 			client, err := c.managerclient.GetClient(service)
 			if err != nil {
 				e = err
@@ -286,7 +347,7 @@ func (c *Client) SendRequest(ctx plugins.Context, mode plugins.Mode, server stri
 		return res, e
 	//hash模式
 	case plugins.HashMode:
-		service, err := c.selector.HashMode(c.discovery, c.fusing, server, method)
+		service, err := c.selector.HashMode(discovery, c.fusing, server, method)
 		if err != nil {
 			return nil, err
 		}
@@ -309,7 +370,7 @@ func (c *Client) SendRequest(ctx plugins.Context, mode plugins.Mode, server stri
 		return res, nil
 	//默认方式
 	default:
-		service, err := c.selector.Custom(c.discovery, c.fusing, server, method)
+		service, err := c.selector.Custom(discovery, c.fusing, server, method)
 		if err != nil {
 			log.Traceln(err.Error())
 			return nil, err
@@ -334,6 +395,52 @@ func (c *Client) SendRequest(ctx plugins.Context, mode plugins.Mode, server stri
 	}
 }
 
+//Stream 发起流式请求 遍历模式按随机模式处理
+func (c *Client) Stream(ctx plugins.Context, mode plugins.Mode, server string, class string, method string, code string, args []byte) (<-chan *plugins.StreamReply, error) {
+	if class != "" {
+		method = class + "." + method
+	}
+	defer recover.Recover()
+	if c.limit.IsLimit() {
+		return nil, customerror.EnCodeError(customerror.ClientLimitError, "超过了每秒最大流量")
+	}
+	var service *serviceinfo.ServiceInfo
+	discovery, err := c.route(ctx, server, method)
+	if err != nil {
+		log.Traceln(err.Error())
+		return nil, err
+	}
+	switch mode {
+	case plugins.HashMode:
+		service, err = c.selector.HashMode(discovery, c.fusing, server, method)
+	case plugins.RandomMode, plugins.RangeMode:
+		service, err = c.selector.RandomMode(discovery, c.fusing, server, method)
+	default:
+		service, err = c.selector.Custom(discovery, c.fusing, server, method)
+	}
+	if err != nil {
+		log.Traceln(err.Error())
+		return nil, err
+	}
+	client, err := c.managerclient.GetClient(service)
+	if err != nil {
+		log.Traceln(err.Error())
+		c.fusing.AddError(service.Key, err)
+		return nil, customerror.EnCodeError(customerror.InternalServerError, "建立链接失败")
+	}
+	//请求统计添加
+	c.fusing.AddMethod(service.Key, method)
+	//客户端发起请求
+	replies, err := client.Stream(ctx, server, method, code, args)
+	if err != nil {
+		//添加错误
+		log.Traceln(err.Error())
+		c.fusing.AddErrorMethod(service.Key, method, err)
+		return nil, err
+	}
+	return replies, nil
+}
+
 //Broadcast 广播
 func (c *Client) Broadcast(ctx plugins.Context, server string, class string, method string, args interface{}, reply interface{}) error {
 	if class != "" {
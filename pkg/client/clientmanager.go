@@ -1,17 +1,22 @@
 package client
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"sync"
 	"time"
 
 	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/pkg/mtls"
 	"github.com/tang-go/go-dog/pkg/rpc"
 	"github.com/tang-go/go-dog/plugins"
 	"github.com/tang-go/go-dog/serviceinfo"
 )
 
+//handshakeTimeout tls握手超时时间
+const handshakeTimeout = time.Second * 3
+
 type errService struct {
 	count int32
 	tm    int64
@@ -20,15 +25,17 @@ type errService struct {
 //ManagerClient 管理
 type ManagerClient struct {
 	codec   plugins.Codec
+	tls     *mtls.TLS
 	clients map[string]*rpc.ClientRPC
 	lock    sync.RWMutex
 }
 
 //NewManagerClient 创建manager
-func NewManagerClient(codec plugins.Codec) *ManagerClient {
+func NewManagerClient(codec plugins.Codec, tls *mtls.TLS) *ManagerClient {
 	m := new(ManagerClient)
 	m.clients = make(map[string]*rpc.ClientRPC)
 	m.codec = codec
+	m.tls = tls
 	return m
 }
 
@@ -48,6 +55,18 @@ func (m *ManagerClient) GetClient(service *serviceinfo.ServiceInfo) (*rpc.Client
 			log.Errorln(err.Error())
 			return nil, err
 		}
+		//开启tls
+		if m.tls != nil && m.tls.Enable() {
+			tlsConn := tls.Client(conn, m.tls.ClientConfig())
+			tlsConn.SetDeadline(time.Now().Add(handshakeTimeout))
+			if err := tlsConn.Handshake(); err != nil {
+				log.Errorln("tls握手失败", tcpAddr.String(), err.Error())
+				conn.Close()
+				return nil, err
+			}
+			tlsConn.SetDeadline(time.Time{})
+			conn = tlsConn
+		}
 		//创建一个新的链接
 		cli := rpc.NewClientRPC(conn, m.codec, func(net.Conn) {
 			m.DelClient(service.Key)
@@ -76,4 +95,7 @@ func (m *ManagerClient) Close() {
 		client.Close()
 	}
 	m.lock.RUnlock()
+	if m.tls != nil {
+		m.tls.Close()
+	}
 }
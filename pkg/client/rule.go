@@ -0,0 +1,228 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipt/GoJsoner"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/nacos"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+//context内置的匹配字段
+const (
+	//RuleKeyIsTest 是否测试请求
+	RuleKeyIsTest = "IsTest"
+	//RuleKeyToken 请求token
+	RuleKeyToken = "Token"
+	//RuleKeyAddress 请求ip
+	RuleKeyAddress = "Address"
+	//RuleKeyURL 请求url
+	RuleKeyURL = "URL"
+	//RuleKeySource 请求源
+	RuleKeySource = "Source"
+)
+
+//RouteRule 路由规则
+type RouteRule struct {
+	//Service 服务名称
+	Service string `json:"service"`
+	//Method 方法名称 为空匹配全部方法
+	Method string `json:"method"`
+	//Key 匹配的字段 IsTest Token Address URL Source 或者自定义data的key
+	Key string `json:"key"`
+	//Values 匹配的值 为空时不按值匹配
+	Values []string `json:"values"`
+	//Percent 命中比例 0-100 小于等于0或者大于等于100时全部命中 设置了Key时按Key的值hash保证同一个值命中结果一致
+	Percent int `json:"percent"`
+	//Version 命中后路由到的版本
+	Version string `json:"version"`
+}
+
+//RuleEngine 路由规则引擎
+type RuleEngine struct {
+	rules map[string][]*RouteRule
+	rnd   *rand.Rand
+	lock  sync.RWMutex
+}
+
+//NewRuleEngine 新建一个路由规则引擎
+func NewRuleEngine() *RuleEngine {
+	r := new(RuleEngine)
+	r.rules = make(map[string][]*RouteRule)
+	r.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	return r
+}
+
+//SetRules 设置路由规则 会覆盖之前的规则
+func (r *RuleEngine) SetRules(rules []*RouteRule) {
+	mp := make(map[string][]*RouteRule)
+	for _, rule := range rules {
+		if rule.Service == "" || rule.Version == "" {
+			log.Warnln("路由规则缺少服务名称或者版本", rule)
+			continue
+		}
+		mp[rule.Service] = append(mp[rule.Service], rule)
+	}
+	r.lock.Lock()
+	r.rules = mp
+	r.lock.Unlock()
+	log.Traceln("设置路由规则数量", len(rules))
+}
+
+//ListenNacos 从nacos加载路由规则并且监听变化
+func (r *RuleEngine) ListenNacos(dataID, group string) error {
+	content, err := nacos.GetConfig().GetConfig(dataID, group)
+	if err != nil {
+		return err
+	}
+	if err := r.parse(content); err != nil {
+		return err
+	}
+	return nacos.GetConfig().ListenConfig(dataID, group, func(namespace, group, dataId, data string) {
+		if err := r.parse(data); err != nil {
+			log.Errorln("路由规则解析失败", err.Error())
+		}
+	})
+}
+
+//parse 解析路由规则
+func (r *RuleEngine) parse(content string) error {
+	rules := make([]*RouteRule, 0)
+	if strings.TrimSpace(content) != "" {
+		result, err := GoJsoner.Discard(content)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(result), &rules); err != nil {
+			return err
+		}
+	}
+	r.SetRules(rules)
+	return nil
+}
+
+//Filter 按路由规则过滤服务
+//命中规则的请求路由到规则指定的版本,未命中的请求不会路由到规则中的版本,没有可用实例时不做过滤
+func (r *RuleEngine) Filter(ctx plugins.Context, name, method string, services []*serviceinfo.ServiceInfo) []*serviceinfo.ServiceInfo {
+	r.lock.RLock()
+	rules, ok := r.rules[name]
+	r.lock.RUnlock()
+	if !ok || len(services) <= 0 {
+		return services
+	}
+	targets := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.Method != "" && !strings.EqualFold(rule.Method, method) {
+			continue
+		}
+		targets[rule.Version] = true
+		if !r.match(ctx, rule) {
+			continue
+		}
+		var hit []*serviceinfo.ServiceInfo
+		for _, service := range services {
+			if service.Version == rule.Version {
+				hit = append(hit, service)
+			}
+		}
+		if len(hit) > 0 {
+			return hit
+		}
+		log.Traceln("路由规则没有可用的版本实例", name, rule.Version)
+		return services
+	}
+	if len(targets) <= 0 {
+		return services
+	}
+	var other []*serviceinfo.ServiceInfo
+	for _, service := range services {
+		if !targets[service.Version] {
+			other = append(other, service)
+		}
+	}
+	if len(other) > 0 {
+		return other
+	}
+	return services
+}
+
+//match 请求是否命中规则
+func (r *RuleEngine) match(ctx plugins.Context, rule *RouteRule) bool {
+	value, ok := "", false
+	if rule.Key != "" {
+		value, ok = r.value(ctx, rule.Key)
+	}
+	if len(rule.Values) > 0 {
+		if !ok {
+			return false
+		}
+		in := false
+		for _, v := range rule.Values {
+			if v == value {
+				in = true
+				break
+			}
+		}
+		if !in {
+			return false
+		}
+	}
+	if rule.Percent <= 0 || rule.Percent >= 100 {
+		return true
+	}
+	if ok {
+		return int(crc32.ChecksumIEEE([]byte(value))%100) < rule.Percent
+	}
+	r.lock.Lock()
+	n := r.rnd.Intn(100)
+	r.lock.Unlock()
+	return n < rule.Percent
+}
+
+//value 获取context中的字段值
+func (r *RuleEngine) value(ctx plugins.Context, key string) (string, bool) {
+	switch key {
+	case RuleKeyIsTest:
+		return strconv.FormatBool(ctx.GetIsTest()), true
+	case RuleKeyToken:
+		return ctx.GetToken(), ctx.GetToken() != ""
+	case RuleKeyAddress:
+		return ctx.GetAddress(), ctx.GetAddress() != ""
+	case RuleKeyURL:
+		return ctx.GetURL(), ctx.GetURL() != ""
+	case RuleKeySource:
+		return ctx.GetSource(), ctx.GetSource() != ""
+	}
+	var v interface{}
+	if err := ctx.GetDataByKey(key, &v); err != nil {
+		return "", false
+	}
+	if b, ok := v.([]byte); ok {
+		return string(b), true
+	}
+	return fmt.Sprint(v), true
+}
+
+//ruleDiscovery 按规则过滤后的服务发现
+type ruleDiscovery struct {
+	plugins.Discovery
+	name     string
+	services []*serviceinfo.ServiceInfo
+}
+
+//GetRPCServiceByName 通过名称获取RPC服务
+func (d *ruleDiscovery) GetRPCServiceByName(name string) []*serviceinfo.ServiceInfo {
+	if name == d.name {
+		return d.services
+	}
+	return d.Discovery.GetRPCServiceByName(name)
+}
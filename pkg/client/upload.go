@@ -0,0 +1,110 @@
+package client
+
+import (
+	"sync"
+
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/lib/uuid"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/pkg/rpc"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/recover"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+//upload 分片上传 分片与请求使用同一个链接发送到同一个服务实例
+type upload struct {
+	c       *Client
+	ctx     plugins.Context
+	client  *rpc.ClientRPC
+	service *serviceinfo.ServiceInfo
+	id      string
+	server  string
+	method  string
+	sent    bool
+	lock    sync.Mutex
+}
+
+//Upload 分片上传文件 遍历模式按随机模式处理
+func (c *Client) Upload(ctx plugins.Context, mode plugins.Mode, server string, class string, method string) (plugins.Upload, error) {
+	if class != "" {
+		method = class + "." + method
+	}
+	defer recover.Recover()
+	if c.limit.IsLimit() {
+		return nil, customerror.EnCodeError(customerror.ClientLimitError, "超过了每秒最大流量")
+	}
+	var service *serviceinfo.ServiceInfo
+	discovery, err := c.route(ctx, server, method)
+	if err != nil {
+		log.Traceln(err.Error())
+		return nil, err
+	}
+	switch mode {
+	case plugins.HashMode:
+		service, err = c.selector.HashMode(discovery, c.fusing, server, method)
+	case plugins.RandomMode, plugins.RangeMode:
+		service, err = c.selector.RandomMode(discovery, c.fusing, server, method)
+	default:
+		service, err = c.selector.Custom(discovery, c.fusing, server, method)
+	}
+	if err != nil {
+		log.Traceln(err.Error())
+		return nil, err
+	}
+	client, err := c.managerclient.GetClient(service)
+	if err != nil {
+		log.Traceln(err.Error())
+		c.fusing.AddError(service.Key, err)
+		return nil, customerror.EnCodeError(customerror.InternalServerError, "建立链接失败")
+	}
+	return &upload{
+		c:       c,
+		ctx:     ctx,
+		client:  client,
+		service: service,
+		id:      uuid.GetToken(),
+		server:  server,
+		method:  method,
+	}, nil
+}
+
+//Write 发送文件分片
+func (u *upload) Write(part int, data []byte) error {
+	if err := u.client.Chunk(u.ctx, u.id, u.server, u.method, part, data); err != nil {
+		log.Traceln(err.Error())
+		u.c.fusing.AddError(u.service.Key, err)
+		return err
+	}
+	return nil
+}
+
+//Send 发送请求
+func (u *upload) Send(code string, args []byte) ([]byte, error) {
+	u.lock.Lock()
+	u.sent = true
+	u.lock.Unlock()
+	u.c.wait.Add(1)
+	defer u.c.wait.Done()
+	//请求统计添加
+	u.c.fusing.AddMethod(u.service.Key, u.method)
+	reply, err := u.client.SendUpload(u.ctx, u.id, u.server, u.method, code, args)
+	if err != nil {
+		//添加错误
+		log.Traceln(err.Error())
+		u.c.fusing.AddErrorMethod(u.service.Key, u.method, err)
+		return nil, err
+	}
+	return reply, nil
+}
+
+//Cancel 取消上传
+func (u *upload) Cancel() {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.sent {
+		return
+	}
+	u.sent = true
+	u.client.CancelUpload(u.id, u.server, u.method)
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/sipt/GoJsoner"
 	"github.com/tang-go/go-dog/lib/net"
@@ -19,11 +20,22 @@ const (
 	localModel = "local"
 	nacosModel = "nacos"
 )
+
+//NacosModel nacos配置模式
+const NacosModel = nacosModel
+
 const (
 	ConsulDiscoveryModel = "consul"
 	NacosDiscoveryModel  = "nacos"
 )
 
+const (
+	//MemCache 网关响应缓存使用内存
+	MemCache = "mem"
+	//RedisCache 网关响应缓存使用redis
+	RedisCache = "redis"
+)
+
 var (
 	configpath     string
 	modle          string
@@ -33,6 +45,14 @@ var (
 const (
 	_MaxClientRequestCount  int = 100000
 	_MaxServiceRequestCount int = 10000
+	//默认熔断统计时间 单位秒
+	_FusingTTL int = 2
+	//默认上传文件大小限制 32M
+	_MaxUploadSize int64 = 32 << 20
+	//默认单个上传文件大小限制 8M
+	_MaxFileSize int64 = 8 << 20
+	//默认可用区故障转移阈值
+	_ZoneFailoverThreshold float64 = 0.5
 )
 
 //NacosConfig 配置
@@ -68,6 +88,16 @@ type Config struct {
 	ClusterName string `json:"cluster_name"`
 	//GroupName 分组名称
 	GroupName string `json:"group_name"`
+	//Zone 可用区 为空时使用分组名称
+	Zone string `json:"zone"`
+	//ZoneFailoverThreshold 本可用区健康实例占比低于此值时转移到其他可用区 0表示不转移 不配置时使用默认值
+	ZoneFailoverThreshold *float64 `json:"zone_failover_threshold"`
+	//Version 服务版本标签 用于灰度发布
+	Version string `json:"version"`
+	//RouteRule 路由规则配置
+	RouteRule *RouteRuleCfg `json:"route_rule"`
+	//Shadow 影子实例 只接收测试流量
+	Shadow bool `json:"shadow"`
 	//RPC使用的端口
 	RPCPort int `json:"rpc_port"`
 	//HTTP使用的端口
@@ -102,10 +132,27 @@ type Config struct {
 	MaxServiceLimitRequest int `json:"max_service_limit_request"`
 	//客户端最大的请求数量
 	MaxClientLimitRequest int `json:"max_client_limit_request"`
+	//熔断统计时间 单位秒
+	FusingTTL int `json:"fusing_ttl"`
+	//网关请求内容大小限制 单位字节
+	MaxUploadSize int64 `json:"max_upload_size"`
+	//网关单个上传文件大小限制 单位字节 文件整体读入内存后转发
+	MaxFileSize int64 `json:"max_file_size"`
+	//网关错误码对应的http状态码
+	StatusMapping map[int]int `json:"status_mapping"`
+	//网关响应缓存存储 mem redis
+	GatewayCache string `json:"gateway_cache"`
 	//模式
 	Model string `json:"-"`
 	//服务发型模式
 	DiscoveryModel string `json:"-"`
+	//去除注释后的配置内容
+	raw string
+	//nacos配置
+	nacos *NacosConfig
+	//配置变化监听
+	listeners []func()
+	lock      sync.RWMutex
 }
 
 //MysqlCfg mysql配置
@@ -126,6 +173,16 @@ type MysqlCfg struct {
 	ConnMaxLifetime int `json:"conn_max_lifetime"`
 	//日志开关
 	OpenLog bool `json:"open_log"`
+	//影子数据库名称 测试流量使用
+	ShadowDbName string `json:"shadow_db_name"`
+}
+
+//RouteRuleCfg 路由规则配置
+type RouteRuleCfg struct {
+	//规则所在nacos配置的DataID
+	DataID string `json:"data_id"`
+	//规则所在nacos配置的组
+	Group string `json:"group"`
 }
 
 //GetClusterName 获取集群名称
@@ -138,6 +195,34 @@ func (c *Config) GetGroupName() string {
 	return c.GroupName
 }
 
+//GetZone 获取可用区
+func (c *Config) GetZone() string {
+	return c.Zone
+}
+
+//GetZoneFailoverThreshold 获取可用区故障转移阈值
+func (c *Config) GetZoneFailoverThreshold() float64 {
+	if c.ZoneFailoverThreshold == nil {
+		return _ZoneFailoverThreshold
+	}
+	return *c.ZoneFailoverThreshold
+}
+
+//GetVersion 获取服务版本标签
+func (c *Config) GetVersion() string {
+	return c.Version
+}
+
+//GetRouteRule 获取路由规则配置
+func (c *Config) GetRouteRule() *RouteRuleCfg {
+	return c.RouteRule
+}
+
+//GetShadow 是否影子实例
+func (c *Config) GetShadow() bool {
+	return c.Shadow
+}
+
 //GetServerName 获取服务名称
 func (c *Config) GetServerName() string {
 	return c.ServerName
@@ -210,6 +295,8 @@ func (c *Config) GetHost() string {
 
 //GetRunmode 获取runmode地址配置
 func (c *Config) GetRunmode() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 	return c.Runmode
 }
 
@@ -230,14 +317,57 @@ func (c *Config) GetDiscoveryModel() string {
 
 //GetMaxServiceLimitRequest 获取服务器最大的限流数
 func (c *Config) GetMaxServiceLimitRequest() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 	return c.MaxServiceLimitRequest
 }
 
 //GetMaxClientLimitRequest 获取客户端最大的限流数
 func (c *Config) GetMaxClientLimitRequest() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 	return c.MaxClientLimitRequest
 }
 
+//GetFusingTTL 获取熔断统计时间 单位秒
+func (c *Config) GetFusingTTL() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.FusingTTL
+}
+
+//GetMaxUploadSize 获取网关请求内容大小限制 单位字节
+func (c *Config) GetMaxUploadSize() int64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.MaxUploadSize
+}
+
+//GetMaxFileSize 获取网关单个上传文件大小限制 单位字节
+func (c *Config) GetMaxFileSize() int64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.MaxFileSize
+}
+
+//GetGatewayCache 获取网关响应缓存存储
+func (c *Config) GetGatewayCache() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.GatewayCache
+}
+
+//GetStatusMapping 获取网关错误码对应的http状态码
+func (c *Config) GetStatusMapping() map[int]int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	mapping := make(map[int]int, len(c.StatusMapping))
+	for code, status := range c.StatusMapping {
+		mapping[code] = status
+	}
+	return mapping
+}
+
 //NewConfig 初始化Config
 func NewConfig() *Config {
 	//从文件读取json文件并且解析
@@ -248,6 +378,7 @@ func NewConfig() *Config {
 	c.initCfgModel()
 	c.initEnv()
 	c.initLog()
+	c.watch()
 	fmt.Println("************************************************")
 	fmt.Println("*                                              *")
 	fmt.Println("*             	   Cfg  Init                    *")
@@ -257,6 +388,9 @@ func NewConfig() *Config {
 	fmt.Println("### ServerName:   ", c.ServerName)
 	fmt.Println("### ClusterName:  ", c.ClusterName)
 	fmt.Println("### GroupName:    ", c.GroupName)
+	fmt.Println("### Zone:         ", c.Zone)
+	fmt.Println("### Version:      ", c.Version)
+	fmt.Println("### Shadow:       ", c.Shadow)
 	fmt.Println("### Explain:      ", c.Explain)
 	fmt.Println("### RPCPort:      ", c.RPCPort)
 	fmt.Println("### HTTPPort:     ", c.HTTPPort)
@@ -273,6 +407,10 @@ func NewConfig() *Config {
 	fmt.Println("### Host:         ", c.Host)
 	fmt.Println("### ServiceLimit: ", c.MaxServiceLimitRequest)
 	fmt.Println("### ClientLimit:  ", c.MaxClientLimitRequest)
+	fmt.Println("### FusingTTL:    ", c.FusingTTL)
+	fmt.Println("### UploadSize:   ", c.MaxUploadSize)
+	fmt.Println("### FileSize:     ", c.MaxFileSize)
+	fmt.Println("### GatewayCache: ", c.GatewayCache)
 	fmt.Println("### RunMode:      ", c.Runmode)
 	log.Traceln("日志初始化完成")
 	return c
@@ -368,6 +506,8 @@ func (c *Config) initCfgModel() {
 		if err != nil {
 			panic(err.Error())
 		}
+		c.raw = gameConfigResult
+		c.nacos = nacosConfig
 	default:
 		//默认本地模式
 		gameConfigData, err := ioutil.ReadFile(configpath)
@@ -382,20 +522,59 @@ func (c *Config) initCfgModel() {
 		if err != nil {
 			panic(err.Error())
 		}
+		c.raw = gameConfigResult
 		s := os.Getenv("config")
 		if s != "" {
-			gameConfigResult, err := GoJsoner.Discard(s)
+			envConfigResult, err := GoJsoner.Discard(s)
 			if err != nil {
 				panic(err.Error())
 			}
-			err = json.Unmarshal([]byte(gameConfigResult), c)
+			err = json.Unmarshal([]byte(envConfigResult), c)
 			if err != nil {
 				panic(err.Error())
 			}
+			//环境变量的配置合并到原始配置 Unmarshal读取的自定义配置同样生效
+			raw, err := mergeJSON(gameConfigResult, envConfigResult)
+			if err != nil {
+				panic(err.Error())
+			}
+			c.raw = raw
 		}
 	}
 }
 
+//mergeJSON 将patch中的字段合并到base 对象逐层合并 其他类型直接覆盖
+func mergeJSON(base, patch string) (string, error) {
+	var b, p interface{}
+	if err := json.Unmarshal([]byte(base), &b); err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal([]byte(patch), &p); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(merge(b, p))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+//merge 合并json对象
+func merge(base, patch interface{}) interface{} {
+	b, ok := base.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	for key, value := range p {
+		b[key] = merge(b[key], value)
+	}
+	return b
+}
+
 func (c *Config) initEnv() {
 	host := os.Getenv("HOST")
 	if host != "" {
@@ -433,6 +612,49 @@ func (c *Config) initEnv() {
 	if c.MaxClientLimitRequest <= 0 {
 		c.MaxClientLimitRequest = _MaxClientRequestCount
 	}
+	//熔断统计时间
+	fusingTTL := os.Getenv("FUSING_TTL")
+	if fusingTTL != "" {
+		p, err := strconv.Atoi(fusingTTL)
+		if err != nil {
+			panic(err.Error())
+		}
+		c.FusingTTL = p
+	}
+	if c.FusingTTL <= 0 {
+		c.FusingTTL = _FusingTTL
+	}
+	//请求内容大小限制
+	maxUploadSize := os.Getenv("MAX_UPLOAD_SIZE")
+	if maxUploadSize != "" {
+		p, err := strconv.ParseInt(maxUploadSize, 10, 64)
+		if err != nil {
+			panic(err.Error())
+		}
+		c.MaxUploadSize = p
+	}
+	if c.MaxUploadSize <= 0 {
+		c.MaxUploadSize = _MaxUploadSize
+	}
+	//单个上传文件大小限制
+	maxFileSize := os.Getenv("MAX_FILE_SIZE")
+	if maxFileSize != "" {
+		p, err := strconv.ParseInt(maxFileSize, 10, 64)
+		if err != nil {
+			panic(err.Error())
+		}
+		c.MaxFileSize = p
+	}
+	if c.MaxFileSize <= 0 {
+		c.MaxFileSize = _MaxFileSize
+	}
+	//网关响应缓存存储
+	if gatewayCache := os.Getenv("GATEWAY_CACHE"); gatewayCache != "" {
+		c.GatewayCache = gatewayCache
+	}
+	if c.GatewayCache == "" {
+		c.GatewayCache = MemCache
+	}
 	//先看环境变量是否有端口号
 	rpcport := os.Getenv("RPC_PORT")
 	if rpcport != "" {
@@ -555,6 +777,10 @@ func (c *Config) initEnv() {
 			}
 			c.ReadMysql.OpenLog = openLog
 		}
+		readMysqlShadowName := os.Getenv("READ_MYSQL_SHADOW_NAME")
+		if readMysqlShadowName != "" {
+			c.ReadMysql.ShadowDbName = readMysqlShadowName
+		}
 	}
 	//写数据库
 	{
@@ -598,6 +824,10 @@ func (c *Config) initEnv() {
 			}
 			c.WriteMysql.OpenLog = openLog
 		}
+		writeMysqlShadowName := os.Getenv("WRITE_MYSQL_SHADOW_NAME")
+		if writeMysqlShadowName != "" {
+			c.WriteMysql.ShadowDbName = writeMysqlShadowName
+		}
 	}
 
 	//设置集群名称
@@ -612,6 +842,43 @@ func (c *Config) initEnv() {
 		c.GroupName = groupName
 	}
 
+	//设置可用区
+	zone := os.Getenv("ZONE")
+	if zone != "" {
+		c.Zone = zone
+	}
+	if c.Zone == "" {
+		c.Zone = c.GroupName
+	}
+	//可用区故障转移阈值
+	zoneFailoverThreshold := os.Getenv("ZONE_FAILOVER_THRESHOLD")
+	if zoneFailoverThreshold != "" {
+		p, err := strconv.ParseFloat(zoneFailoverThreshold, 64)
+		if err != nil {
+			panic(err.Error())
+		}
+		c.ZoneFailoverThreshold = &p
+	}
+	if c.ZoneFailoverThreshold != nil && (*c.ZoneFailoverThreshold < 0 || *c.ZoneFailoverThreshold > 1) {
+		c.ZoneFailoverThreshold = nil
+	}
+
+	//设置版本标签
+	version := os.Getenv("VERSION")
+	if version != "" {
+		c.Version = version
+	}
+
+	//设置影子实例
+	shadow := os.Getenv("SHADOW")
+	if shadow != "" {
+		p, err := strconv.ParseBool(shadow)
+		if err != nil {
+			panic(err.Error())
+		}
+		c.Shadow = p
+	}
+
 	//设置运行模式
 	runmode := os.Getenv("RUNMODE")
 	if runmode != "" {
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/sipt/GoJsoner"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/nacos"
+	"github.com/tang-go/go-dog/recover"
+)
+
+//Listen 监听配置变化
+func (c *Config) Listen(f func()) {
+	c.lock.Lock()
+	c.listeners = append(c.listeners, f)
+	c.lock.Unlock()
+}
+
+//Unmarshal 将配置内容解析到自定义结构
+func (c *Config) Unmarshal(v interface{}) error {
+	c.lock.RLock()
+	raw := c.raw
+	c.lock.RUnlock()
+	return json.Unmarshal([]byte(raw), v)
+}
+
+//watch 监听nacos配置
+func (c *Config) watch() {
+	if c.nacos == nil {
+		return
+	}
+	err := nacos.GetConfig().ListenConfig(c.nacos.DataID, c.nacos.Group, func(namespace, group, dataId, data string) {
+		defer recover.Recover()
+		if err := c.reload(data); err != nil {
+			log.Errorln("配置更新失败", err.Error())
+		}
+	})
+	if err != nil {
+		log.Errorln(err.Error())
+	}
+}
+
+//reload 重新加载配置 只更新可以热更新的配置,环境变量设置的配置不会被覆盖
+func (c *Config) reload(data string) error {
+	result, err := GoJsoner.Discard(data)
+	if err != nil {
+		return err
+	}
+	n := new(Config)
+	if err := json.Unmarshal([]byte(result), n); err != nil {
+		return err
+	}
+	c.lock.Lock()
+	c.raw = result
+	if os.Getenv("RUNMODE") == "" {
+		c.Runmode = n.Runmode
+	}
+	if os.Getenv("MAX_SERVICE_LIMIT_REQUEST") == "" {
+		c.MaxServiceLimitRequest = n.MaxServiceLimitRequest
+		if c.MaxServiceLimitRequest <= 0 {
+			c.MaxServiceLimitRequest = _MaxServiceRequestCount
+		}
+	}
+	if os.Getenv("MAX_CLIENT_LIMIT_REQUEST") == "" {
+		c.MaxClientLimitRequest = n.MaxClientLimitRequest
+		if c.MaxClientLimitRequest <= 0 {
+			c.MaxClientLimitRequest = _MaxClientRequestCount
+		}
+	}
+	if os.Getenv("FUSING_TTL") == "" {
+		c.FusingTTL = n.FusingTTL
+		if c.FusingTTL <= 0 {
+			c.FusingTTL = _FusingTTL
+		}
+	}
+	if os.Getenv("MAX_UPLOAD_SIZE") == "" {
+		c.MaxUploadSize = n.MaxUploadSize
+		if c.MaxUploadSize <= 0 {
+			c.MaxUploadSize = _MaxUploadSize
+		}
+	}
+	if os.Getenv("MAX_FILE_SIZE") == "" {
+		c.MaxFileSize = n.MaxFileSize
+		if c.MaxFileSize <= 0 {
+			c.MaxFileSize = _MaxFileSize
+		}
+	}
+	c.StatusMapping = n.StatusMapping
+	listeners := make([]func(), len(c.listeners))
+	copy(listeners, c.listeners)
+	c.lock.Unlock()
+	c.initLog()
+	log.Traceln("配置更新完成")
+	for _, f := range listeners {
+		f()
+	}
+	return nil
+}
@@ -20,6 +20,7 @@ type MyContext struct {
 	address string
 	source  string
 	token   string
+	peer    string
 	url     string
 	cancel  base.CancelFunc
 	client  plugins.Client
@@ -95,6 +96,16 @@ func (c *MyContext) GetSource() string {
 	return c.source
 }
 
+//SetPeer 设置对端服务的证书身份
+func (c *MyContext) SetPeer(peer string) {
+	c.peer = peer
+}
+
+//GetPeer 获取对端服务的证书身份
+func (c *MyContext) GetPeer() string {
+	return c.peer
+}
+
 //SetURL 设置请求url
 func (c *MyContext) SetURL(url string) {
 	c.url = url
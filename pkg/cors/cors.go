@@ -0,0 +1,187 @@
+package cors
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/plugins"
+)
+
+//defaultHeaders 默认允许的请求头
+var defaultHeaders = []string{"Content-Type", "TraceID", "IsTest", "Token", "TimeOut",
+	plugins.APIKeyHeader, plugins.TimestampHeader, plugins.NonceHeader, plugins.SignatureHeader}
+
+//defaultExpose 默认暴露的响应头
+var defaultExpose = []string{"Content-Length", "Content-Type", "ETag", "X-Cache", "Grpc-Status", "Grpc-Message"}
+
+//corsConfig 配置文件中的cors字段
+type corsConfig struct {
+	//允许的来源 支持*通配符 例如https://*.example.com 为空时允许所有来源
+	AllowOrigins []string `json:"allow_origins"`
+	//允许的请求方法 为空时使用默认方法
+	AllowMethods []string `json:"allow_methods"`
+	//允许的请求头 *表示允许预检请求中的所有请求头
+	AllowHeaders []string `json:"allow_headers"`
+	//暴露给浏览器的响应头
+	ExposeHeaders []string `json:"expose_headers"`
+	//预检请求缓存时间 单位秒
+	MaxAge int64 `json:"max_age"`
+	//是否允许携带cookie 需要配置具体的来源
+	AllowCredentials bool `json:"allow_credentials"`
+}
+
+//CORS 跨域策略 配置变化时重新加载
+type CORS struct {
+	cfg     corsConfig
+	methods []string
+	lock    sync.RWMutex
+}
+
+//NewCORS 创建跨域策略 读取配置的cors字段 methods为没有配置时允许的请求方法
+func NewCORS(cfg plugins.Cfg, methods ...string) *CORS {
+	c := &CORS{
+		methods: methods,
+	}
+	c.load(cfg)
+	cfg.Listen(func() {
+		c.load(cfg)
+	})
+	return c
+}
+
+//load 加载配置
+func (c *CORS) load(cfg plugins.Cfg) {
+	conf := struct {
+		CORS corsConfig `json:"cors"`
+	}{}
+	if err := cfg.Unmarshal(&conf); err != nil {
+		log.Traceln("读取cors配置失败", err.Error())
+	}
+	if len(conf.CORS.AllowOrigins) <= 0 {
+		conf.CORS.AllowOrigins = []string{"*"}
+	}
+	if len(conf.CORS.AllowMethods) <= 0 {
+		conf.CORS.AllowMethods = c.methods
+	}
+	if len(conf.CORS.AllowHeaders) <= 0 {
+		conf.CORS.AllowHeaders = defaultHeaders
+	}
+	if len(conf.CORS.ExposeHeaders) <= 0 {
+		conf.CORS.ExposeHeaders = defaultExpose
+	}
+	if conf.CORS.AllowCredentials && contains(conf.CORS.AllowOrigins, "*") {
+		//浏览器不接受*来源携带cookie
+		log.Warnln("cors允许所有来源时不能携带cookie")
+		conf.CORS.AllowCredentials = false
+	}
+	c.lock.Lock()
+	c.cfg = conf.CORS
+	c.lock.Unlock()
+}
+
+//config 获取当前配置
+func (c *CORS) config() corsConfig {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.cfg
+}
+
+//Handler 跨域中间件 来源不允许时不返回跨域响应头 OPTIONS预检请求直接返回
+func (c *CORS) Handler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cfg := c.config()
+		origin := ctx.Request.Header.Get("Origin")
+		preflight := ctx.Request.Method == http.MethodOptions
+		if origin != "" && allowOrigin(cfg.AllowOrigins, origin) {
+			if contains(cfg.AllowOrigins, "*") {
+				ctx.Header("Access-Control-Allow-Origin", "*")
+			} else {
+				ctx.Header("Access-Control-Allow-Origin", origin)
+				ctx.Writer.Header().Add("Vary", "Origin")
+			}
+			if cfg.AllowCredentials {
+				ctx.Header("Access-Control-Allow-Credentials", "true")
+			}
+			if preflight {
+				ctx.Header("Access-Control-Allow-Methods", strings.Join(cfg.AllowMethods, ","))
+				if contains(cfg.AllowHeaders, "*") {
+					ctx.Header("Access-Control-Allow-Headers", ctx.Request.Header.Get("Access-Control-Request-Headers"))
+				} else {
+					ctx.Header("Access-Control-Allow-Headers", strings.Join(cfg.AllowHeaders, ","))
+				}
+				if cfg.MaxAge > 0 {
+					ctx.Header("Access-Control-Max-Age", strconv.FormatInt(cfg.MaxAge, 10))
+				}
+			} else {
+				ctx.Header("Access-Control-Expose-Headers", strings.Join(cfg.ExposeHeaders, ","))
+			}
+		}
+		//放行所有OPTIONS方法
+		if preflight {
+			ctx.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		// 处理请求
+		ctx.Next()
+	}
+}
+
+//CheckOrigin websocket握手的来源检查 没有Origin时允许
+//允许所有来源时只允许同源 避免其他网站使用用户的cookie建立连接 否则需要匹配允许的来源
+func (c *CORS) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	cfg := c.config()
+	if contains(cfg.AllowOrigins, "*") {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	return allowOrigin(cfg.AllowOrigins, origin)
+}
+
+//allowOrigin 来源是否允许
+func allowOrigin(origins []string, origin string) bool {
+	for _, pattern := range origins {
+		if match(strings.ToLower(pattern), strings.ToLower(origin)) {
+			return true
+		}
+	}
+	return false
+}
+
+//match 通配符匹配 *匹配任意字符
+func match(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		index := strings.Index(value, part)
+		if index < 0 {
+			return false
+		}
+		value = value[index+len(part):]
+	}
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
+
+//contains 列表中是否包含
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
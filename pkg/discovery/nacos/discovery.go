@@ -4,11 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"sync"
 
 	"github.com/tang-go/go-dog/lib/net"
 	"github.com/tang-go/go-dog/log"
 	"github.com/tang-go/go-dog/nacos"
+	"github.com/tang-go/go-dog/pkg/route"
 	"github.com/tang-go/go-dog/plugins"
 	"github.com/tang-go/go-dog/serviceinfo"
 )
@@ -25,6 +27,7 @@ type Discovery struct {
 	apidata    map[string]*serviceinfo.ServiceInfo
 	rpcdata    map[string]*serviceinfo.ServiceInfo
 	apis       map[string]*serviceinfo.ServcieAPI
+	routes     *route.Tree
 	gate       string
 	lock       sync.RWMutex
 }
@@ -40,6 +43,7 @@ func NewDiscovery(cfg plugins.Cfg) *Discovery {
 		apidata:    make(map[string]*serviceinfo.ServiceInfo),
 		rpcdata:    make(map[string]*serviceinfo.ServiceInfo),
 		apis:       make(map[string]*serviceinfo.ServcieAPI),
+		routes:     route.NewTree(),
 		gate:       "",
 	}
 	dis.WatchRPC()
@@ -97,10 +101,14 @@ func (d *Discovery) watchAPI(gate string) {
 				apis = append(apis, method)
 				url := method.Kind + method.Path
 				if api, ok := d.apis[url]; ok {
+					if api.Name != info.Name {
+						log.Errorf("api 路由冲突 | %s | %s | 已被%s注册 ", info.Name, url, api.Name)
+						continue
+					}
 					api.Count++
 					d.apis[url] = api
 				} else {
-					d.apis[url] = &serviceinfo.ServcieAPI{
+					api := &serviceinfo.ServcieAPI{
 						Method:  method,
 						Gate:    method.Gate,
 						Tags:    method.Group,
@@ -108,6 +116,11 @@ func (d *Discovery) watchAPI(gate string) {
 						Name:    info.Name,
 						Count:   1,
 					}
+					if err := d.routes.Add(method.Kind, method.Path, api); err != nil {
+						log.Errorf("api 路由冲突 | %s | %s | %s ", info.Name, url, err.Error())
+						continue
+					}
+					d.apis[url] = api
 					log.Tracef("api 上线 | %s | %s | %s ", info.Name, info.Key, url)
 				}
 			}
@@ -126,10 +139,11 @@ func (d *Discovery) watchAPI(gate string) {
 					continue
 				}
 				url := method.Kind + method.Path
-				if api, ok := d.apis[url]; ok {
+				if api, ok := d.apis[url]; ok && api.Name == info.Name {
 					api.Count--
 					if api.Count <= 0 {
 						delete(d.apis, url)
+						d.routes.Remove(method.Kind, method.Path)
 						log.Tracef("api 下线 | %s | %s | %s ", info.Name, info.Key, url)
 					}
 				}
@@ -152,6 +166,9 @@ func (d *Discovery) watchRPC() {
 			info.Group = "RPC"
 			info.Time = i.Metadata["Time"]
 			info.Explain = i.Metadata["Explain"]
+			info.Zone = i.Metadata["Zone"]
+			info.Version = i.Metadata["Version"]
+			info.Shadow, _ = strconv.ParseBool(i.Metadata["Shadow"])
 			info.Name = i.ServiceName
 			info.Address = i.Ip
 			info.Port = int(i.Port)
@@ -165,6 +182,9 @@ func (d *Discovery) watchRPC() {
 			info.Group = "RPC"
 			info.Time = i.Metadata["Time"]
 			info.Explain = i.Metadata["Explain"]
+			info.Zone = i.Metadata["Zone"]
+			info.Version = i.Metadata["Version"]
+			info.Shadow, _ = strconv.ParseBool(i.Metadata["Shadow"])
 			info.Name = i.ServiceName
 			info.Address = i.Ip
 			info.Port = int(i.Port)
@@ -187,12 +207,15 @@ func (d *Discovery) GetRPCServiceByName(name string) (services []*serviceinfo.Se
 	return
 }
 
-//GetAPIByURL 通过RUL获取API服务
-func (d *Discovery) GetAPIByURL(url string) (*serviceinfo.ServcieAPI, bool) {
+//GetAPIByURL 通过请求类型以及路径匹配API服务 返回路径参数
+func (d *Discovery) GetAPIByURL(method, path string) (*serviceinfo.ServcieAPI, map[string]string, bool) {
 	d.lock.RLock()
 	defer d.lock.RUnlock()
-	s, ok := d.apis[url]
-	return s, ok
+	value, params, ok := d.routes.Find(method, path)
+	if !ok {
+		return nil, nil, false
+	}
+	return value.(*serviceinfo.ServcieAPI), params, true
 }
 
 //RangeAPI 遍历api
@@ -42,7 +42,9 @@ func NewFusing(ttl time.Duration) *Fusing {
 
 //SetFusingTTL 设置熔断统计时间
 func (f *Fusing) SetFusingTTL(ttl time.Duration) {
+	f.lock.Lock()
 	f.ttl = ttl
+	f.lock.Unlock()
 }
 
 //AddError 添加服务错误
@@ -126,8 +128,11 @@ func (f *Fusing) Close() {
 func (f *Fusing) eventloop() {
 	defer recover.Recover()
 	for {
+		f.lock.RLock()
+		ttl := f.ttl
+		f.lock.RUnlock()
 		select {
-		case <-time.After(f.ttl):
+		case <-time.After(ttl):
 			//清空所有统计数量
 			f.lock.Lock()
 			for key, m := range f.methods {
@@ -0,0 +1,330 @@
+package gateway
+
+import (
+	"container/heap"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/pkg/auth"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+	"golang.org/x/time/rate"
+)
+
+const (
+	//signWindow 默认签名时间戳误差 单位秒
+	signWindow = 300
+	//noncePrefix 随机数key前缀
+	noncePrefix = "gateway:nonce:"
+)
+
+//apiKeys 配置文件中api_key字段的API key以及签名路由 配置变化时重新加载
+type apiKeys struct {
+	keys   map[string]*plugins.APIKey
+	routes []string
+	window int64
+	lock   sync.RWMutex
+}
+
+//load 加载配置
+func (a *apiKeys) load(cfg plugins.Cfg) {
+	c := struct {
+		APIKey struct {
+			Routes []string          `json:"routes"` //只允许签名访问的url前缀
+			Window int64             `json:"window"` //时间戳误差 单位秒
+			Keys   []*plugins.APIKey `json:"keys"`
+		} `json:"api_key"`
+	}{}
+	if err := cfg.Unmarshal(&c); err != nil {
+		log.Traceln("读取api_key配置失败", err.Error())
+	}
+	keys := make(map[string]*plugins.APIKey)
+	for _, key := range c.APIKey.Keys {
+		keys[key.Key] = key
+	}
+	if c.APIKey.Window <= 0 {
+		c.APIKey.Window = signWindow
+	}
+	a.lock.Lock()
+	a.keys = keys
+	a.routes = c.APIKey.Routes
+	a.window = c.APIKey.Window
+	a.lock.Unlock()
+}
+
+//GetAPIKey 获取API key
+func (a *apiKeys) GetAPIKey(key string) (*plugins.APIKey, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.keys[key], nil
+}
+
+//signed 是否只允许签名访问
+func (a *apiKeys) signed(url string) bool {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return hasPrefix(url, a.routes)
+}
+
+//getWindow 获取时间戳误差
+func (a *apiKeys) getWindow() int64 {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.window
+}
+
+//nonceStore 随机数存储 时间窗口内同一个随机数只能使用一次
+type nonceStore interface {
+	use(key, nonce string, timestamp, window int64) bool
+}
+
+//nonceShards 内存随机数存储的分片数量
+const nonceShards = 16
+
+//memNonce 内存随机数存储 按API key分片 每个分片按时间戳维护最小堆淘汰过期的随机数
+type memNonce struct {
+	shards [nonceShards]nonceShard
+}
+
+//nonceShard 随机数分片
+type nonceShard struct {
+	data map[string]struct{}
+	heap nonceHeap
+	lock sync.Mutex
+}
+
+//nonceItem 随机数以及时间戳
+type nonceItem struct {
+	key       string
+	timestamp int64
+}
+
+//nonceHeap 按时间戳排序的最小堆
+type nonceHeap []nonceItem
+
+func (h nonceHeap) Len() int            { return len(h) }
+func (h nonceHeap) Less(i, j int) bool  { return h[i].timestamp < h[j].timestamp }
+func (h nonceHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *nonceHeap) Push(x interface{}) { *h = append(*h, x.(nonceItem)) }
+func (h *nonceHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+func newMemNonce() *memNonce {
+	m := new(memNonce)
+	for i := range m.shards {
+		m.shards[i].data = make(map[string]struct{})
+	}
+	return m
+}
+
+func (m *memNonce) use(key, nonce string, timestamp, window int64) bool {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	s := &m.shards[h.Sum32()%nonceShards]
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	//只淘汰堆顶过期的随机数
+	expire := time.Now().Unix() - window
+	for len(s.heap) > 0 && s.heap[0].timestamp < expire {
+		delete(s.data, heap.Pop(&s.heap).(nonceItem).key)
+	}
+	k := key + ":" + nonce
+	if _, ok := s.data[k]; ok {
+		return false
+	}
+	s.data[k] = struct{}{}
+	heap.Push(&s.heap, nonceItem{key: k, timestamp: timestamp})
+	return true
+}
+
+//redisNonce redis随机数存储 多个网关实例共享 每个API key一个有序集合 积分为时间戳
+type redisNonce struct {
+	gateway *Gateway
+}
+
+func (r *redisNonce) use(key, nonce string, timestamp, window int64) bool {
+	c := r.gateway.redis()
+	k := noncePrefix + r.gateway.name + ":" + key
+	c.ZRemRangeByScore(k, 0, time.Now().Unix()-window-1)
+	count, err := c.Zadd(k, timestamp, nonce)
+	if err != nil {
+		log.Errorln(err.Error())
+		return false
+	}
+	return count > 0
+}
+
+//signBody 读取请求内容时计算sha256
+type signBody struct {
+	io.ReadCloser
+	hash hash.Hash
+}
+
+func (b *signBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	return n, err
+}
+
+//KeyStore 设置API key存储 默认使用配置文件中的api_key
+func (g *Gateway) KeyStore(store plugins.KeyStore) {
+	g.keyStore = store
+}
+
+//SignRoutes 设置只允许API key签名访问的url前缀
+func (g *Gateway) SignRoutes(prefix ...string) {
+	g.signRoutes = append(g.signRoutes, prefix...)
+}
+
+//signBody 请求携带API key时计算请求内容的sha256 需要在读取请求内容之前调用
+func (g *Gateway) signBody(c *gin.Context) *signBody {
+	if c.Request.Header.Get(plugins.APIKeyHeader) == "" {
+		return nil
+	}
+	body := &signBody{ReadCloser: c.Request.Body, hash: sha256.New()}
+	c.Request.Body = body
+	return body
+}
+
+//nonces 获取随机数存储
+func (g *Gateway) nonces() nonceStore {
+	g.nonceOnce.Do(func() {
+		if g.redis() != nil {
+			g.nonce = &redisNonce{gateway: g}
+		} else {
+			g.nonce = newMemNonce()
+		}
+	})
+	return g.nonce
+}
+
+//signOnly 路由是否只允许API key签名访问
+func (g *Gateway) signOnly(url string) bool {
+	return hasPrefix(url, g.signRoutes) || g.apiKeys.signed(url)
+}
+
+//signature 验证API key签名 验证通过时身份信息写入ctx 返回是否通过API key访问
+func (g *Gateway) signature(c *gin.Context, ctx plugins.Context, url string, api *serviceinfo.API, body *signBody) (bool, *customerror.Error) {
+	key := c.Request.Header.Get(plugins.APIKeyHeader)
+	if key == "" {
+		if g.signOnly(url) {
+			return false, customerror.EnCodeError(customerror.Unauthorized, "API key不能为空")
+		}
+		return false, nil
+	}
+	store := g.keyStore
+	if store == nil {
+		store = g.apiKeys
+	}
+	apiKey, err := store.GetAPIKey(key)
+	if err != nil {
+		log.Errorln(err.Error())
+		return true, customerror.EnCodeError(customerror.InternalServerError, "API key查询失败")
+	}
+	if apiKey == nil || apiKey.Disabled {
+		return true, customerror.EnCodeError(customerror.Unauthorized, "API key不正确")
+	}
+	if len(apiKey.Routes) > 0 && !hasPrefix(url, apiKey.Routes) {
+		return true, customerror.EnCodeError(customerror.Forbidden, "API key不能访问该路由")
+	}
+	timestamp, err := strconv.ParseInt(c.Request.Header.Get(plugins.TimestampHeader), 10, 64)
+	if err != nil {
+		return true, customerror.EnCodeError(customerror.Unauthorized, "时间戳不正确")
+	}
+	window := g.apiKeys.getWindow()
+	if now := time.Now().Unix(); timestamp < now-window || timestamp > now+window {
+		return true, customerror.EnCodeError(customerror.Unauthorized, "请求已过期")
+	}
+	nonce := c.Request.Header.Get(plugins.NonceHeader)
+	if nonce == "" || len(nonce) > 64 {
+		return true, customerror.EnCodeError(customerror.Unauthorized, "随机数不正确")
+	}
+	sum := sha256.New()
+	if body != nil {
+		//读取剩余的请求内容
+		io.Copy(ioutil.Discard, c.Request.Body)
+		sum = body.hash
+	}
+	signature, err := hex.DecodeString(c.Request.Header.Get(plugins.SignatureHeader))
+	if err != nil || !hmac.Equal(signature, sign(apiKey.Secret, c, timestamp, nonce, sum.Sum(nil))) {
+		log.Tracef("签名验证失败 | %s | %s | %s ", key, c.ClientIP(), url)
+		return true, customerror.EnCodeError(customerror.Unauthorized, "签名不正确")
+	}
+	if !g.nonces().use(key, nonce, timestamp, window) {
+		return true, customerror.EnCodeError(customerror.Unauthorized, "重复的请求")
+	}
+	if !g.allow(apiKey) {
+		return true, customerror.EnCodeError(customerror.ClientLimitError, "超过API key每秒请求限制")
+	}
+	claims := &plugins.Claims{
+		Subject:     apiKey.Name,
+		Roles:       apiKey.Roles,
+		Permissions: apiKey.Permissions,
+		Extra:       map[string]interface{}{"apikey": apiKey.Key},
+	}
+	if claims.Subject == "" {
+		claims.Subject = apiKey.Key
+	}
+	if err := ctx.SetData(plugins.ClaimsKey, claims); err != nil {
+		return true, customerror.EnCodeError(customerror.InternalServerError, err.Error())
+	}
+	if err := auth.Check(claims, api.Access); err != nil {
+		return true, customerror.DeCodeError(err)
+	}
+	return true, nil
+}
+
+//allow 按API key限流
+func (g *Gateway) allow(apiKey *plugins.APIKey) bool {
+	if apiKey.Quota <= 0 {
+		return true
+	}
+	value, _ := g.quotas.LoadOrStore(apiKey.Key, rate.NewLimiter(rate.Limit(apiKey.Quota), apiKey.Quota))
+	limiter := value.(*rate.Limiter)
+	if limiter.Burst() != apiKey.Quota {
+		//配额变化
+		limiter.SetLimit(rate.Limit(apiKey.Quota))
+		limiter.SetBurst(apiKey.Quota)
+	}
+	return limiter.Allow()
+}
+
+//sign 计算签名
+func sign(secret string, c *gin.Context, timestamp int64, nonce string, sum []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, strings.Join([]string{
+		c.Request.Method,
+		c.Request.URL.Path,
+		c.Request.URL.Query().Encode(),
+		strconv.FormatInt(timestamp, 10),
+		nonce,
+		hex.EncodeToString(sum),
+	}, "\n"))
+	return mac.Sum(nil)
+}
+
+//hasPrefix url是否匹配其中一个前缀
+func hasPrefix(url string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(url, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/pkg/context"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+//signRequest 测试使用的签名请求
+type signRequest struct {
+	method    string
+	url       string
+	body      string
+	key       string
+	secret    string
+	timestamp int64
+	nonce     string
+	//签名后修改请求
+	tamper func(r *http.Request)
+}
+
+//newSignGateway 创建只包含API key配置的网关
+func newSignGateway() *Gateway {
+	g := &Gateway{
+		apiKeys: &apiKeys{
+			keys: map[string]*plugins.APIKey{
+				"k1":       {Key: "k1", Secret: "s1", Name: "partner", Roles: []string{"partner"}, Routes: []string{"/api/open/"}},
+				"disabled": {Key: "disabled", Secret: "s2", Disabled: true},
+				"quota":    {Key: "quota", Secret: "s3", Quota: 1},
+			},
+			routes: []string{"/api/open/"},
+			window: signWindow,
+		},
+		nonce: newMemNonce(),
+	}
+	g.nonceOnce.Do(func() {})
+	return g
+}
+
+//build 按签名规则生成请求
+func (r *signRequest) build() *http.Request {
+	req := httptest.NewRequest(r.method, r.url, strings.NewReader(r.body))
+	if r.key == "" {
+		return req
+	}
+	sum := sha256.Sum256([]byte(r.body))
+	mac := hmac.New(sha256.New, []byte(r.secret))
+	mac.Write([]byte(strings.Join([]string{
+		req.Method,
+		req.URL.Path,
+		req.URL.Query().Encode(),
+		strconv.FormatInt(r.timestamp, 10),
+		r.nonce,
+		hex.EncodeToString(sum[:]),
+	}, "\n")))
+	req.Header.Set(plugins.APIKeyHeader, r.key)
+	req.Header.Set(plugins.TimestampHeader, strconv.FormatInt(r.timestamp, 10))
+	req.Header.Set(plugins.NonceHeader, r.nonce)
+	req.Header.Set(plugins.SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	if r.tamper != nil {
+		r.tamper(req)
+	}
+	return req
+}
+
+//verify 验证签名 返回是否通过API key访问以及错误码 通过时错误码为0
+func verify(g *Gateway, req *http.Request, api *serviceinfo.API) (bool, int) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = req
+	body := g.signBody(c)
+	url := req.URL.Path
+	signed, err := g.signature(c, context.Background(), url, api, body)
+	if err != nil {
+		return signed, err.Code
+	}
+	return signed, 0
+}
+
+func TestSignature(t *testing.T) {
+	now := time.Now().Unix()
+	api := &serviceinfo.API{}
+	tests := []struct {
+		name   string
+		req    signRequest
+		api    *serviceinfo.API
+		signed bool
+		code   int
+	}{
+		{"valid", signRequest{method: "POST", url: "/api/open/order?b=2&a=1", body: `{"id":1}`, key: "k1", secret: "s1", timestamp: now, nonce: "n1"}, api, true, 0},
+		{"no key on normal route", signRequest{method: "GET", url: "/api/user"}, api, false, 0},
+		{"no key on signed route", signRequest{method: "GET", url: "/api/open/order"}, api, false, customerror.Unauthorized},
+		{"unknown key", signRequest{method: "GET", url: "/api/open/order", key: "k0", secret: "s1", timestamp: now, nonce: "n2"}, api, true, customerror.Unauthorized},
+		{"disabled key", signRequest{method: "GET", url: "/api/open/order", key: "disabled", secret: "s2", timestamp: now, nonce: "n3"}, api, true, customerror.Unauthorized},
+		{"route not allowed", signRequest{method: "GET", url: "/api/user", key: "k1", secret: "s1", timestamp: now, nonce: "n4"}, api, true, customerror.Forbidden},
+		{"wrong secret", signRequest{method: "GET", url: "/api/open/order", key: "k1", secret: "forged", timestamp: now, nonce: "n5"}, api, true, customerror.Unauthorized},
+		{"expired", signRequest{method: "GET", url: "/api/open/order", key: "k1", secret: "s1", timestamp: now - signWindow - 10, nonce: "n6"}, api, true, customerror.Unauthorized},
+		{"future", signRequest{method: "GET", url: "/api/open/order", key: "k1", secret: "s1", timestamp: now + signWindow + 10, nonce: "n7"}, api, true, customerror.Unauthorized},
+		{"empty nonce", signRequest{method: "GET", url: "/api/open/order", key: "k1", secret: "s1", timestamp: now}, api, true, customerror.Unauthorized},
+		{"long nonce", signRequest{method: "GET", url: "/api/open/order", key: "k1", secret: "s1", timestamp: now, nonce: strings.Repeat("n", 65)}, api, true, customerror.Unauthorized},
+		{"tampered body", signRequest{method: "POST", url: "/api/open/order", body: `{"id":1}`, key: "k1", secret: "s1", timestamp: now, nonce: "n8", tamper: func(r *http.Request) {
+			r.Body = httptest.NewRequest("POST", "/", strings.NewReader(`{"id":2}`)).Body
+		}}, api, true, customerror.Unauthorized},
+		{"tampered query", signRequest{method: "GET", url: "/api/open/order?id=1", key: "k1", secret: "s1", timestamp: now, nonce: "n9", tamper: func(r *http.Request) {
+			r.URL.RawQuery = "id=2"
+		}}, api, true, customerror.Unauthorized},
+		{"tampered method", signRequest{method: "GET", url: "/api/open/order", key: "k1", secret: "s1", timestamp: now, nonce: "n10", tamper: func(r *http.Request) {
+			r.Method = "DELETE"
+		}}, api, true, customerror.Unauthorized},
+		{"tampered timestamp", signRequest{method: "GET", url: "/api/open/order", key: "k1", secret: "s1", timestamp: now, nonce: "n11", tamper: func(r *http.Request) {
+			r.Header.Set(plugins.TimestampHeader, strconv.FormatInt(now-1, 10))
+		}}, api, true, customerror.Unauthorized},
+		{"access role", signRequest{method: "GET", url: "/api/open/order", key: "k1", secret: "s1", timestamp: now, nonce: "n12"}, &serviceinfo.API{Access: &serviceinfo.Access{Roles: []string{"partner"}}}, true, 0},
+		{"missing role", signRequest{method: "GET", url: "/api/open/order", key: "k1", secret: "s1", timestamp: now, nonce: "n13"}, &serviceinfo.API{Access: &serviceinfo.Access{Roles: []string{"admin"}}}, true, customerror.Forbidden},
+	}
+	g := newSignGateway()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signed, code := verify(g, test.req.build(), test.api)
+			if signed != test.signed || code != test.code {
+				t.Fatalf("signature = %t, %d want %t, %d", signed, code, test.signed, test.code)
+			}
+		})
+	}
+}
+
+func TestSignatureReplay(t *testing.T) {
+	g := newSignGateway()
+	now := time.Now().Unix()
+	req := signRequest{method: "POST", url: "/api/open/order", body: `{"id":1}`, key: "k1", secret: "s1", timestamp: now, nonce: "replay"}
+	if _, code := verify(g, req.build(), &serviceinfo.API{}); code != 0 {
+		t.Fatalf("first request code = %d", code)
+	}
+	if _, code := verify(g, req.build(), &serviceinfo.API{}); code != customerror.Unauthorized {
+		t.Fatalf("replayed request code = %d want %d", code, customerror.Unauthorized)
+	}
+	//签名失败的请求不占用随机数
+	forged := req
+	forged.nonce, forged.secret = "fresh", "forged"
+	if _, code := verify(g, forged.build(), &serviceinfo.API{}); code != customerror.Unauthorized {
+		t.Fatalf("forged request code = %d", code)
+	}
+	fresh := req
+	fresh.nonce = "fresh"
+	if _, code := verify(g, fresh.build(), &serviceinfo.API{}); code != 0 {
+		t.Fatalf("fresh nonce code = %d", code)
+	}
+	//随机数按API key区分
+	other := signRequest{method: "GET", url: "/api/open/order", key: "quota", secret: "s3", timestamp: now, nonce: "replay"}
+	if _, code := verify(g, other.build(), &serviceinfo.API{}); code != 0 {
+		t.Fatalf("other key code = %d", code)
+	}
+	//超过每秒请求限制
+	other.nonce = "quota2"
+	if _, code := verify(g, other.build(), &serviceinfo.API{}); code != customerror.ClientLimitError {
+		t.Fatalf("quota code = %d want %d", code, customerror.ClientLimitError)
+	}
+}
+
+func TestMemNonce(t *testing.T) {
+	m := newMemNonce()
+	now := time.Now().Unix()
+	tests := []struct {
+		name      string
+		key       string
+		nonce     string
+		timestamp int64
+		ok        bool
+	}{
+		{"first", "k1", "a", now, true},
+		{"replay", "k1", "a", now, false},
+		{"other key", "k2", "a", now, true},
+		{"in window", "k1", "b", now - 30, true},
+		{"in window replay", "k1", "b", now - 30, false},
+		{"expired", "k1", "c", now - 120, true},
+		{"expired evicted", "k1", "c", now - 120, true},
+		{"not evicted", "k1", "a", now, false},
+	}
+	for _, test := range tests {
+		if ok := m.use(test.key, test.nonce, test.timestamp, 60); ok != test.ok {
+			t.Fatalf("%s: use = %t want %t", test.name, ok, test.ok)
+		}
+	}
+}
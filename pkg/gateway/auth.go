@@ -0,0 +1,55 @@
+package gateway
+
+import (
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/pkg/auth"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+//Authenticator 设置身份验证插件 验证通过后身份信息写入Context data并校验API的访问权限
+func (g *Gateway) Authenticator(authenticator plugins.Authenticator) {
+	g.authenticator = authenticator
+}
+
+//identity 请求的身份 token以及身份信息中的sub API key访问时没有token
+func identity(ctx plugins.Context) string {
+	id := ctx.GetToken()
+	if claims, ok := auth.Claims(ctx); ok {
+		id += "|" + claims.Subject
+	}
+	return id
+}
+
+//authenticate 验证token api为空时只验证身份
+func (g *Gateway) authenticate(ctx plugins.Context, token, url string, api *serviceinfo.API) *customerror.Error {
+	if token == "" {
+		return customerror.EnCodeError(customerror.ParamError, "token不能为空")
+	}
+	if g.authfunc != nil {
+		if err := g.authfunc(ctx, token, url); err != nil {
+			log.Traceln(err.Error())
+			return customerror.EnCodeError(customerror.ParamError, "token不正确")
+		}
+	}
+	if g.authenticator != nil {
+		claims, err := g.authenticator.Verify(ctx, token)
+		if err != nil {
+			log.Traceln("身份验证失败", url, err.Error())
+			return customerror.EnCodeError(customerror.Unauthorized, "token不正确")
+		}
+		if err := ctx.SetData(plugins.ClaimsKey, claims); err != nil {
+			return customerror.EnCodeError(customerror.InternalServerError, err.Error())
+		}
+		if api != nil {
+			if err := auth.Check(claims, api.Access); err != nil {
+				log.Traceln("没有访问权限", url, claims.Subject, err.Error())
+				return customerror.DeCodeError(err)
+			}
+		}
+	}
+	//设置token
+	ctx.SetToken(token)
+	return nil
+}
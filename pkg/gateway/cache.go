@@ -0,0 +1,371 @@
+package gateway
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tang-go/go-dog/cache"
+	"github.com/tang-go/go-dog/cache/mem"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/metrics"
+	"github.com/tang-go/go-dog/pkg/config"
+	"github.com/tang-go/go-dog/pkg/context"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+//cachePrefix 缓存key前缀
+const cachePrefix = "gateway:cache:"
+
+//pruneInterval 清理标签索引中过期key的间隔 单位秒
+const pruneInterval = 60
+
+//cacheEntry 缓存的响应
+type cacheEntry struct {
+	Body []byte   `json:"body"` //服务返回的内容
+	ETag string   `json:"etag"` //内容标识
+	Time int64    `json:"time"` //缓存时间 unix秒
+	Tags []string `json:"tags"` //缓存标签
+	TTL  int64    `json:"ttl"`  //缓存时间 包含stale时间 单位秒
+}
+
+//expire 过期时间 unix秒
+func (c *cacheEntry) expire() int64 {
+	return c.Time + c.TTL
+}
+
+//cacheStore 响应缓存存储
+type cacheStore interface {
+	get(key string) (*cacheEntry, bool)
+	set(key string, entry *cacheEntry, ttl int64)
+	invalidate(tag string) int
+}
+
+//indexed 标签索引中的key
+type indexed struct {
+	expire int64
+	tags   []string
+}
+
+//tagIndex 本实例读写过的缓存标签 过期的key定时清理
+type tagIndex struct {
+	data   map[string]map[string]bool
+	keys   map[string]*indexed
+	pruned int64
+	lock   sync.Mutex
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		data:   make(map[string]map[string]bool),
+		keys:   make(map[string]*indexed),
+		pruned: time.Now().Unix(),
+	}
+}
+
+//add 记录标签对应的key 已经记录过相同的过期时间时直接返回
+func (t *tagIndex) add(key string, tags []string, expire int64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := time.Now().Unix()
+	if now-t.pruned >= pruneInterval {
+		t.prune(now)
+	}
+	if old, ok := t.keys[key]; ok {
+		if old.expire == expire {
+			return
+		}
+		t.remove(key)
+	}
+	if len(tags) <= 0 || expire <= now {
+		return
+	}
+	t.keys[key] = &indexed{expire: expire, tags: tags}
+	for _, tag := range tags {
+		keys, ok := t.data[tag]
+		if !ok {
+			keys = make(map[string]bool)
+			t.data[tag] = keys
+		}
+		keys[key] = true
+	}
+}
+
+//take 取出并删除标签对应的key
+func (t *tagIndex) take(tag string) []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	keys := make([]string, 0, len(t.data[tag]))
+	for key := range t.data[tag] {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		t.remove(key)
+	}
+	delete(t.data, tag)
+	return keys
+}
+
+//prune 清理过期的key
+func (t *tagIndex) prune(now int64) {
+	for key, item := range t.keys {
+		if item.expire <= now {
+			t.remove(key)
+		}
+	}
+	t.pruned = now
+}
+
+//remove 从所有标签中删除key
+func (t *tagIndex) remove(key string) {
+	item, ok := t.keys[key]
+	if !ok {
+		return
+	}
+	for _, tag := range item.tags {
+		if keys, ok := t.data[tag]; ok {
+			delete(keys, key)
+			if len(keys) <= 0 {
+				delete(t.data, tag)
+			}
+		}
+	}
+	delete(t.keys, key)
+}
+
+//memStore 内存缓存
+type memStore struct {
+	mem  *mem.Mem
+	tags *tagIndex
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		mem:  mem.NewMem(),
+		tags: newTagIndex(),
+	}
+}
+
+func (m *memStore) get(key string) (*cacheEntry, bool) {
+	value, ok := m.mem.Get(key)
+	if !ok {
+		return nil, false
+	}
+	entry := new(cacheEntry)
+	if err := json.Unmarshal([]byte(value), entry); err != nil {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (m *memStore) set(key string, entry *cacheEntry, ttl int64) {
+	buff, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	m.mem.Set(key, string(buff), ttl)
+	m.tags.add(key, entry.Tags, entry.expire())
+}
+
+func (m *memStore) invalidate(tag string) int {
+	keys := m.tags.take(tag)
+	for _, key := range keys {
+		m.mem.Del(key)
+	}
+	return len(keys)
+}
+
+//redisStore redis缓存 多个网关实例共享
+type redisStore struct {
+	cache cache.Inter
+	tags  *tagIndex
+}
+
+func (r *redisStore) get(key string) (*cacheEntry, bool) {
+	entry := new(cacheEntry)
+	if err := r.cache.Get(key, entry); err != nil {
+		return nil, false
+	}
+	//记录标签 失效时需要删除redis客户端在本实例的内存副本
+	r.tags.add(key, entry.Tags, entry.expire())
+	return entry, true
+}
+
+func (r *redisStore) set(key string, entry *cacheEntry, ttl int64) {
+	if err := r.cache.SetByTime(key, entry, ttl); err != nil {
+		log.Errorln(err.Error())
+		return
+	}
+	r.tags.add(key, entry.Tags, entry.expire())
+	for _, tag := range entry.Tags {
+		r.cache.Sadd(tag, key)
+		//标签集合的过期时间不小于其中最长的缓存时间
+		if left, err := r.cache.TTL(tag); err != nil || left < ttl {
+			r.cache.Expire(tag, ttl)
+		}
+	}
+}
+
+func (r *redisStore) invalidate(tag string) int {
+	keys := r.tags.take(tag)
+	if members, err := r.cache.SMembers(tag); err == nil {
+		keys = append(keys, members...)
+	}
+	for _, key := range keys {
+		r.cache.Del(key)
+	}
+	r.cache.Del(tag)
+	return len(keys)
+}
+
+//redis 获取网关实例共享的redis 没有配置gateway_cache为redis或者连接失败时返回nil
+func (g *Gateway) redis() cache.Inter {
+	g.redisOnce.Do(func() {
+		if g.cfg.GetGatewayCache() != config.RedisCache {
+			return
+		}
+		defer func() {
+			if err := recover(); err != nil {
+				log.Errorf("网关连接redis失败,使用内存存储 | %v ", err)
+			}
+		}()
+		g.redisCache = cache.NewCache(g.cfg).GetCache()
+	})
+	return g.redisCache
+}
+
+//cacheStore 获取缓存存储 redis不可用时使用内存
+func (g *Gateway) cacheStore() cacheStore {
+	g.cacheOnce.Do(func() {
+		//缓存失效需要网关的RPC服务
+		g.rpcOnce.Do(g.runRPC)
+		if c := g.redis(); c != nil {
+			g.store = &redisStore{cache: c, tags: newTagIndex()}
+		} else {
+			g.store = newMemStore()
+		}
+	})
+	return g.store
+}
+
+//cached 缓存GET响应 过期后stale时间内返回旧数据并在后台刷新
+func (g *Gateway) cached(chain []plugins.Middleware, e *plugins.Exchange, apiservice *serviceinfo.ServcieAPI) {
+	policy := apiservice.Method.Cache
+	key := g.cacheKey(e.Gin, e.Ctx, apiservice, e.Request)
+	if entry, ok := g.cacheStore().get(key); ok {
+		age := time.Now().Unix() - entry.Time
+		if age <= policy.TTL {
+			g.cacheReply(chain, e, entry, "HIT", policy.TTL-age)
+			return
+		}
+		if age <= policy.TTL+policy.Stale {
+			g.revalidate(e.Ctx, key, apiservice, e.Params, e.Request)
+			g.cacheReply(chain, e, entry, "STALE", 0)
+			return
+		}
+	}
+	entry, err := g.cacheFetch(e.Ctx, key, apiservice, e.Params, e.Request)
+	if err != nil {
+		e.Error = err
+		g.reply(chain, e)
+		return
+	}
+	g.cacheReply(chain, e, entry, "MISS", policy.TTL)
+}
+
+//cacheFetch 请求服务并写入缓存
+func (g *Gateway) cacheFetch(ctx plugins.Context, key string, apiservice *serviceinfo.ServcieAPI, params map[string]string, body []byte) (*cacheEntry, error) {
+	url := ctx.GetURL()
+	metrics.MetricRequestBytes(g.name, url, float64(len(body)))
+	back, err := g.sendRequest(ctx, apiservice, body)
+	if err != nil {
+		return nil, err
+	}
+	metrics.MetricResponseBytes(g.name, url, float64(len(back)))
+	policy := apiservice.Method.Cache
+	sum := sha1.Sum(back)
+	entry := &cacheEntry{
+		Body: back,
+		ETag: `"` + hex.EncodeToString(sum[:]) + `"`,
+		Time: time.Now().Unix(),
+		TTL:  policy.TTL + policy.Stale,
+	}
+	for _, tag := range policy.Tags {
+		for name, value := range params {
+			tag = strings.Replace(tag, "{"+name+"}", value, -1)
+		}
+		entry.Tags = append(entry.Tags, cachePrefix+g.name+":tag:"+tag)
+	}
+	g.cacheStore().set(key, entry, entry.TTL)
+	return entry, nil
+}
+
+//revalidate 后台刷新缓存 同一个key同时只刷新一次
+func (g *Gateway) revalidate(ctx plugins.Context, key string, apiservice *serviceinfo.ServcieAPI, params map[string]string, body []byte) {
+	if _, loaded := g.refreshing.LoadOrStore(key, true); loaded {
+		return
+	}
+	rctx := context.WithTimeout(detach(ctx), ctx.GetTTL())
+	go func() {
+		defer g.refreshing.Delete(key)
+		defer rctx.Cancel()
+		if _, err := g.cacheFetch(rctx, key, apiservice, params, body); err != nil {
+			log.Traceln("缓存刷新失败", key, err.Error())
+		}
+	}()
+}
+
+//cacheReply 返回缓存的响应 If-None-Match命中时返回304
+func (g *Gateway) cacheReply(chain []plugins.Middleware, e *plugins.Exchange, entry *cacheEntry, state string, maxAge int64) {
+	c := e.Gin
+	control := "max-age=" + strconv.FormatInt(maxAge, 10)
+	if e.API.IsAuth {
+		control = "private, " + control
+	}
+	c.Header("Cache-Control", control)
+	c.Header("ETag", entry.ETag)
+	c.Header("X-Cache", state)
+	e.Response = entry.Body
+	for _, match := range strings.Split(c.Request.Header.Get("If-None-Match"), ",") {
+		if match = strings.TrimPrefix(strings.TrimSpace(match), "W/"); match == entry.ETag || match == "*" {
+			g.response(chain, e)
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+	g.reply(chain, e)
+}
+
+//cacheKey 缓存key 由路径、query参数、中间件改写后的请求参数、vary请求头、测试标识以及需要验证时的身份组成
+func (g *Gateway) cacheKey(c *gin.Context, ctx plugins.Context, apiservice *serviceinfo.ServcieAPI, body []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s?%s|%t|%s", c.Request.URL.Path, c.Request.URL.Query().Encode(), ctx.GetIsTest(), body)
+	for _, name := range apiservice.Method.Cache.Vary {
+		fmt.Fprintf(h, "|%s=%s", strings.ToLower(name), c.Request.Header.Get(name))
+	}
+	if apiservice.Method.IsAuth {
+		fmt.Fprintf(h, "|identity=%s", identity(ctx))
+	}
+	return cachePrefix + g.name + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+//invalidate 按标签失效缓存
+func (g *Gateway) invalidate(ctx plugins.Context, request *plugins.InvalidateRequest) (*plugins.InvalidateReply, error) {
+	if err := g.rpcCaller(ctx); err != nil {
+		return nil, err
+	}
+	reply := new(plugins.InvalidateReply)
+	for _, tag := range request.Tags {
+		reply.Count += g.cacheStore().invalidate(cachePrefix + g.name + ":tag:" + tag)
+	}
+	log.Tracef("缓存失效 | %v | %d ", request.Tags, reply.Count)
+	return reply, nil
+}
@@ -0,0 +1,155 @@
+package gateway
+
+import (
+	"strings"
+
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/metrics"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+var (
+	//queryKinds 参数在query中的请求类型
+	queryKinds = []string{string(plugins.GET), string(plugins.DELETE), string(plugins.HEAD)}
+	//bodyKinds 参数在body中的请求类型
+	bodyKinds = []string{string(plugins.POST), string(plugins.PUT), string(plugins.PATCH)}
+)
+
+//middleware 注册的中间件以及生效范围
+type middleware struct {
+	prefix string   //url前缀 为空时不限制
+	group  string   //api分组 为空时不限制
+	kinds  []string //请求类型 为空时不限制
+	legacy string   //旧版拦截器名称 同名的拦截器替换之前设置的
+	handle plugins.Middleware
+}
+
+//match 是否对请求生效
+func (m *middleware) match(url string, api *serviceinfo.API) bool {
+	if m.prefix != "" && !strings.HasPrefix(url, m.prefix) {
+		return false
+	}
+	if m.group != "" && m.group != api.Group {
+		return false
+	}
+	if len(m.kinds) <= 0 {
+		return true
+	}
+	for _, kind := range m.kinds {
+		if kind == api.Kind {
+			return true
+		}
+	}
+	return false
+}
+
+//Use 添加对全部路由生效的中间件
+func (g *Gateway) Use(handles ...plugins.Middleware) {
+	for _, handle := range handles {
+		g.middlewares = append(g.middlewares, &middleware{handle: handle})
+	}
+}
+
+//UsePrefix 添加对url前缀生效的中间件 例如:/api/order
+func (g *Gateway) UsePrefix(prefix string, handles ...plugins.Middleware) {
+	for _, handle := range handles {
+		g.middlewares = append(g.middlewares, &middleware{prefix: prefix, handle: handle})
+	}
+}
+
+//UseGroup 添加对api分组生效的中间件
+func (g *Gateway) UseGroup(group string, handles ...plugins.Middleware) {
+	for _, handle := range handles {
+		g.middlewares = append(g.middlewares, &middleware{group: group, handle: handle})
+	}
+}
+
+//chain 请求匹配的中间件
+func (g *Gateway) chain(url string, api *serviceinfo.API) []plugins.Middleware {
+	var chain []plugins.Middleware
+	for _, m := range g.middlewares {
+		if m.match(url, api) {
+			chain = append(chain, m.handle)
+		}
+	}
+	return chain
+}
+
+//request 执行中间件的请求阶段 返回执行过的中间件
+func (g *Gateway) request(chain []plugins.Middleware, e *plugins.Exchange) ([]plugins.Middleware, error) {
+	for i, handle := range chain {
+		if err := handle.Request(e); err != nil {
+			log.Traceln("中间件拦截请求", e.URL, err.Error())
+			return chain[:i+1], err
+		}
+		if e.Replied() {
+			return chain[:i+1], nil
+		}
+	}
+	return chain, nil
+}
+
+//response 按相反顺序执行中间件的响应阶段
+func (g *Gateway) response(chain []plugins.Middleware, e *plugins.Exchange) {
+	for i := len(chain) - 1; i >= 0; i-- {
+		chain[i].Response(e)
+	}
+}
+
+//exchange 执行中间件并请求服务 websocket以及gRPC等非http入口使用 返回响应阶段处理后的结果
+func (g *Gateway) exchange(e *plugins.Exchange, apiservice *serviceinfo.ServcieAPI) ([]byte, error) {
+	chain, err := g.request(g.chain(e.URL, e.API), e)
+	if err != nil {
+		return nil, exchangeError(err)
+	}
+	if !e.Replied() {
+		metrics.MetricRequestBytes(g.name, e.URL, float64(len(e.Request)))
+		if e.Response, e.Error = g.sendRequest(e.Ctx, apiservice, e.Request); e.Error == nil {
+			metrics.MetricResponseBytes(g.name, e.URL, float64(len(e.Response)))
+		}
+	}
+	g.response(chain, e)
+	if e.Error != nil {
+		return nil, customerror.DeCodeError(e.Error)
+	}
+	return e.Response, nil
+}
+
+//exchangeError 中间件返回的错误 非customerror.Error时作为参数错误
+func exchangeError(err error) *customerror.Error {
+	if e, ok := err.(*customerror.Error); ok {
+		return e
+	}
+	return customerror.EnCodeError(customerror.ParamError, err.Error())
+}
+
+//intercept 旧版拦截函数转换的中间件
+type intercept struct {
+	request  func(c plugins.Context, url string, request []byte) ([]byte, bool, error)
+	response func(c plugins.Context, url string, request []byte, response []byte)
+}
+
+//Request 请求阶段
+func (i *intercept) Request(e *plugins.Exchange) error {
+	if i.request == nil {
+		return nil
+	}
+	response, ok, err := i.request(e.Ctx, e.URL, e.Request)
+	if !ok {
+		return nil
+	}
+	if err != nil {
+		return customerror.EnCodeError(customerror.ParamError, err.Error())
+	}
+	e.Reply(response)
+	return nil
+}
+
+//Response 响应阶段
+func (i *intercept) Response(e *plugins.Exchange) {
+	if i.response != nil && e.Error == nil && !e.Replied() {
+		i.response(e.Ctx, e.URL, e.Request, e.Response)
+	}
+}
@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/lib/uuid"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/metrics"
+	"github.com/tang-go/go-dog/pkg/context"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+//flight 合并中的请求
+type flight struct {
+	done    chan struct{}
+	timeout int64  //共享请求的超时时间 unix纳秒
+	traceID string //共享请求的链路id
+	back    []byte
+	err     error
+}
+
+//flights 请求合并 相同key的请求同时只执行一次
+type flights struct {
+	data map[string]*flight
+	lock sync.Mutex
+}
+
+func newFlights() *flights {
+	return &flights{
+		data: make(map[string]*flight),
+	}
+}
+
+//do 执行请求 shared为true时复用了其他请求的结果
+//共享请求使用独立的ctx以及链路id 超时时间晚于进行中的请求时重新请求 所以共享请求的超时时间不小于所有等待的请求
+func (f *flights) do(key string, ctx plugins.Context, fn func(ctx plugins.Context) ([]byte, error)) (back []byte, err error, shared bool) {
+	f.lock.Lock()
+	if call, ok := f.data[key]; ok && call.timeout >= ctx.GetTimeOut() {
+		f.lock.Unlock()
+		log.Tracef("请求合并 | %s | %s ", ctx.GetTraceID(), call.traceID)
+		select {
+		case <-call.done:
+			return call.back, call.err, true
+		case <-ctx.Done():
+			return nil, customerror.EnCodeError(customerror.RequestTimeout, "请求超时"), true
+		}
+	}
+	call := &flight{
+		done:    make(chan struct{}),
+		timeout: ctx.GetTimeOut(),
+		traceID: uuid.GetToken(),
+	}
+	f.data[key] = call
+	f.lock.Unlock()
+	defer func() {
+		f.lock.Lock()
+		if f.data[key] == call {
+			delete(f.data, key)
+		}
+		f.lock.Unlock()
+		close(call.done)
+	}()
+	log.Tracef("请求合并 | %s | %s ", ctx.GetTraceID(), call.traceID)
+	sctx := detach(ctx)
+	sctx.SetTraceID(call.traceID)
+	sctx = context.WithTimeout(sctx, call.timeout-time.Now().UnixNano())
+	defer sctx.Cancel()
+	call.back, call.err = fn(sctx)
+	return call.back, call.err, false
+}
+
+//detach 复制请求的ctx 不继承超时以及取消
+func detach(ctx plugins.Context) plugins.Context {
+	datas := make(map[string][]byte)
+	for k, v := range ctx.GetData() {
+		datas[k] = v
+	}
+	n := context.NewContextByData(datas)
+	n.SetAddress(ctx.GetAddress())
+	n.SetIsTest(ctx.GetIsTest())
+	n.SetTraceID(ctx.GetTraceID())
+	n.SetToken(ctx.GetToken())
+	n.SetURL(ctx.GetURL())
+	n.SetClient(ctx.GetClient())
+	return n
+}
+
+//Coalesce 开启GET请求合并 相同路由、参数以及验证身份的并发请求只请求一次服务
+func (g *Gateway) Coalesce(enable bool) {
+	g.coalesce = enable
+}
+
+//sendRequest 发送GET/DELETE/HEAD请求 开启请求合并时并发的相同请求共享结果
+func (g *Gateway) sendRequest(ctx plugins.Context, apiservice *serviceinfo.ServcieAPI, body []byte) ([]byte, error) {
+	send := func(ctx plugins.Context) ([]byte, error) {
+		return g.GetClient().SendRequest(ctx, plugins.RandomMode, apiservice.Name, "", apiservice.Method.Name, "json", body)
+	}
+	//只合并幂等的读请求
+	if !g.coalesce || (apiservice.Method.Kind != string(plugins.GET) && apiservice.Method.Kind != string(plugins.HEAD)) {
+		return send(ctx)
+	}
+	//请求参数由网关编码 key相同的json内容相同 中间件设置的ctx数据也是key的一部分
+	key := apiservice.Name + "." + apiservice.Method.Name + "|" + strconv.FormatBool(ctx.GetIsTest()) + "|" + string(body)
+	if apiservice.Method.IsAuth {
+		key += "|" + identity(ctx)
+	}
+	datas := ctx.GetData()
+	names := make([]string, 0, len(datas))
+	for name := range datas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key += "|" + name + "=" + string(datas[name])
+	}
+	back, err, shared := g.flights.do(key, ctx, send)
+	if shared {
+		metrics.MetricCoalesceCount(g.name, ctx.GetURL())
+	}
+	return back, err
+}
@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/plugins"
+)
+
+//file 返回文件内容 支持Range以及If-None-Match/If-Modified-Since协商缓存
+func (g *Gateway) file(c *gin.Context, back []byte) {
+	reply := new(plugins.FileReply)
+	if err := g.GetClient().GetCodec().DeCode("json", back, reply); err != nil {
+		g.fail(c, customerror.EnCodeError(customerror.InternalServerError, "文件解析失败"))
+		return
+	}
+	contentType := reply.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(reply.Filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	if reply.Filename != "" {
+		disposition := "attachment"
+		if reply.Inline {
+			disposition = "inline"
+		}
+		c.Header("Content-Disposition", disposition+"; filename=\""+url.PathEscape(reply.Filename)+"\"; filename*=UTF-8''"+url.PathEscape(reply.Filename))
+	}
+	if reply.CacheControl != "" {
+		c.Header("Cache-Control", reply.CacheControl)
+	}
+	if etag := reply.ETag; etag != "" {
+		if !strings.HasPrefix(etag, "\"") && !strings.HasPrefix(etag, "W/") {
+			etag = "\"" + etag + "\""
+		}
+		c.Header("ETag", etag)
+	}
+	http.ServeContent(c.Writer, c.Request, reply.Filename, reply.LastModified, bytes.NewReader(reply.Data))
+}
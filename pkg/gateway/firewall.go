@@ -0,0 +1,421 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/metrics"
+	"github.com/tang-go/go-dog/plugins"
+)
+
+//wafBodySize 规则检查的请求内容最大长度
+const wafBodySize = 64 * 1024
+
+//aclConfig ip以及国家访问控制
+type aclConfig struct {
+	//允许访问的ip或者CIDR 为空时不限制
+	Allow []string `json:"allow"`
+	//拒绝访问的ip或者CIDR
+	Deny []string `json:"deny"`
+	//允许访问的国家代码 为空时不限制
+	AllowCountries []string `json:"allow_countries"`
+	//拒绝访问的国家代码
+	DenyCountries []string `json:"deny_countries"`
+	//请求内容大小限制 单位字节
+	MaxBodySize int64 `json:"max_body_size"`
+}
+
+//routeConfig url前缀的访问控制
+type routeConfig struct {
+	aclConfig
+	//url前缀
+	Prefix string `json:"prefix"`
+}
+
+//ruleConfig 拦截规则
+type ruleConfig struct {
+	//规则名称
+	Name string `json:"name"`
+	//生效的url前缀 为空时不限制
+	Prefix string `json:"prefix"`
+	//生效的请求方法 为空时不限制
+	Method string `json:"method"`
+	//检查的内容 path query header user_agent body
+	Target string `json:"target"`
+	//target为header时的请求头
+	Key string `json:"key"`
+	//正则表达式 匹配时拦截请求
+	Pattern string `json:"pattern"`
+}
+
+//firewallConfig 配置文件中的firewall字段
+type firewallConfig struct {
+	aclConfig
+	//可信代理的ip或者CIDR 只有可信代理的X-Forwarded-For以及国家请求头有效
+	//为空时防火墙使用对端地址 c.ClientIP()保持gin的默认行为
+	TrustedProxies []string `json:"trusted_proxies"`
+	//CDN提供的国家代码请求头 例如CF-IPCountry
+	CountryHeader string `json:"country_header"`
+	//url前缀的访问控制 优先使用最长匹配的前缀
+	Routes []*routeConfig `json:"routes"`
+	//拦截规则
+	Rules []*ruleConfig `json:"rules"`
+}
+
+//acl 解析后的访问控制
+type acl struct {
+	allow          []*net.IPNet
+	deny           []*net.IPNet
+	allowCountries []string
+	denyCountries  []string
+	maxBodySize    int64
+}
+
+//routeACL url前缀的访问控制
+type routeACL struct {
+	*acl
+	prefix string
+}
+
+//wafRule 解析后的拦截规则
+type wafRule struct {
+	*ruleConfig
+	re *regexp.Regexp
+}
+
+//firewall 网关防火墙 配置变化时重新加载
+type firewall struct {
+	proxies []*net.IPNet
+	country string
+	gate    *acl
+	routes  []*routeACL
+	rules   []*wafRule
+}
+
+//firewalls 当前生效的防火墙
+type firewalls struct {
+	fw   *firewall
+	lock sync.RWMutex
+}
+
+//load 加载配置 配置错误时继续使用旧的配置
+func (f *firewalls) load(cfg plugins.Cfg) {
+	c := struct {
+		Firewall firewallConfig `json:"firewall"`
+	}{}
+	if err := cfg.Unmarshal(&c); err != nil {
+		log.Traceln("读取firewall配置失败", err.Error())
+	}
+	fw, err := newFirewall(&c.Firewall)
+	if err != nil {
+		log.Errorln("firewall配置错误", err.Error())
+		return
+	}
+	f.lock.Lock()
+	f.fw = fw
+	f.lock.Unlock()
+}
+
+//get 获取当前生效的防火墙
+func (f *firewalls) get() *firewall {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.fw
+}
+
+//newFirewall 解析配置
+func newFirewall(c *firewallConfig) (*firewall, error) {
+	fw := &firewall{
+		country: c.CountryHeader,
+	}
+	var err error
+	if fw.proxies, err = parseCIDRs(c.TrustedProxies); err != nil {
+		return nil, err
+	}
+	if fw.gate, err = newACL(&c.aclConfig); err != nil {
+		return nil, err
+	}
+	for _, route := range c.Routes {
+		a, err := newACL(&route.aclConfig)
+		if err != nil {
+			return nil, err
+		}
+		fw.routes = append(fw.routes, &routeACL{acl: a, prefix: route.Prefix})
+	}
+	for _, rule := range c.Rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		fw.rules = append(fw.rules, &wafRule{ruleConfig: rule, re: re})
+	}
+	return fw, nil
+}
+
+//newACL 解析访问控制
+func newACL(c *aclConfig) (*acl, error) {
+	a := &acl{
+		allowCountries: upper(c.AllowCountries),
+		denyCountries:  upper(c.DenyCountries),
+		maxBodySize:    c.MaxBodySize,
+	}
+	var err error
+	if a.allow, err = parseCIDRs(c.Allow); err != nil {
+		return nil, err
+	}
+	if a.deny, err = parseCIDRs(c.Deny); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+//check 检查ip以及国家 返回拒绝原因
+func (a *acl) check(ip net.IP, country string) string {
+	if containsIP(a.deny, ip) {
+		return "ip拒绝访问"
+	}
+	if len(a.allow) > 0 && !containsIP(a.allow, ip) {
+		return "ip不在允许列表"
+	}
+	if country == "" {
+		return ""
+	}
+	for _, deny := range a.denyCountries {
+		if deny == country {
+			return "地区拒绝访问"
+		}
+	}
+	if len(a.allowCountries) <= 0 {
+		return ""
+	}
+	for _, allow := range a.allowCountries {
+		if allow == country {
+			return ""
+		}
+	}
+	return "地区不在允许列表"
+}
+
+//route 最长匹配的url前缀的访问控制
+func (f *firewall) route(path string) *acl {
+	var route *routeACL
+	for _, r := range f.routes {
+		if strings.HasPrefix(path, r.prefix) && (route == nil || len(r.prefix) > len(route.prefix)) {
+			route = r
+		}
+	}
+	if route == nil {
+		return nil
+	}
+	return route.acl
+}
+
+//clientIP 获取客户端ip 对端为可信代理时从右向左取X-Forwarded-For中第一个不可信的地址
+//返回客户端ip以及对端是否为可信代理
+func (f *firewall) clientIP(remote string, forwarded []string, realIP string) (string, bool) {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(remote))
+	if err != nil {
+		host = remote
+	}
+	if !containsIP(f.proxies, net.ParseIP(host)) {
+		return host, false
+	}
+	list := strings.Split(strings.Join(forwarded, ","), ",")
+	for i := len(list) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(list[i]))
+		if ip == nil {
+			break
+		}
+		if !containsIP(f.proxies, ip) {
+			return ip.String(), true
+		}
+	}
+	if ip := net.ParseIP(strings.TrimSpace(realIP)); ip != nil {
+		return ip.String(), true
+	}
+	return host, true
+}
+
+//access 检查ip 国家以及url前缀的访问控制 返回请求内容大小限制
+func (f *firewall) access(ip, country, path string) (int64, string, *customerror.Error) {
+	addr := net.ParseIP(ip)
+	if reason := f.gate.check(addr, country); reason != "" {
+		return 0, "acl", customerror.EnCodeError(customerror.Forbidden, reason)
+	}
+	limit := f.gate.maxBodySize
+	if route := f.route(path); route != nil {
+		if reason := route.check(addr, country); reason != "" {
+			return 0, "route", customerror.EnCodeError(customerror.Forbidden, reason)
+		}
+		if route.maxBodySize > 0 {
+			limit = route.maxBodySize
+		}
+	}
+	return limit, "", nil
+}
+
+//wafRequest 规则检查的请求 http以及gRPC共用
+type wafRequest struct {
+	method string
+	path   string
+	query  string
+	header func(key string) []string
+	body   func() string
+}
+
+//match 匹配拦截规则 返回匹配的规则名称
+func (f *firewall) match(r *wafRequest) string {
+	for _, rule := range f.rules {
+		if rule.Prefix != "" && !strings.HasPrefix(r.path, rule.Prefix) {
+			continue
+		}
+		if rule.Method != "" && !strings.EqualFold(rule.Method, r.method) {
+			continue
+		}
+		var value string
+		switch rule.Target {
+		case "path":
+			value = r.path
+		case "query":
+			value = r.query
+		case "header":
+			value = strings.Join(r.header(rule.Key), ",")
+		case "user_agent":
+			value = strings.Join(r.header("User-Agent"), ",")
+		case "body":
+			value = r.body()
+		}
+		if rule.re.MatchString(value) {
+			return rule.Name
+		}
+	}
+	return ""
+}
+
+//firewall 防火墙中间件 解析可信代理后的客户端ip 按ip 国家 请求大小以及规则拦截请求
+//配置了可信代理时解析后的客户端ip写入RemoteAddr以及X-Forwarded-For c.ClientIP()返回的就是真实的客户端ip
+//没有配置可信代理时访问控制使用对端地址 c.ClientIP()保持原来的行为
+func (g *Gateway) firewall(c *gin.Context) {
+	fw := g.firewalls.get()
+	if fw == nil {
+		c.Next()
+		return
+	}
+	ip, trusted := fw.clientIP(c.Request.RemoteAddr, c.Request.Header.Values("X-Forwarded-For"), c.Request.Header.Get("X-Real-Ip"))
+	if len(fw.proxies) > 0 {
+		_, port, _ := net.SplitHostPort(c.Request.RemoteAddr)
+		c.Request.RemoteAddr = net.JoinHostPort(ip, port)
+		c.Request.Header.Set("X-Forwarded-For", ip)
+		c.Request.Header.Del("X-Real-Ip")
+	}
+	country := ""
+	if trusted && fw.country != "" {
+		country = strings.ToUpper(strings.TrimSpace(c.Request.Header.Get(fw.country)))
+	}
+	path := c.Request.URL.Path
+	limit, rule, err := fw.access(ip, country, path)
+	if err != nil {
+		g.block(c, ip, rule, err)
+		return
+	}
+	if limit > 0 {
+		if c.Request.ContentLength > limit {
+			g.block(c, ip, "size", customerror.EnCodeError(customerror.RequestTooLarge, "请求内容超过限制"))
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	}
+	query := c.Request.URL.RawQuery
+	if unescaped, err := url.QueryUnescape(query); err == nil {
+		query = unescaped
+	}
+	rule = fw.match(&wafRequest{
+		method: c.Request.Method,
+		path:   path,
+		query:  query,
+		header: c.Request.Header.Values,
+		body: func() string {
+			if c.Request.Body == nil {
+				return ""
+			}
+			//读取前面的内容后放回
+			buff, _ := ioutil.ReadAll(io.LimitReader(c.Request.Body, wafBodySize))
+			c.Request.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(buff), c.Request.Body), c.Request.Body}
+			return string(buff)
+		},
+	})
+	if rule != "" {
+		g.block(c, ip, rule, customerror.EnCodeError(customerror.Forbidden, "请求被拦截"))
+		return
+	}
+	c.Next()
+}
+
+//block 拦截请求
+func (g *Gateway) block(c *gin.Context, ip, rule string, err *customerror.Error) {
+	g.blocked(ip, c.Request.URL.Path, rule, err)
+	g.fail(c, err)
+	c.Abort()
+}
+
+//blocked 记录拦截的请求
+func (g *Gateway) blocked(ip, path, rule string, err *customerror.Error) {
+	log.Tracef("防火墙拦截 | %s | %s | %s | %s ", ip, path, rule, err.Msg)
+	metrics.MetricFirewallBlockCount(g.name, path, rule)
+}
+
+//parseCIDRs 解析ip或者CIDR列表
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+//containsIP ip是否在列表中
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//upper 转换为大写
+func upper(list []string) []string {
+	result := make([]string, 0, len(list))
+	for _, item := range list {
+		result = append(result, strings.ToUpper(strings.TrimSpace(item)))
+	}
+	return result
+}
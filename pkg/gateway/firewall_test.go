@@ -0,0 +1,230 @@
+package gateway
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	customerror "github.com/tang-go/go-dog/error"
+)
+
+//mustFirewall 解析防火墙配置
+func mustFirewall(t *testing.T, c *firewallConfig) *firewall {
+	fw, err := newFirewall(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fw
+}
+
+func TestParseCIDRs(t *testing.T) {
+	tests := []struct {
+		name  string
+		list  []string
+		ip    string
+		match bool
+		ok    bool
+	}{
+		{"ipv4", []string{"10.0.0.1"}, "10.0.0.1", true, true},
+		{"ipv4 only host", []string{"10.0.0.1"}, "10.0.0.2", false, true},
+		{"cidr", []string{"10.0.0.0/8"}, "10.1.2.3", true, true},
+		{"cidr outside", []string{"10.0.0.0/8"}, "11.0.0.1", false, true},
+		{"ipv6", []string{"::1"}, "::1", true, true},
+		{"ipv6 cidr", []string{"fd00::/8"}, "fd12::1", true, true},
+		{"spaces", []string{" 192.168.0.0/16 "}, "192.168.1.1", true, true},
+		{"invalid", []string{"10.0.0.300"}, "", false, false},
+		{"invalid cidr", []string{"10.0.0.0/33"}, "", false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nets, err := parseCIDRs(test.list)
+			if (err == nil) != test.ok {
+				t.Fatalf("parseCIDRs err=%v want ok=%t", err, test.ok)
+			}
+			if test.ok && containsIP(nets, net.ParseIP(test.ip)) != test.match {
+				t.Fatalf("containsIP(%s) want %t", test.ip, test.match)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	fw := mustFirewall(t, &firewallConfig{TrustedProxies: []string{"10.0.0.0/8", "::1"}})
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		realIP    string
+		ip        string
+		trusted   bool
+	}{
+		{"direct", "1.2.3.4:5000", nil, "", "1.2.3.4", false},
+		{"spoofed from untrusted peer", "1.2.3.4:5000", []string{"9.9.9.9"}, "8.8.8.8", "1.2.3.4", false},
+		{"trusted proxy", "10.0.0.1:5000", []string{"1.2.3.4"}, "", "1.2.3.4", true},
+		{"spoofed leftmost", "10.0.0.1:5000", []string{"9.9.9.9, 1.2.3.4"}, "", "1.2.3.4", true},
+		{"proxy chain", "10.0.0.1:5000", []string{"9.9.9.9, 1.2.3.4, 10.0.0.2"}, "", "1.2.3.4", true},
+		{"multiple headers", "10.0.0.1:5000", []string{"9.9.9.9", "1.2.3.4"}, "", "1.2.3.4", true},
+		{"garbage stops", "10.0.0.1:5000", []string{"1.2.3.4, garbage"}, "", "10.0.0.1", true},
+		{"all trusted", "10.0.0.1:5000", []string{"10.0.0.3"}, "", "10.0.0.1", true},
+		{"real ip", "10.0.0.1:5000", nil, "1.2.3.4", "1.2.3.4", true},
+		{"ipv6 proxy", "[::1]:5000", []string{"2001:db8::1"}, "", "2001:db8::1", true},
+		{"no port", "1.2.3.4", []string{"9.9.9.9"}, "", "1.2.3.4", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ip, trusted := fw.clientIP(test.remote, test.forwarded, test.realIP)
+			if ip != test.ip || trusted != test.trusted {
+				t.Fatalf("clientIP = %s, %t want %s, %t", ip, trusted, test.ip, test.trusted)
+			}
+		})
+	}
+	//没有可信代理时不使用X-Forwarded-For
+	fw = mustFirewall(t, &firewallConfig{})
+	if ip, trusted := fw.clientIP("1.2.3.4:5000", []string{"9.9.9.9"}, "9.9.9.9"); ip != "1.2.3.4" || trusted {
+		t.Fatalf("clientIP without proxies = %s, %t", ip, trusted)
+	}
+}
+
+func TestAccess(t *testing.T) {
+	c := &firewallConfig{
+		aclConfig: aclConfig{
+			Deny:          []string{"6.6.6.0/24"},
+			DenyCountries: []string{"xx"},
+			MaxBodySize:   100,
+		},
+		Routes: []*routeConfig{
+			{Prefix: "/api/admin", aclConfig: aclConfig{Allow: []string{"10.0.0.0/8"}}},
+			{Prefix: "/api/admin/upload", aclConfig: aclConfig{Allow: []string{"10.0.0.0/8"}, MaxBodySize: 1000}},
+			{Prefix: "/api/cn", aclConfig: aclConfig{AllowCountries: []string{"CN"}}},
+		},
+	}
+	fw := mustFirewall(t, c)
+	tests := []struct {
+		name    string
+		ip      string
+		country string
+		path    string
+		limit   int64
+		rule    string
+	}{
+		{"allowed", "1.2.3.4", "", "/api/user", 100, ""},
+		{"denied ip", "6.6.6.6", "", "/api/user", 0, "acl"},
+		{"denied country", "1.2.3.4", "XX", "/api/user", 0, "acl"},
+		{"route allow", "10.1.1.1", "", "/api/admin/user", 100, ""},
+		{"route not allowed", "1.2.3.4", "", "/api/admin/user", 0, "route"},
+		{"longest prefix limit", "10.1.1.1", "", "/api/admin/upload/file", 1000, ""},
+		{"allow country", "1.2.3.4", "CN", "/api/cn/news", 100, ""},
+		{"other country", "1.2.3.4", "US", "/api/cn/news", 0, "route"},
+		{"unknown country", "1.2.3.4", "", "/api/cn/news", 100, ""},
+		{"invalid ip", "", "", "/api/admin/user", 0, "route"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limit, rule, err := fw.access(test.ip, test.country, test.path)
+			if rule != test.rule || (err == nil) != (test.rule == "") {
+				t.Fatalf("access = %s, %v want %s", rule, err, test.rule)
+			}
+			if err == nil && limit != test.limit {
+				t.Fatalf("limit = %d want %d", limit, test.limit)
+			}
+			if err != nil && err.Code != customerror.Forbidden {
+				t.Fatalf("code = %d want %d", err.Code, customerror.Forbidden)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	fw := mustFirewall(t, &firewallConfig{Rules: []*ruleConfig{
+		{Name: "sqli", Target: "query", Pattern: `(?i)union\s+select`},
+		{Name: "traversal", Target: "path", Pattern: `\.\./`},
+		{Name: "scanner", Target: "user_agent", Pattern: `(?i)sqlmap`},
+		{Name: "debug", Target: "header", Key: "X-Debug", Pattern: `.+`},
+		{Name: "script", Target: "body", Method: "POST", Prefix: "/api/post", Pattern: `<script`},
+	}})
+	request := func(method, path, query string, header http.Header, body string) *wafRequest {
+		return &wafRequest{
+			method: method,
+			path:   path,
+			query:  query,
+			header: header.Values,
+			body:   func() string { return body },
+		}
+	}
+	tests := []struct {
+		name string
+		r    *wafRequest
+		rule string
+	}{
+		{"clean", request("GET", "/api/user", "id=1", nil, ""), ""},
+		{"query", request("GET", "/api/user", "id=1 UNION  SELECT 1", nil, ""), "sqli"},
+		{"path", request("GET", "/api/../etc/passwd", "", nil, ""), "traversal"},
+		{"user agent", request("GET", "/api/user", "", http.Header{"User-Agent": {"sqlmap/1.0"}}, ""), "scanner"},
+		{"header", request("GET", "/api/user", "", http.Header{"X-Debug": {"1"}}, ""), "debug"},
+		{"body", request("POST", "/api/post/1", "", nil, "<script>"), "script"},
+		{"body other method", request("PUT", "/api/post/1", "", nil, "<script>"), ""},
+		{"body other prefix", request("POST", "/api/user", "", nil, "<script>"), ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if rule := fw.match(test.r); rule != test.rule {
+				t.Fatalf("match = %q want %q", rule, test.rule)
+			}
+		})
+	}
+}
+
+func TestFirewallClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		remote  string
+		xff     string
+		want    string
+	}{
+		//没有配置可信代理时保持gin的默认行为
+		{"no proxies", nil, "1.2.3.4:5000", "9.9.9.9", "9.9.9.9"},
+		{"trusted proxy", []string{"10.0.0.0/8"}, "10.0.0.1:5000", "9.9.9.9, 1.2.3.4", "1.2.3.4"},
+		{"spoofed", []string{"10.0.0.0/8"}, "1.2.3.4:5000", "9.9.9.9", "1.2.3.4"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := &Gateway{firewalls: &firewalls{fw: mustFirewall(t, &firewallConfig{TrustedProxies: test.proxies})}}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/api/user", nil)
+			c.Request.RemoteAddr = test.remote
+			c.Request.Header.Set("X-Forwarded-For", test.xff)
+			g.firewall(c)
+			if ip := c.ClientIP(); ip != test.want {
+				t.Fatalf("ClientIP = %s want %s", ip, test.want)
+			}
+		})
+	}
+}
+
+func TestBodyError(t *testing.T) {
+	body := http.MaxBytesReader(httptest.NewRecorder(), ioutil.NopCloser(strings.NewReader(strings.Repeat("a", 10))), 5)
+	_, err := ioutil.ReadAll(body)
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"too large", err, customerror.RequestTooLarge},
+		{"wrapped too large", readError(5, err), customerror.RequestTooLarge},
+		{"custom", customerror.EnCodeError(customerror.Forbidden, "x"), customerror.Forbidden},
+		{"other", errors.New("unexpected EOF"), customerror.ParamError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if code := bodyError(test.err).Code; code != test.code {
+				t.Fatalf("bodyError(%v) = %d want %d", test.err, code, test.code)
+			}
+		})
+	}
+}
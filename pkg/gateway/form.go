@@ -0,0 +1,182 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/pkg/schema"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+//uploadChunk 上传文件的分片大小
+const uploadChunk = 32 * 1024
+
+//readBody 读取请求内容并限制大小 表单内容按结构描述转换为json
+//包含上传文件时文件内容分片发送到服务 返回用于发送请求的plugins.Upload
+func (g *Gateway) readBody(c *gin.Context, ctx plugins.Context, apiservice *serviceinfo.ServcieAPI) ([]byte, plugins.Upload, error) {
+	request := apiservice.Method.Request
+	limit := g.cfg.GetMaxUploadSize()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	contentType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	switch contentType {
+	case "application/x-www-form-urlencoded":
+		if err := c.Request.ParseForm(); err != nil {
+			return nil, nil, readError(limit, err)
+		}
+		p, errs := values(request, func(key string) []string {
+			return c.Request.PostForm[key]
+		})
+		if len(errs) > 0 {
+			return nil, nil, errs
+		}
+		body, err := json.Marshal(p)
+		return body, nil, err
+	case "multipart/form-data":
+		return g.multipart(c, ctx, apiservice, limit)
+	default:
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			return nil, nil, readError(limit, err)
+		}
+		return body, nil, nil
+	}
+}
+
+//bodyError 读取请求内容的错误 没有错误码时按参数错误处理
+func bodyError(err error) *customerror.Error {
+	if e, ok := err.(*customerror.Error); ok {
+		return e
+	}
+	if tooLarge(err) {
+		return customerror.EnCodeError(customerror.RequestTooLarge, "请求内容超过限制")
+	}
+	return customerror.EnCodeError(customerror.ParamError, err.Error())
+}
+
+//readError 读取请求内容失败 超过http.MaxBytesReader的限制时返回RequestTooLarge
+func readError(limit int64, err error) error {
+	if tooLarge(err) {
+		return customerror.EnCodeError(customerror.RequestTooLarge, "请求内容超过限制")
+	}
+	return fmt.Errorf("请求内容读取失败或者超过%d字节:%s", limit, err.Error())
+}
+
+//tooLarge 是否为http.MaxBytesReader超过限制的错误 防火墙以及max_upload_size都使用MaxBytesReader
+func tooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "http: request body too large")
+}
+
+//multipart 逐个读取multipart/form-data的内容 文件分片流式发送到服务 请求中的文件转换为plugins.FormFile
+//表单字段在内存中读取 单个文件以及字段按max_file_size限制大小
+func (g *Gateway) multipart(c *gin.Context, ctx plugins.Context, apiservice *serviceinfo.ServcieAPI, limit int64) (body []byte, upload plugins.Upload, err error) {
+	request := apiservice.Method.Request
+	fileLimit := g.cfg.GetMaxFileSize()
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil && upload != nil {
+			upload.Cancel()
+			upload = nil
+		}
+	}()
+	form := make(url.Values)
+	files := make(map[string][]*plugins.FormFile)
+	for index := 0; ; {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, upload, readError(limit, err)
+		}
+		if part.FileName() == "" {
+			data, err := ioutil.ReadAll(io.LimitReader(part, fileLimit+1))
+			part.Close()
+			if err != nil {
+				return nil, upload, readError(limit, err)
+			}
+			if int64(len(data)) > fileLimit {
+				return nil, upload, customerror.EnCodeError(customerror.RequestTooLarge, fmt.Sprintf("%s超过%d字节", part.FormName(), fileLimit))
+			}
+			form.Add(part.FormName(), string(data))
+			continue
+		}
+		if upload == nil {
+			if upload, err = g.GetClient().Upload(ctx, plugins.RandomMode, apiservice.Name, "", apiservice.Method.Name); err != nil {
+				return nil, nil, err
+			}
+		}
+		size, err := chunks(upload, index, part, fileLimit)
+		part.Close()
+		if err != nil {
+			if e, ok := err.(*customerror.Error); ok && e.Code == customerror.RequestTooLarge {
+				return nil, upload, customerror.EnCodeError(customerror.RequestTooLarge, fmt.Sprintf("%s超过%d字节", part.FormName(), fileLimit))
+			}
+			return nil, upload, readError(limit, err)
+		}
+		files[part.FormName()] = append(files[part.FormName()], &plugins.FormFile{
+			Filename:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+			Size:        size,
+			Part:        index,
+		})
+		index++
+	}
+	p, errs := values(request, func(key string) []string {
+		return form[key]
+	})
+	if len(errs) > 0 {
+		return nil, upload, errs
+	}
+	if object := schema.Resolve(request, request); object != nil {
+		for name, fs := range files {
+			property := schema.Resolve(request, object.Properties[name])
+			if property == nil {
+				continue
+			}
+			if property.Type == "array" {
+				p[name] = fs
+			} else {
+				p[name] = fs[0]
+			}
+		}
+	}
+	body, err = json.Marshal(p)
+	return body, upload, err
+}
+
+//chunks 按uploadChunk分片发送文件内容 返回文件大小 空文件也发送一个分片
+func chunks(upload plugins.Upload, index int, reader io.Reader, limit int64) (int64, error) {
+	buff := make([]byte, uploadChunk)
+	var size int64
+	for {
+		n, err := io.ReadFull(reader, buff)
+		size += int64(n)
+		if size > limit {
+			return size, customerror.EnCodeError(customerror.RequestTooLarge, "文件超过限制")
+		}
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return size, err
+		}
+		if n > 0 || size == 0 {
+			if err := upload.Write(index, buff[:n]); err != nil {
+				return size, err
+			}
+		}
+		if eof {
+			return size, nil
+		}
+	}
+}
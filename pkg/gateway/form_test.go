@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	customerror "github.com/tang-go/go-dog/error"
+)
+
+//recordUpload 记录发送的分片
+type recordUpload struct {
+	chunks [][]byte
+}
+
+func (u *recordUpload) Write(part int, data []byte) error {
+	u.chunks = append(u.chunks, append([]byte(nil), data...))
+	return nil
+}
+
+func (u *recordUpload) Send(code string, args []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (u *recordUpload) Cancel() {}
+
+func TestChunks(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		limit  int64
+		chunks int
+		ok     bool
+	}{
+		{"empty", 0, 10, 1, true},
+		{"small", 10, 10, 1, true},
+		{"exact chunk", uploadChunk, uploadChunk, 1, true},
+		{"multiple chunks", uploadChunk*2 + 1, uploadChunk * 3, 3, true},
+		{"too large", 11, 10, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := strings.Repeat("a", test.size)
+			upload := new(recordUpload)
+			size, err := chunks(upload, 0, strings.NewReader(data), test.limit)
+			if !test.ok {
+				if e, ok := err.(*customerror.Error); !ok || e.Code != customerror.RequestTooLarge {
+					t.Fatalf("chunks err=%v want RequestTooLarge", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != int64(test.size) || len(upload.chunks) != test.chunks {
+				t.Fatalf("chunks = %d bytes %d chunks want %d bytes %d chunks", size, len(upload.chunks), test.size, test.chunks)
+			}
+			if !bytes.Equal(bytes.Join(upload.chunks, nil), []byte(data)) {
+				t.Fatal("chunks content mismatch")
+			}
+		})
+	}
+}
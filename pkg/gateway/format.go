@@ -0,0 +1,138 @@
+package gateway
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/plugins"
+)
+
+//defaultStatus 默认错误码对应的http状态码 旧版响应格式不使用
+var defaultStatus = map[int]int{
+	customerror.ConnectClose:        http.StatusBadGateway,
+	customerror.Unauthorized:        http.StatusUnauthorized,
+	customerror.Forbidden:           http.StatusForbidden,
+	customerror.RPCNotFind:          http.StatusNotFound,
+	customerror.RequestTimeout:      http.StatusGatewayTimeout,
+	customerror.RequestTooLarge:     http.StatusRequestEntityTooLarge,
+	customerror.InternalServerError: http.StatusInternalServerError,
+	customerror.UnknownError:        http.StatusInternalServerError,
+	customerror.ClientLimitError:    http.StatusTooManyRequests,
+	customerror.SeviceLimitError:    http.StatusServiceUnavailable,
+	customerror.ParamError:          http.StatusBadRequest,
+}
+
+//LegacyFormatter 旧版响应格式 成功返回{"code":10000,"body":...,"time":...} 失败返回customerror.Error
+type LegacyFormatter struct{}
+
+//Success 格式化成功响应
+func (f *LegacyFormatter) Success(c *gin.Context, body interface{}) (int, interface{}) {
+	return http.StatusOK, gin.H{
+		"code": 10000,
+		"body": body,
+		"time": time.Now().Unix(),
+	}
+}
+
+//Error 格式化错误响应
+func (f *LegacyFormatter) Error(c *gin.Context, status int, err *customerror.Error) (int, interface{}) {
+	return status, err
+}
+
+//RESTFormatter REST响应格式 成功直接返回响应内容 失败返回customerror.Error
+type RESTFormatter struct{}
+
+//Success 格式化成功响应
+func (f *RESTFormatter) Success(c *gin.Context, body interface{}) (int, interface{}) {
+	return http.StatusOK, body
+}
+
+//Error 格式化错误响应
+func (f *RESTFormatter) Error(c *gin.Context, status int, err *customerror.Error) (int, interface{}) {
+	return status, err
+}
+
+//statusMapping 错误码与http状态码映射
+type statusMapping struct {
+	//代码设置的映射
+	data map[int]int
+	//配置文件的映射 配置变化时整体替换
+	cfg  map[int]int
+	lock sync.RWMutex
+}
+
+func newStatusMapping() *statusMapping {
+	return &statusMapping{
+		data: make(map[int]int),
+		cfg:  make(map[int]int),
+	}
+}
+
+//Formatter 设置响应格式
+func (g *Gateway) Formatter(f plugins.Formatter) {
+	g.formatter = f
+}
+
+//StatusMapping 设置错误码对应的http状态码
+func (g *Gateway) StatusMapping(code int, status int) {
+	g.status.lock.Lock()
+	g.status.data[code] = status
+	g.status.lock.Unlock()
+}
+
+//loadStatusMapping 加载配置中的错误码映射 配置中删除的映射不再生效
+func (g *Gateway) loadStatusMapping() {
+	mapping := make(map[int]int)
+	for code, status := range g.cfg.GetStatusMapping() {
+		mapping[code] = status
+	}
+	g.status.lock.Lock()
+	g.status.cfg = mapping
+	g.status.lock.Unlock()
+}
+
+//httpStatus 获取错误码对应的http状态码 优先使用配置以及代码设置的映射
+//旧版响应格式保持原来的状态码:网关的参数错误返回508 路由不存在返回404 服务返回的错误以及其他错误返回200
+//其他响应格式使用默认映射 未配置时400-599的错误码直接使用,其他业务错误码返回200
+func (g *Gateway) httpStatus(code int, remote bool) int {
+	g.status.lock.RLock()
+	status, ok := g.status.cfg[code]
+	if !ok {
+		status, ok = g.status.data[code]
+	}
+	g.status.lock.RUnlock()
+	if ok {
+		return status
+	}
+	if _, legacy := g.formatter.(*LegacyFormatter); legacy {
+		if !remote && (code == customerror.ParamError || code == customerror.RPCNotFind) {
+			return code
+		}
+		return http.StatusOK
+	}
+	if status, ok := defaultStatus[code]; ok {
+		return status
+	}
+	if code >= http.StatusBadRequest && code < 600 {
+		return code
+	}
+	return http.StatusOK
+}
+
+//success 返回成功响应
+func (g *Gateway) success(c *gin.Context, body interface{}) {
+	c.JSON(g.formatter.Success(c, body))
+}
+
+//fail 返回网关产生的错误响应
+func (g *Gateway) fail(c *gin.Context, err *customerror.Error) {
+	c.JSON(g.formatter.Error(c, g.httpStatus(err.Code, false), err))
+}
+
+//failRPC 返回调用服务的错误响应
+func (g *Gateway) failRPC(c *gin.Context, err *customerror.Error) {
+	c.JSON(g.formatter.Error(c, g.httpStatus(err.Code, true), err))
+}
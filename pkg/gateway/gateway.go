@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"os"
 	"os/signal"
@@ -20,42 +19,77 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/swaggo/gin-swagger/swaggerFiles"
+	"github.com/tang-go/go-dog/cache"
 	customerror "github.com/tang-go/go-dog/error"
 	"github.com/tang-go/go-dog/jaeger"
+	"github.com/tang-go/go-dog/lib/uuid"
 	"github.com/tang-go/go-dog/log"
 	"github.com/tang-go/go-dog/metrics"
 	"github.com/tang-go/go-dog/pkg/client"
 	"github.com/tang-go/go-dog/pkg/config"
 	"github.com/tang-go/go-dog/pkg/context"
+	"github.com/tang-go/go-dog/pkg/cors"
 	consulDiscovery "github.com/tang-go/go-dog/pkg/discovery/consul"
 	nacosDiscovery "github.com/tang-go/go-dog/pkg/discovery/nacos"
+	"github.com/tang-go/go-dog/pkg/mask"
+	"github.com/tang-go/go-dog/pkg/mtls"
 	consulRegister "github.com/tang-go/go-dog/pkg/register/consul"
 	nacosRegister "github.com/tang-go/go-dog/pkg/register/nacos"
+	"github.com/tang-go/go-dog/pkg/schema"
+	"github.com/tang-go/go-dog/pkg/service"
 	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/recover"
 	"github.com/tang-go/go-dog/serviceinfo"
+	"google.golang.org/grpc"
 )
 
 //Gateway 服务发现
 type Gateway struct {
-	listenAPI             sync.Map
-	name                  string
-	client                plugins.Client
-	cfg                   plugins.Cfg
-	jaeger                *jaeger.Jaeger
-	customGet             map[string]func(c *gin.Context)
-	customPost            map[string]func(c *gin.Context)
-	customDelete          map[string]func(c *gin.Context)
-	customPut             map[string]func(c *gin.Context)
-	customAny             map[string]func(c *gin.Context)
-	swaggerAuthCheck      func(token string) error
-	authfunc              func(ctx plugins.Context, token, url string) error
-	getRequestIntercept   func(c plugins.Context, url string, request []byte) ([]byte, bool, error)
-	getResponseIntercept  func(c plugins.Context, url string, request []byte, response []byte)
-	postRequestIntercept  func(c plugins.Context, url string, request []byte) ([]byte, bool, error)
-	postResponseIntercept func(c plugins.Context, url string, request []byte, response []byte)
-	discovery             plugins.Discovery
-	register              plugins.Register
-	metricValue           []*metrics.MetricValue
+	listenAPI        sync.Map
+	name             string
+	client           plugins.Client
+	cfg              plugins.Cfg
+	jaeger           *jaeger.Jaeger
+	customGet        map[string]func(c *gin.Context)
+	customPost       map[string]func(c *gin.Context)
+	customDelete     map[string]func(c *gin.Context)
+	customPut        map[string]func(c *gin.Context)
+	customAny        map[string]func(c *gin.Context)
+	swaggerAuthCheck func(token string) error
+	authfunc         func(ctx plugins.Context, token, url string) error
+	authenticator    plugins.Authenticator
+	middlewares      []*middleware
+	discovery        plugins.Discovery
+	register         plugins.Register
+	metricValue      []*metrics.MetricValue
+	mirrors          *mirrors
+	formatter        plugins.Formatter
+	status           *statusMapping
+	wsPath           string
+	ws               *wsHub
+	rpc              *service.Service
+	rpcOnce          sync.Once
+	rpcAllow         []string
+	grpcEnable       bool
+	grpcPort         int
+	grpcServer       *grpc.Server
+	grpcs            *grpcRegistry
+	store            cacheStore
+	cacheOnce        sync.Once
+	refreshing       sync.Map
+	coalesce         bool
+	flights          *flights
+	redisCache       cache.Inter
+	redisOnce        sync.Once
+	keyStore         plugins.KeyStore
+	apiKeys          *apiKeys
+	signRoutes       []string
+	nonce            nonceStore
+	nonceOnce        sync.Once
+	quotas           sync.Map
+	firewalls        *firewalls
+	cors             *cors.CORS
+	masker           *mask.Masker
 }
 
 //NewGateway  新建发现服务
@@ -90,6 +124,34 @@ func NewGateway(name string) *Gateway {
 	gateway.customPut = make(map[string]func(c *gin.Context))
 	gateway.customDelete = make(map[string]func(c *gin.Context))
 	gateway.customAny = make(map[string]func(c *gin.Context))
+	//初始化流量镜像
+	gateway.mirrors = newMirrors()
+	//初始化响应格式
+	gateway.formatter = new(LegacyFormatter)
+	gateway.status = newStatusMapping()
+	gateway.loadStatusMapping()
+	gateway.cfg.Listen(gateway.loadStatusMapping)
+	//初始化websocket连接管理
+	gateway.ws = newWSHub()
+	gateway.grpcs = new(grpcRegistry)
+	//初始化请求合并
+	gateway.flights = newFlights()
+	//初始化API key
+	gateway.apiKeys = new(apiKeys)
+	gateway.apiKeys.load(gateway.cfg)
+	gateway.cfg.Listen(func() {
+		gateway.apiKeys.load(gateway.cfg)
+	})
+	//初始化敏感字段脱敏
+	gateway.masker = mask.NewMasker(gateway.cfg)
+	//初始化跨域策略
+	gateway.cors = cors.NewCORS(gateway.cfg, "GET", "POST", "OPTIONS", "PUT", "DELETE", "PATCH", "HEAD")
+	//初始化防火墙
+	gateway.firewalls = new(firewalls)
+	gateway.firewalls.load(gateway.cfg)
+	gateway.cfg.Listen(func() {
+		gateway.firewalls.load(gateway.cfg)
+	})
 	//初始化链路追踪
 	gateway.jaeger = jaeger.NewJaeger(name, gateway.cfg)
 	return gateway
@@ -105,24 +167,35 @@ func (g *Gateway) SwaggerAuthCheck(swaggerAuthCheck func(token string) error) {
 	g.swaggerAuthCheck = swaggerAuthCheck
 }
 
-//GetRequestIntercept 拦截get请求
+//GetRequestIntercept 拦截get/delete/head请求 已由中间件替代,请使用Use
 func (g *Gateway) GetRequestIntercept(f func(c plugins.Context, url string, request []byte) ([]byte, bool, error)) {
-	g.getRequestIntercept = f
+	g.intercept(&middleware{kinds: queryKinds, legacy: "GetRequest", handle: &intercept{request: f}})
 }
 
-//GetResponseIntercept 拦截get请求响应
+//GetResponseIntercept 拦截get/delete/head请求响应 已由中间件替代,请使用Use
 func (g *Gateway) GetResponseIntercept(f func(c plugins.Context, url string, request []byte, response []byte)) {
-	g.getResponseIntercept = f
+	g.intercept(&middleware{kinds: queryKinds, legacy: "GetResponse", handle: &intercept{response: f}})
 }
 
-//PostRequestIntercept 拦截get请求
+//PostRequestIntercept 拦截post/put/patch请求 已由中间件替代,请使用Use
 func (g *Gateway) PostRequestIntercept(f func(c plugins.Context, url string, request []byte) ([]byte, bool, error)) {
-	g.postRequestIntercept = f
+	g.intercept(&middleware{kinds: bodyKinds, legacy: "PostRequest", handle: &intercept{request: f}})
 }
 
-//PostResponseIntercept 拦截get请求响应
+//PostResponseIntercept 拦截post/put/patch请求响应 已由中间件替代,请使用Use
 func (g *Gateway) PostResponseIntercept(f func(c plugins.Context, url string, request []byte, response []byte)) {
-	g.postResponseIntercept = f
+	g.intercept(&middleware{kinds: bodyKinds, legacy: "PostResponse", handle: &intercept{response: f}})
+}
+
+//intercept 设置旧版拦截器 与之前一样只保留最后设置的
+func (g *Gateway) intercept(m *middleware) {
+	for i, old := range g.middlewares {
+		if old.legacy == m.legacy {
+			g.middlewares[i] = m
+			return
+		}
+	}
+	g.middlewares = append(g.middlewares, m)
 }
 
 //Get 开启自定义get请求
@@ -155,6 +228,11 @@ func (g *Gateway) GetClient() plugins.Client {
 	return g.client
 }
 
+//Masker 获取敏感字段脱敏 中间件记录请求以及响应时使用
+func (g *Gateway) Masker() *mask.Masker {
+	return g.masker
+}
+
 //GetCfg 获取cfg
 func (g *Gateway) GetCfg() plugins.Cfg {
 	return g.cfg
@@ -178,7 +256,12 @@ func (g *Gateway) Run(port int) error {
 	//启动接口
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
-	router.Use(g.cors())
+	router.Use(g.firewall)
+	router.Use(g.cors.Handler())
+	if g.grpcEnable {
+		router.Use(g.grpcWeb)
+		router.GET("/grpc/descriptors.pb", g.grpcDescriptors)
+	}
 	for url, f := range g.customGet {
 		router.GET(url, f)
 	}
@@ -199,14 +282,22 @@ func (g *Gateway) Run(port int) error {
 	}
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	router.GET("/swagger/*any", g.getSwagger)
+	if g.wsPath != "" {
+		router.GET(g.wsPath, g.serveWebSocket)
+	}
+	if g.wsPath != "" {
+		g.rpcOnce.Do(g.runRPC)
+	}
 	api := router.Group("/api")
 	{
 		api.Use(g.metricMiddleware)
 		api.Use(g.logger())
 		api.POST("/*router", g.routerPostAndPutResolution)
 		api.PUT("/*router", g.routerPostAndPutResolution)
+		api.PATCH("/*router", g.routerPostAndPutResolution)
 		api.GET("/*router", g.routerGetAndDeleteResolution)
 		api.DELETE("/*router", g.routerGetAndDeleteResolution)
+		api.HEAD("/*router", g.routerGetAndDeleteResolution)
 	}
 	//监听指定信号
 	c := make(chan os.Signal)
@@ -216,6 +307,9 @@ func (g *Gateway) Run(port int) error {
 	g.register.RegisterHTTPService(context.Background(), &serviceinfo.ServiceInfo{
 		Name:    g.name,
 		Address: g.cfg.GetHost(),
+		Zone:    g.cfg.GetZone(),
+		Version: g.cfg.GetVersion(),
+		Shadow:  g.cfg.GetShadow(),
 		Port:    port,
 		Explain: g.cfg.GetExplain(),
 		Time:    time.Now().Format("2006-01-02 15:04:05"),
@@ -230,7 +324,22 @@ func (g *Gateway) Run(port int) error {
 		}
 		c <- nil
 	}()
+	if g.grpcEnable && g.grpcPort > 0 {
+		go func() {
+			if err := g.runGRPC(); err != nil {
+				log.Errorln(err.Error())
+			}
+		}()
+	}
 	msg := <-c
+	if g.grpcServer != nil {
+		g.grpcServer.GracefulStop()
+	}
+	//阻止之后再启动RPC服务
+	g.rpcOnce.Do(func() {})
+	if g.rpc != nil {
+		g.rpc.Close()
+	}
 	g.client.Close()
 	g.register.Cancellation()
 	metrics.MetricServiceRun(g.name, -1)
@@ -240,19 +349,78 @@ func (g *Gateway) Run(port int) error {
 	return nil
 }
 
+//runRPC 启动网关的RPC服务 用于websocket推送以及缓存失效 开启websocket或者第一次使用缓存时启动
+//配置文件gateway_rpc.allow为允许调用的服务 通过服务调用授权(policy)校验
+func (g *Gateway) runRPC() {
+	c := struct {
+		RPC struct {
+			Allow []string `json:"allow"`
+		} `json:"gateway_rpc"`
+	}{}
+	if err := g.cfg.Unmarshal(&c); err != nil {
+		log.Traceln("读取gateway_rpc配置失败", err.Error())
+	}
+	g.rpcAllow = c.RPC.Allow
+	g.rpc = service.CreateService(g.name, g.cfg, g.discovery).(*service.Service)
+	if len(g.rpcAllow) <= 0 && !g.rpc.GetTLS().Enable() {
+		log.Errorln("网关RPC没有开启mTLS也没有配置gateway_rpc.allow,WebSocket.Push以及Cache.Invalidate会拒绝全部调用")
+	}
+	rpc := func() plugins.RPC {
+		if len(g.rpcAllow) > 0 {
+			return g.rpc.RPC().NoAuth().Allow(g.rpcAllow...)
+		}
+		return g.rpc.RPC().NoAuth()
+	}
+	if g.wsPath != "" {
+		rpc().Class("WebSocket").Method("Push", "推送websocket消息", g.pushMessage)
+	}
+	rpc().Class("Cache").Method("Invalidate", "按标签失效网关响应缓存", g.invalidate)
+	go func() {
+		defer recover.Recover()
+		if err := g.rpc.RunRPC(); err != nil {
+			log.Errorln(err.Error())
+		}
+	}()
+}
+
+//rpcCaller 网关RPC的调用方校验
+//配置了gateway_rpc.allow时已经由服务调用授权按列表校验 没有开启mTLS时列表中需要配置*
+//没有配置时只允许mTLS证书身份为在本网关注册了API的服务调用
+func (g *Gateway) rpcCaller(ctx plugins.Context) error {
+	if len(g.rpcAllow) > 0 {
+		return nil
+	}
+	peer := ctx.GetPeer()
+	if peer == "" {
+		return customerror.EnCodeError(customerror.Forbidden, "网关RPC需要mTLS证书身份或者配置gateway_rpc.allow")
+	}
+	if !g.ownAPI(mtls.ServiceName(peer)) {
+		return customerror.EnCodeError(customerror.Forbidden, "服务"+peer+"没有在网关"+g.name+"注册API")
+	}
+	return nil
+}
+
+//ownAPI 服务是否在本网关注册了API
+func (g *Gateway) ownAPI(name string) bool {
+	for _, service := range g.discovery.GetAPIServiceByName(name) {
+		for _, api := range service.API {
+			if api.Gate == g.name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 //getSwagger 获取swagger
 func (g *Gateway) getSwagger(c *gin.Context) {
-	if c.Param("any") == "/swagger.json" {
-		if g.swaggerAuthCheck != nil {
-			token := c.Query("token")
-			if token == "" {
-				c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, "token不能为空"))
-				return
-			}
-			if err := g.swaggerAuthCheck(token); err != nil {
-				c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, err.Error()))
-				return
-			}
+	if doc := c.Param("any"); doc == "/swagger.json" || doc == "/openapi.json" {
+		if !g.docAuth(c) {
+			return
+		}
+		if doc == "/openapi.json" {
+			c.String(200, g.ReadOpenAPI())
+			return
 		}
 		c.String(200, g.ReadDoc())
 		return
@@ -262,28 +430,57 @@ func (g *Gateway) getSwagger(c *gin.Context) {
 	})(c)
 }
 
-//routerGetAndDeleteResolution get/delete路由解析
+//docAuth 文档权限检测
+func (g *Gateway) docAuth(c *gin.Context) bool {
+	if g.swaggerAuthCheck == nil {
+		return true
+	}
+	token := c.Query("token")
+	if token == "" {
+		g.fail(c, customerror.EnCodeError(customerror.ParamError, "token不能为空"))
+		return false
+	}
+	if err := g.swaggerAuthCheck(token); err != nil {
+		g.fail(c, customerror.EnCodeError(customerror.ParamError, err.Error()))
+		return false
+	}
+	return true
+}
+
+//findAPI 查找get/delete/head路由 没有注册HEAD的路由使用GET路由 SSE路由以GET方式访问
+func (g *Gateway) findAPI(method, url string) (*serviceinfo.ServcieAPI, map[string]string, bool) {
+	apiservice, params, ok := g.discovery.GetAPIByURL(method, url)
+	if !ok && method == http.MethodHead {
+		apiservice, params, ok = g.discovery.GetAPIByURL(http.MethodGet, url)
+	}
+	if !ok && method == http.MethodGet {
+		apiservice, params, ok = g.discovery.GetAPIByURL(string(plugins.SSE), url)
+	}
+	return apiservice, params, ok
+}
+
+//routerGetAndDeleteResolution get/delete/head路由解析
 func (g *Gateway) routerGetAndDeleteResolution(c *gin.Context) {
 	url := "/api" + c.Param("router")
-	apiservice, ok := g.discovery.GetAPIByURL(c.Request.Method + url)
+	apiservice, params, ok := g.findAPI(c.Request.Method, url)
 	if !ok {
-		c.JSON(http.StatusNotFound, customerror.EnCodeError(http.StatusNotFound, "路由URL错误"))
-		return
-	}
-	if c.Request.Method != apiservice.Method.Kind {
-		c.JSON(http.StatusNotFound, customerror.EnCodeError(http.StatusNotFound, "路由Method错误"))
+		g.fail(c, customerror.EnCodeError(http.StatusNotFound, "路由URL错误"))
 		return
 	}
+	stream := apiservice.Method.Kind == string(plugins.SSE)
 	timeoutstr := c.Request.Header.Get("timeOut")
 	if timeoutstr == "" {
 		timeoutstr = "6"
+		if stream {
+			timeoutstr = strconv.Itoa(sseTimeout)
+		}
 	}
 	timeout, err := strconv.Atoi(timeoutstr)
 	if err != nil {
 		timeout = 6
 	}
 	if timeout <= 0 {
-		c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, "timeout必须大于0"))
+		g.fail(c, customerror.EnCodeError(customerror.ParamError, "timeout必须大于0"))
 		return
 	}
 	istest := c.Request.Header.Get("isTest")
@@ -295,45 +492,22 @@ func (g *Gateway) routerGetAndDeleteResolution(c *gin.Context) {
 		isTest = false
 	}
 	traceID := c.Request.Header.Get("traceID")
+	if traceID == "" && stream {
+		//EventSource无法设置请求头
+		traceID = uuid.GetToken()
+	}
 	if traceID == "" {
-		c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, "traceID不能为空"))
+		g.fail(c, customerror.EnCodeError(customerror.ParamError, "traceID不能为空"))
 		return
 	}
-	p := make(map[string]interface{})
-	for key, value := range apiservice.Method.Request {
-		vali, ok := value.(map[string]interface{})
-		if !ok {
-			c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, fmt.Sprintf("传入参数%v类型错误", value)))
-			return
-		}
-		tp, ok2 := vali["type"].(string)
-		if !ok2 {
-			c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, fmt.Sprintf("传入参数%v类型错误", value)))
-			return
-		}
-		required := false
-		re, ok3 := vali["required"]
-		if ok3 && re == "true" {
-			required = true
-		}
-		data := c.Query(key)
-		if data == "" {
-			if required {
-				c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, fmt.Sprintf("参数%s必须传入", key)))
-				return
-			}
-			continue
-		}
-		v, err := transformation(tp, data)
-		if err != nil {
-			c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, err.Error()))
-			return
-		}
-		p[key] = v
+	p, errs := g.query(c, apiservice.Method.Request, params)
+	if len(errs) > 0 {
+		g.fail(c, customerror.EnCodeError(customerror.ParamError, errs.Error()))
+		return
 	}
 	body, err := g.GetClient().GetCodec().EnCode("json", p)
 	if err != nil {
-		c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, err.Error()))
+		g.fail(c, customerror.EnCodeError(customerror.ParamError, err.Error()))
 		return
 	}
 
@@ -346,77 +520,62 @@ func (g *Gateway) routerGetAndDeleteResolution(c *gin.Context) {
 	ctx = context.WithTimeout(ctx, int64(time.Second*time.Duration(timeout)))
 	//开启追踪
 	if span, err := g.jaeger.StartSpan(ctx, url); err == nil {
+		//请求内容脱敏后记录
+		span.LogKV("request", string(g.masker.JSON(body, apiservice.Method.Request)))
 		defer span.Finish()
 	}
+	//API key签名验证
+	signed, signErr := g.signature(c, ctx, url, apiservice.Method, nil)
+	if signErr != nil {
+		g.fail(c, signErr)
+		return
+	}
 	//查看方法是否需要验证权限
-	if apiservice.Method.IsAuth {
+	if apiservice.Method.IsAuth && !signed {
 		token := c.Request.Header.Get("token")
-		if token == "" {
-			c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, "token不能为空"))
-			return
+		if token == "" && stream {
+			token = c.Query("token")
 		}
 		//验证权限
-		if g.authfunc != nil {
-			if err := g.authfunc(ctx, token, url); err != nil {
-				log.Traceln(err.Error())
-				c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, "token不正确"))
-				return
-			}
-		}
-		//设置token
-		ctx.SetToken(token)
-	}
-	//拦截请求
-	if g.getRequestIntercept != nil {
-		if reposne, ok, err := g.getRequestIntercept(ctx, url, body); ok {
-			if err != nil {
-				log.Traceln(err.Error())
-				c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, err.Error()))
-				return
-			}
-			resp := make(map[string]interface{})
-			g.GetClient().GetCodec().DeCode("json", reposne, &resp)
-			c.JSON(http.StatusOK, gin.H{
-				"code": 10000,
-				"body": resp,
-				"time": time.Now().Unix(),
-			})
+		if err := g.authenticate(ctx, token, url, apiservice.Method); err != nil {
+			g.fail(c, err)
 			return
 		}
 	}
-	metrics.MetricRequestBytes(g.name, url, float64(len(body)))
-	back, err := g.GetClient().SendRequest(ctx, plugins.RandomMode, apiservice.Name, "", apiservice.Method.Name, "json", body)
+	if stream {
+		g.sse(c, ctx, apiservice, body)
+		return
+	}
+	e := &plugins.Exchange{Gin: c, Ctx: ctx, URL: url, Service: apiservice.Name, API: apiservice.Method, Params: params, Request: body}
+	//中间件请求阶段
+	chain, err := g.request(g.chain(url, apiservice.Method), e)
 	if err != nil {
-		e := customerror.DeCodeError(err)
-		c.JSON(http.StatusOK, e)
+		g.fail(c, exchangeError(err))
 		return
 	}
-	//拦截返回
-	if g.getResponseIntercept != nil {
-		g.getResponseIntercept(ctx, url, body, back)
+	if !e.Replied() {
+		//流量镜像 缓存命中的请求同样镜像
+		g.mirror(ctx, apiservice, e.Request)
+		//响应缓存
+		if apiservice.Method.Cache != nil && apiservice.Method.Cache.TTL > 0 && !schema.IsFile(apiservice.Method.Response) {
+			g.cached(chain, e, apiservice)
+			return
+		}
+		metrics.MetricRequestBytes(g.name, url, float64(len(e.Request)))
+		if e.Response, e.Error = g.sendRequest(ctx, apiservice, e.Request); e.Error == nil {
+			metrics.MetricResponseBytes(g.name, url, float64(len(e.Response)))
+		}
 	}
-	resp := make(map[string]interface{})
-	g.GetClient().GetCodec().DeCode("json", back, &resp)
-	c.JSON(http.StatusOK, gin.H{
-		"code": 10000,
-		"body": resp,
-		"time": time.Now().Unix(),
-	})
-	metrics.MetricResponseBytes(g.name, url, float64(len(back)))
-	return
+	g.reply(chain, e)
 }
 
 // routerPostAndPutResolution post/put路由解析
 func (g *Gateway) routerPostAndPutResolution(c *gin.Context) {
 	//路由解析
-	url := c.Request.URL.String()
-	apiservice, ok := g.discovery.GetAPIByURL(c.Request.Method + url)
+	url := "/api" + c.Param("router")
+	apiservice, params, ok := g.discovery.GetAPIByURL(c.Request.Method, url)
 	if !ok {
-		c.JSON(http.StatusNotFound, customerror.EnCodeError(http.StatusNotFound, "路由URL错误"))
-		return
-	}
-	if c.Request.Method != apiservice.Method.Kind {
-		c.JSON(http.StatusNotFound, customerror.EnCodeError(http.StatusNotFound, "路由Method错误"))
+		g.fail(c, customerror.EnCodeError(http.StatusNotFound, "路由URL错误"))
 		return
 	}
 	timeoutstr := c.Request.Header.Get("timeOut")
@@ -428,7 +587,7 @@ func (g *Gateway) routerPostAndPutResolution(c *gin.Context) {
 		timeout = 6
 	}
 	if timeout <= 0 {
-		c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, "timeout必须大于0"))
+		g.fail(c, customerror.EnCodeError(customerror.ParamError, "timeout必须大于0"))
 		return
 	}
 	istest := c.Request.Header.Get("isTest")
@@ -441,17 +600,7 @@ func (g *Gateway) routerPostAndPutResolution(c *gin.Context) {
 	}
 	traceID := c.Request.Header.Get("traceID")
 	if traceID == "" {
-		c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, "traceID不能为空"))
-		return
-	}
-
-	body, err := ioutil.ReadAll(c.Request.Body)
-	if err != nil {
-		c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, err.Error()))
-		return
-	}
-	if err := g.validation(body, apiservice.Method.Request); err != nil {
-		c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, err.Error()))
+		g.fail(c, customerror.EnCodeError(customerror.ParamError, "traceID不能为空"))
 		return
 	}
 	ctx := context.Background()
@@ -461,88 +610,178 @@ func (g *Gateway) routerPostAndPutResolution(c *gin.Context) {
 	ctx.SetURL(url)
 	ctx.SetClient(g.GetClient())
 	ctx = context.WithTimeout(ctx, int64(time.Second*time.Duration(timeout)))
+	//API key签名需要计算原始请求内容
+	sign := g.signBody(c)
+	body, upload, err := g.readBody(c, ctx, apiservice)
+	if err != nil {
+		g.fail(c, bodyError(err))
+		return
+	}
+	if upload != nil {
+		//请求没有发送到服务时丢弃已经上传的文件
+		defer upload.Cancel()
+	}
+	body, errs := g.bind(body, apiservice.Method.Request, params)
+	if len(errs) > 0 {
+		g.fail(c, customerror.EnCodeError(customerror.ParamError, errs.Error()))
+		return
+	}
+	if errs := schema.ValidateJSON(apiservice.Method.Request, body); len(errs) > 0 {
+		log.Traceln("参数校验失败", url, errs.Error())
+		g.fail(c, customerror.EnCodeError(customerror.ParamError, errs.Error()))
+		return
+	}
 	//开启追踪
 	if span, err := g.jaeger.StartSpan(ctx, url); err == nil {
+		//请求内容脱敏后记录
+		span.LogKV("request", string(g.masker.JSON(body, apiservice.Method.Request)))
 		defer span.Finish()
 	}
+	//API key签名验证
+	signed, signErr := g.signature(c, ctx, url, apiservice.Method, sign)
+	if signErr != nil {
+		g.fail(c, signErr)
+		return
+	}
 	//查看方法是否需要验证权限
-	if apiservice.Method.IsAuth {
+	if apiservice.Method.IsAuth && !signed {
 		token := c.Request.Header.Get("token")
-		if token == "" {
-			c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, "token不能为空"))
-			return
-		}
 		//验证权限
-		if g.authfunc != nil {
-			if err := g.authfunc(ctx, token, url); err != nil {
-				log.Traceln(err.Error())
-				c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, "token不正确"))
-				return
-			}
-		}
-		//设置token
-		ctx.SetToken(token)
-	}
-	//拦截请求
-	if g.postRequestIntercept != nil {
-		if reposne, ok, err := g.postRequestIntercept(ctx, url, body); ok {
-			if err != nil {
-				log.Traceln(err.Error())
-				c.JSON(customerror.ParamError, customerror.EnCodeError(customerror.ParamError, err.Error()))
-				return
-			}
-			resp := make(map[string]interface{})
-			g.GetClient().GetCodec().DeCode("json", reposne, &resp)
-			c.JSON(http.StatusOK, gin.H{
-				"code": 10000,
-				"body": resp,
-				"time": time.Now().Unix(),
-			})
+		if err := g.authenticate(ctx, token, url, apiservice.Method); err != nil {
+			g.fail(c, err)
 			return
 		}
 	}
-	metrics.MetricRequestBytes(g.name, url, float64(len(body)))
-	back, err := g.GetClient().SendRequest(ctx, plugins.RandomMode, apiservice.Name, "", apiservice.Method.Name, "json", body)
+	e := &plugins.Exchange{Gin: c, Ctx: ctx, URL: url, Service: apiservice.Name, API: apiservice.Method, Params: params, Request: body}
+	//中间件请求阶段
+	chain, err := g.request(g.chain(url, apiservice.Method), e)
 	if err != nil {
-		e := customerror.DeCodeError(err)
-		c.JSON(http.StatusOK, e)
+		g.fail(c, exchangeError(err))
+		return
+	}
+	if !e.Replied() {
+		metrics.MetricRequestBytes(g.name, url, float64(len(e.Request)))
+		if upload != nil {
+			//上传的文件只发送到选中的实例 不做流量镜像
+			e.Response, e.Error = upload.Send("json", e.Request)
+		} else {
+			//流量镜像
+			g.mirror(ctx, apiservice, e.Request)
+			e.Response, e.Error = g.GetClient().SendRequest(ctx, plugins.RandomMode, apiservice.Name, "", apiservice.Method.Name, "json", e.Request)
+		}
+		if e.Error == nil {
+			metrics.MetricResponseBytes(g.name, url, float64(len(e.Response)))
+		}
+	}
+	g.reply(chain, e)
+}
+
+//reply 执行中间件的响应阶段并返回响应
+func (g *Gateway) reply(chain []plugins.Middleware, e *plugins.Exchange) {
+	g.response(chain, e)
+	if e.Error != nil {
+		g.failRPC(e.Gin, customerror.DeCodeError(e.Error))
 		return
 	}
-	//拦截返回
-	if g.postResponseIntercept != nil {
-		g.postResponseIntercept(ctx, url, body, back)
+	if schema.IsFile(e.API.Response) {
+		g.file(e.Gin, e.Response)
+		return
 	}
-	resp := make(map[string]interface{})
-	g.GetClient().GetCodec().DeCode("json", back, &resp)
-	c.JSON(http.StatusOK, gin.H{
-		"code": 10000,
-		"body": resp,
-		"time": time.Now().Unix(),
+	var resp interface{}
+	g.GetClient().GetCodec().DeCode("json", e.Response, &resp)
+	g.success(e.Gin, resp)
+}
+
+//query 按结构描述解析query参数以及路径参数并校验 路径参数优先
+func (g *Gateway) query(c *gin.Context, request *serviceinfo.Schema, params map[string]string) (map[string]interface{}, schema.FieldErrors) {
+	p, errs := values(request, func(key string) []string {
+		if param, ok := params[key]; ok {
+			return []string{param}
+		}
+		return c.QueryArray(key)
 	})
-	metrics.MetricResponseBytes(g.name, url, float64(len(back)))
-	return
+	if len(errs) > 0 {
+		return p, errs
+	}
+	return p, schema.Validate(request, p)
 }
 
-//validation 验证参数
-func (g *Gateway) validation(param []byte, tem map[string]interface{}) error {
+//values 按结构描述转换字符串参数
+func values(request *serviceinfo.Schema, get func(key string) []string) (map[string]interface{}, schema.FieldErrors) {
 	p := make(map[string]interface{})
-	if err := g.GetClient().GetCodec().DeCode("json", param, &p); err != nil {
-		return err
+	object := schema.Resolve(request, request)
+	if object == nil {
+		return p, nil
 	}
-	for key, value := range tem {
-		vali, ok := value.(map[string]interface{})
-		if !ok {
-			return fmt.Errorf("传入参数错误")
+	var errs schema.FieldErrors
+	for key, value := range object.Properties {
+		property := schema.Resolve(request, value)
+		if property == nil {
+			continue
 		}
-		re, ok3 := vali["required"]
-		if ok3 && re == "true" {
-			if _, ok := p[key]; !ok {
-				log.Traceln("模版", tem, "传入参数", p)
-				return fmt.Errorf("不存在值为%s的参数", key)
+		datas := get(key)
+		if len(datas) <= 0 || datas[0] == "" {
+			continue
+		}
+		if property.Type == "array" && property.Items != nil {
+			items := schema.Resolve(request, property.Items)
+			array := make([]interface{}, 0, len(datas))
+			for i, data := range datas {
+				v, err := transformation(items, data)
+				if err != nil {
+					errs = append(errs, &schema.FieldError{Path: fmt.Sprintf("%s[%d]", key, i), Msg: err.Error()})
+					continue
+				}
+				array = append(array, v)
 			}
+			p[key] = array
+			continue
 		}
+		v, err := transformation(property, datas[0])
+		if err != nil {
+			errs = append(errs, &schema.FieldError{Path: key, Msg: err.Error()})
+			continue
+		}
+		p[key] = v
 	}
-	return nil
+	return p, errs
+}
+
+//bind 将路径参数绑定到请求内容 路径参数覆盖请求内容中的同名字段
+func (g *Gateway) bind(body []byte, request *serviceinfo.Schema, params map[string]string) ([]byte, schema.FieldErrors) {
+	object := schema.Resolve(request, request)
+	if len(params) <= 0 || object == nil || object.Type != "object" {
+		return body, nil
+	}
+	p := make(map[string]interface{})
+	if len(bytes.TrimSpace(body)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&p); err != nil {
+			return body, schema.FieldErrors{{Msg: "请求内容不是合法的json:" + err.Error()}}
+		}
+	}
+	var errs schema.FieldErrors
+	for key, param := range params {
+		property := schema.Resolve(request, object.Properties[key])
+		if property == nil {
+			continue
+		}
+		v, err := transformation(property, param)
+		if err != nil {
+			errs = append(errs, &schema.FieldError{Path: key, Msg: err.Error()})
+			continue
+		}
+		p[key] = v
+	}
+	if len(errs) > 0 {
+		return body, errs
+	}
+	buff, err := json.Marshal(p)
+	if err != nil {
+		return body, schema.FieldErrors{{Msg: err.Error()}}
+	}
+	return buff, nil
 }
 
 //logger 自定义日志输出
@@ -570,26 +809,6 @@ func (g *Gateway) logger() gin.HandlerFunc {
 	}
 }
 
-//cors 处理跨域问题
-func (g *Gateway) cors() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		method := c.Request.Method
-
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Headers", "Content-Type,TraceID, IsTest, Token,TimeOut")
-		c.Header("Access-Control-Allow-Methods", "GET,POST,OPTIONS,PUT,DELETE")
-		c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Content-Type")
-		c.Header("Access-Control-Allow-Credentials", "true")
-
-		//放行所有OPTIONS方法
-		if method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-		}
-		// 处理请求
-		c.Next()
-	}
-}
-
 //Docs 文档内容
 type Docs struct {
 	Swagger     string                            `json:"swagger"`
@@ -597,7 +816,7 @@ type Docs struct {
 	Host        string                            `json:"host"`
 	BasePath    string                            `json:"basePath"`
 	Paths       map[string]map[string]interface{} `json:"paths"`
-	Definitions map[string]Definitions            `json:"definitions"`
+	Definitions map[string]*serviceinfo.Schema    `json:"definitions"`
 }
 
 //Info 信息
@@ -613,26 +832,6 @@ type Info struct {
 	Version string `json:"version"`
 }
 
-//Definitions 参数定义
-type Definitions struct {
-	Name       string                 `json:"name"`
-	Type       string                 `json:"type"`
-	Properties map[string]Description `json:"properties"`
-}
-
-//Description 描述
-type Description struct {
-	Description string      `json:"description"`
-	Type        string      `json:"type"`
-	Items       interface{} `json:"items,omitempty"`
-	Ref         string      `json:"$ref,omitempty"`
-}
-
-//Ref 链接
-type Ref struct {
-	Ref string `json:"$ref,omitempty"`
-}
-
 //Body 请求
 type Body struct {
 	Consumes   []string     `json:"consumes"`
@@ -642,139 +841,59 @@ type Body struct {
 	Parameters []Parameters `json:"parameters"`
 	Responses  struct {
 		Code200 struct {
-			Description string `json:"description"`
-			Schema      struct {
-				Type string `json:"type"`
-				Ref  string `json:"$ref,omitempty"`
-			} `json:"schema"`
+			Description string              `json:"description"`
+			Schema      *serviceinfo.Schema `json:"schema"`
 		} `json:"200"`
 	} `json:"responses"`
 }
 
 //Parameters api描述
 type Parameters struct {
-	Type        string `json:"type,omitempty"`
-	Description string `json:"description"`
-	Name        string `json:"name"`
-	In          string `json:"in"`
-	Required    bool   `json:"required"`
-	Schema      struct {
-		Type string `json:"type"`
-		Ref  string `json:"$ref,omitempty"`
-	} `json:"schema"`
+	Type        string              `json:"type,omitempty"`
+	Format      string              `json:"format,omitempty"`
+	Items       *serviceinfo.Schema `json:"items,omitempty"`
+	Enum        []interface{}       `json:"enum,omitempty"`
+	Description string              `json:"description"`
+	Name        string              `json:"name"`
+	In          string              `json:"in"`
+	Required    bool                `json:"required"`
+	Schema      *serviceinfo.Schema `json:"schema,omitempty"`
 }
 
-//t type解析
-func t(tp string) string {
-	switch tp {
-	case "int8":
-		return "integer"
-	case "int":
-		return "integer"
-	case "int32":
-		return "integer"
-	case "int64":
-		return "integer"
-	case "uint8":
-		return "integer"
-	case "uint":
-		return "integer"
-	case "uint32":
-		return "integer"
-	case "uint64":
-		return "integer"
-	case "float":
-		return "number"
-	case "float32":
-		return "number"
-	case "float64":
-		return "number"
-	case "byte":
-		return "string"
-	case "bool":
-		return "boolean"
-	default:
-		return tp
-	}
-}
+//definitionsPrefix swagger2.0结构定义引用前缀
+const definitionsPrefix = "#/definitions/"
 
-//transformation 转换
-func transformation(tp string, value string) (interface{}, error) {
-	switch tp {
-	case "int8":
-		i, e := strconv.ParseInt(value, 10, 8)
-		if e != nil {
-			return nil, fmt.Errorf("需要参数是int8 %s是", e.Error())
-		}
-		return int8(i), nil
-	case "int":
-		return strconv.Atoi(value)
-	case "int32":
-		i, e := strconv.ParseInt(value, 10, 32)
-		if e != nil {
-			return nil, fmt.Errorf("需要参数是int32 %s是", e.Error())
-		}
-		return int32(i), nil
-	case "int64":
-		return strconv.ParseInt(value, 10, 64)
-	case "uint8":
-		i, e := strconv.ParseInt(value, 10, 8)
-		if e != nil {
-			return nil, e
-		}
-		return uint8(i), nil
-	case "uint":
-		i, e := strconv.Atoi(value)
-		if e != nil {
-			return nil, fmt.Errorf("需要参数是uint %s是", e.Error())
+//transformation 按结构描述转换query参数
+func transformation(s *serviceinfo.Schema, value string) (interface{}, error) {
+	switch s.Type {
+	case "integer":
+		bitSize := 64
+		if s.Format == "int32" {
+			bitSize = 32
 		}
-		return uint(i), nil
-	case "uint32":
-		i, e := strconv.ParseInt(value, 10, 32)
+		i, e := strconv.ParseInt(value, 10, bitSize)
 		if e != nil {
-			return nil, fmt.Errorf("需要参数是uint32 %s是", e.Error())
+			return nil, fmt.Errorf("需要参数是%s %s是", s.Format, e.Error())
 		}
-		return uint32(i), nil
-	case "uint64":
-		i, e := strconv.ParseInt(value, 10, 64)
-		if e != nil {
-			return nil, fmt.Errorf("需要参数是uint64 %s是", e.Error())
-		}
-		return uint64(i), nil
-	case "float32":
-		return strconv.ParseFloat(value, 32)
-	case "float64":
+		return i, nil
+	case "number":
 		return strconv.ParseFloat(value, 64)
-	case "bool":
+	case "boolean":
 		return strconv.ParseBool(value)
 	case "string":
 		return value, nil
 	default:
-		return tp, fmt.Errorf("暂时不支持此类型参数%s", tp)
+		var v interface{}
+		if err := json.Unmarshal([]byte(value), &v); err != nil {
+			return nil, fmt.Errorf("暂时不支持此类型参数%s", s.Type)
+		}
+		return v, nil
 	}
 }
 
-//createPostAndPutAPI 创建一个POST/PUT API
-func createPostAndPutAPI(kind, tags, summary, name string, isAuth bool, request, respone map[string]interface{}) (a Body, definitions []Definitions) {
-	api := Body{
-		Consumes: []string{"application/json"},
-		Produces: []string{"application/json"},
-		Tags:     []string{tags},
-		Summary:  summary,
-	}
-	parameters := Parameters{
-		Description: "请求内容",
-		Name:        "body",
-		In:          "body",
-		Required:    true,
-	}
-	requestName := strings.Replace(tags+"."+name+"."+kind+".Request", "/", ".", -1)
-	requestProperties := createDefinitions(requestName, request)
-	definitions = append(definitions, requestProperties...)
-
-	parameters.Schema.Type = "object"
-	parameters.Schema.Ref = "#/definitions/" + requestName
-	api.Parameters = []Parameters{
+//headers 公共请求头
+func headers(isAuth bool) []Parameters {
+	parameters := []Parameters{
 		{
 			Type:        "integer",
 			Description: "请求超时时间,单位秒",
@@ -798,7 +917,7 @@ func createPostAndPutAPI(kind, tags, summary, name string, isAuth bool, request,
 		},
 	}
 	if isAuth {
-		api.Parameters = append(api.Parameters, Parameters{
+		parameters = append(parameters, Parameters{
 			Type:        "string",
 			Description: "验证Token",
 			Name:        "token",
@@ -806,160 +925,166 @@ func createPostAndPutAPI(kind, tags, summary, name string, isAuth bool, request,
 			Required:    true,
 		})
 	}
-	api.Parameters = append(api.Parameters, parameters)
+	return parameters
+}
 
-	responeName := strings.Replace(tags+"."+name+"."+kind+".Respone", "/", ".", -1)
-	responeProperties := createDefinitions(responeName, respone)
-	definitions = append(definitions, responeProperties...)
+//collect 收集结构定义
+func collect(defs map[string]*serviceinfo.Schema, s *serviceinfo.Schema) {
+	for name, def := range s.Defs {
+		defs[name] = schema.Rewrite(def, definitionsPrefix)
+	}
+}
 
-	api.Responses.Code200.Description = "请求成功返回参数"
-	api.Responses.Code200.Schema.Type = "object"
-	api.Responses.Code200.Schema.Ref = "#/definitions/" + responeName
+//docPath 将:param以及*wildcard转换为文档的{param}格式 返回路径参数名称
+func docPath(path string) (string, []string) {
+	var names []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if len(segment) > 1 && (segment[0] == ':' || segment[0] == '*') {
+			names = append(names, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), names
+}
+
+//pathParameters 路径参数 类型从请求结构中获取
+func pathParameters(request *serviceinfo.Schema, names []string) (parameters []Parameters) {
+	object := schema.Resolve(request, request)
+	for _, name := range names {
+		parameter := Parameters{
+			Type:        "string",
+			Description: "路径参数",
+			Name:        name,
+			In:          "path",
+			Required:    true,
+		}
+		if object != nil {
+			if property := schema.Resolve(request, object.Properties[name]); property != nil && property.Type != "" {
+				parameter.Type = property.Type
+				parameter.Format = property.Format
+				parameter.Enum = property.Enum
+				if object.Properties[name].Description != "" {
+					parameter.Description = object.Properties[name].Description
+				}
+			}
+		}
+		parameters = append(parameters, parameter)
+	}
+	return
+}
+
+//propertyParameters 将请求结构的字段转换为query或者formData参数 跳过路径参数
+func propertyParameters(request *serviceinfo.Schema, in string, params []string) (parameters []Parameters) {
+	object := schema.Resolve(request, request)
+	if object == nil {
+		return
+	}
+	required := make(map[string]bool)
+	for _, name := range object.Required {
+		required[name] = true
+	}
+	skip := make(map[string]bool)
+	for _, name := range params {
+		skip[name] = true
+	}
+	for key, value := range object.Properties {
+		if skip[key] {
+			continue
+		}
+		property := schema.Rewrite(schema.Resolve(request, value), definitionsPrefix)
+		if property == nil {
+			continue
+		}
+		parameter := Parameters{
+			Type:        property.Type,
+			Format:      property.Format,
+			Items:       property.Items,
+			Enum:        property.Enum,
+			Description: value.Description,
+			Name:        key,
+			In:          in,
+			Required:    required[key],
+		}
+		if isFile(request, value) {
+			parameter.Type = "file"
+			parameter.Format = ""
+			parameter.Items = nil
+		}
+		parameters = append(parameters, parameter)
+	}
+	return
+}
+
+//isFile 字段是否为上传文件或者文件数组
+func isFile(request, property *serviceinfo.Schema) bool {
+	property = schema.Resolve(request, property)
+	if property == nil {
+		return false
+	}
+	if property.Type == "array" {
+		property = schema.Resolve(request, property.Items)
+	}
+	return property != nil && property.Format == "binary"
+}
 
-	return api, definitions
+//hasFile 请求结构是否包含上传文件
+func hasFile(request *serviceinfo.Schema) bool {
+	object := schema.Resolve(request, request)
+	if object == nil {
+		return false
+	}
+	for _, property := range object.Properties {
+		if isFile(request, property) {
+			return true
+		}
+	}
+	return false
 }
 
-//createGetAndDeleteAPI 创建一个GET/DELETE API
-func createGetAndDeleteAPI(kind, tags, summary, name string, isAuth bool, request, respone map[string]interface{}) (a Body, definitions []Definitions) {
+//createPostAndPutAPI 创建一个POST/PUT/PATCH API 包含上传文件时使用multipart/form-data
+func createPostAndPutAPI(tags, summary string, isAuth bool, params []string, request, respone *serviceinfo.Schema, defs map[string]*serviceinfo.Schema) (a Body) {
 	api := Body{
-		Consumes: []string{"application/json"},
+		Consumes: []string{"application/json", "application/x-www-form-urlencoded"},
+		Produces: []string{"application/json"},
 		Tags:     []string{tags},
 		Summary:  summary,
 	}
-	for key, value := range request {
-		if vali, ok := value.(map[string]interface{}); ok {
-			des, ok1 := vali["description"]
-			tp, ok2 := vali["type"]
-			required := false
-			re, ok3 := vali["required"]
-			if ok3 && re == "true" {
-				required = true
-			}
-			if ok1 == true && ok2 == true {
-				api.Parameters = append(api.Parameters, Parameters{
-					Type:        t(tp.(string)),
-					Description: des.(string),
-					Name:        key,
-					In:          "query",
-					Required:    required,
-				})
-			}
-		}
-	}
-	api.Parameters = append(api.Parameters,
-		Parameters{
-			Type:        "integer",
-			Description: "请求超时时间,单位秒",
-			Name:        "timeOut",
-			In:          "header",
-			Required:    true,
-		},
-		Parameters{
-			Type:        "string",
-			Description: "链路请求ID",
-			Name:        "traceID",
-			In:          "header",
-			Required:    true,
-		},
-		Parameters{
-			Type:        "boolean",
-			Description: "是否是测试请求",
-			Name:        "isTest",
-			In:          "header",
-			Required:    true,
-		})
-	if isAuth {
+	collect(defs, request)
+	api.Parameters = append(headers(isAuth), pathParameters(request, params)...)
+	if hasFile(request) {
+		api.Consumes = []string{"multipart/form-data"}
+		api.Parameters = append(api.Parameters, propertyParameters(request, "formData", params)...)
+	} else {
 		api.Parameters = append(api.Parameters, Parameters{
-			Type:        "string",
-			Description: "验证Token",
-			Name:        "token",
-			In:          "header",
+			Description: "请求内容",
+			Name:        "body",
+			In:          "body",
 			Required:    true,
+			Schema:      schema.Rewrite(request, definitionsPrefix),
 		})
 	}
-
-	responeName := strings.Replace(tags+"."+name+"."+kind+".Respone", "/", ".", -1)
-	responeProperties := createDefinitions(responeName, respone)
-	definitions = append(definitions, responeProperties...)
-
+	collect(defs, respone)
 	api.Responses.Code200.Description = "请求成功返回参数"
-	api.Responses.Code200.Schema.Type = "object"
-	api.Responses.Code200.Schema.Ref = "#/definitions/" + responeName
-
-	return api, definitions
+	api.Responses.Code200.Schema = schema.Rewrite(respone, definitionsPrefix)
+	return api
 }
 
-//createDefinitions 生成Definitions
-func createDefinitions(name string, mp map[string]interface{}) (definitions []Definitions) {
-	properties := make(map[string]Description)
-	for key, value := range mp {
-		if vali, ok := value.(map[string]interface{}); ok {
-			slice, ok := vali["slice"]
-			des, ok1 := vali["description"]
-			tp, ok2 := vali["type"]
-			if ok {
-				mp, o := slice.(map[string]interface{})
-				if o == true {
-					description := Description{}
-					if ok1 {
-						description.Description = des.(string)
-					}
-					if ok2 {
-						description.Type = t(tp.(string))
-					}
-					son := name + "." + key
-					definitions = append(definitions, createDefinitions(son, mp)...)
-					description.Items = &Ref{
-						Ref: "#/definitions/" + son,
-					}
-					properties[key] = description
-				} else {
-					description := Description{}
-					if ok1 {
-						description.Description = des.(string)
-					}
-					if ok2 {
-						description.Type = t(tp.(string))
-					}
-					description.Items = map[string]string{
-						"type": t(vali["slice"].(string)),
-					}
-					properties[key] = description
-				}
-				continue
-			} else if object, ok3 := vali["object"]; ok3 {
-				mp, o := object.(map[string]interface{})
-				if o == true {
-					description := Description{}
-					if ok1 {
-						description.Description = des.(string)
-					}
-					description.Type = "object"
-					son := name + "." + key
-					definitions = append(definitions, createDefinitions(son, mp)...)
-					description.Ref = "#/definitions/" + son
-
-					properties[key] = description
-					continue
-				}
-			}
-			description := Description{}
-			if ok1 {
-				description.Description = des.(string)
-			}
-			if ok2 {
-				description.Type = t(tp.(string))
-			}
-			properties[key] = description
-		}
-	}
-	definition := Definitions{
-		Name:       name,
-		Type:       "object",
-		Properties: properties,
+//createGetAndDeleteAPI 创建一个GET/DELETE/HEAD API
+func createGetAndDeleteAPI(tags, summary string, isAuth bool, params []string, request, respone *serviceinfo.Schema, defs map[string]*serviceinfo.Schema) (a Body) {
+	api := Body{
+		Consumes: []string{"application/json"},
+		Tags:     []string{tags},
+		Summary:  summary,
 	}
-	definitions = append(definitions, definition)
-	return
+	api.Parameters = pathParameters(request, params)
+	api.Parameters = append(api.Parameters, propertyParameters(request, "query", params)...)
+	collect(defs, request)
+	api.Parameters = append(api.Parameters, headers(isAuth)...)
+	collect(defs, respone)
+	api.Responses.Code200.Description = "请求成功返回参数"
+	api.Responses.Code200.Schema = schema.Rewrite(respone, definitionsPrefix)
+	return api
 }
 
 //swagger info
@@ -984,91 +1109,53 @@ func (g *Gateway) assembleDocs() string {
 	}
 
 	paths := make(map[string]map[string]interface{})
-	definitions := make(map[string]Definitions)
+	definitions := make(map[string]*serviceinfo.Schema)
 
 	g.discovery.RangeAPI(func(url string, service *serviceinfo.ServcieAPI) {
+		if service.Method.Request == nil || service.Method.Response == nil {
+			return
+		}
+		path, params := docPath(service.Method.Path)
+		var api Body
 		switch service.Method.Kind {
-		case string(plugins.POST):
-			api, d := createPostAndPutAPI(
-				service.Method.Kind,
+		case string(plugins.POST), string(plugins.PUT), string(plugins.PATCH):
+			api = createPostAndPutAPI(
 				service.Explain+"["+service.Tags+"]",
 				service.Method.Explain,
-				service.Method.Name,
 				service.Method.IsAuth,
+				params,
 				service.Method.Request,
-				service.Method.Response)
-			if value, ok := paths[service.Method.Path]; ok {
-				value["post"] = api
-				paths[service.Method.Path] = value
-			} else {
-				value := make(map[string]interface{})
-				value["post"] = api
-				paths[service.Method.Path] = value
-			}
-			for _, definition := range d {
-				definitions[definition.Name] = definition
-			}
-		case string(plugins.PUT):
-			api, d := createPostAndPutAPI(
-				service.Method.Kind,
+				service.Method.Response,
+				definitions)
+		case string(plugins.GET), string(plugins.DELETE), string(plugins.HEAD), string(plugins.SSE):
+			api = createGetAndDeleteAPI(
 				service.Explain+"["+service.Tags+"]",
 				service.Method.Explain,
-				service.Method.Name,
 				service.Method.IsAuth,
+				params,
 				service.Method.Request,
-				service.Method.Response)
-			if value, ok := paths[service.Method.Path]; ok {
-				value["put"] = api
-				paths[service.Method.Path] = value
-			} else {
-				value := make(map[string]interface{})
-				value["put"] = api
-				paths[service.Method.Path] = value
-			}
-			for _, definition := range d {
-				definitions[definition.Name] = definition
-			}
-		case string(plugins.GET):
-			api, d := createGetAndDeleteAPI(
-				service.Method.Kind,
-				service.Explain+"["+service.Tags+"]",
-				service.Method.Explain,
-				service.Method.Name,
-				service.Method.IsAuth,
-				service.Method.Request,
-				service.Method.Response)
-			if value, ok := paths[service.Method.Path]; ok {
-				value["get"] = api
-				paths[service.Method.Path] = value
-			} else {
-				value := make(map[string]interface{})
-				value["get"] = api
-				paths[service.Method.Path] = value
-			}
-			for _, definition := range d {
-				definitions[definition.Name] = definition
-			}
-		case string(plugins.DELETE):
-			api, d := createGetAndDeleteAPI(
-				service.Method.Kind,
-				service.Explain+"["+service.Tags+"]",
-				service.Method.Explain,
-				service.Method.Name,
-				service.Method.IsAuth,
-				service.Method.Request,
-				service.Method.Response)
-			if value, ok := paths[service.Method.Path]; ok {
-				value["delete"] = api
-				paths[service.Method.Path] = value
-			} else {
-				value := make(map[string]interface{})
-				value["delete"] = api
-				paths[service.Method.Path] = value
-			}
-			for _, definition := range d {
-				definitions[definition.Name] = definition
-			}
+				service.Method.Response,
+				definitions)
+		default:
+			return
+		}
+		if schema.IsFile(service.Method.Response) {
+			api.Produces = []string{"application/octet-stream"}
+			api.Responses.Code200.Description = "文件内容"
+			api.Responses.Code200.Schema = &serviceinfo.Schema{Type: "file"}
+		}
+		kind := service.Method.Kind
+		if kind == string(plugins.SSE) {
+			kind = string(plugins.GET)
+			api.Produces = []string{"text/event-stream"}
+			api.Responses.Code200.Description = "事件流"
+		}
+		value, ok := paths[path]
+		if !ok {
+			value = make(map[string]interface{})
+			paths[path] = value
 		}
+		value[strings.ToLower(kind)] = api
 	})
 
 	docs := &Docs{
@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/pkg/route"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+//routeDiscovery 只实现路由查找的服务发现
+type routeDiscovery struct {
+	plugins.Discovery
+	routes *route.Tree
+}
+
+func (d *routeDiscovery) GetAPIByURL(method, path string) (*serviceinfo.ServcieAPI, map[string]string, bool) {
+	value, params, ok := d.routes.Find(method, path)
+	if !ok {
+		return nil, nil, false
+	}
+	return value.(*serviceinfo.ServcieAPI), params, true
+}
+
+func TestFindAPI(t *testing.T) {
+	d := &routeDiscovery{routes: route.NewTree()}
+	for _, api := range []*serviceinfo.API{
+		{Name: "Get", Kind: http.MethodGet, Path: "/api/user/:id"},
+		{Name: "Head", Kind: http.MethodHead, Path: "/api/head/:id"},
+		{Name: "HeadGet", Kind: http.MethodGet, Path: "/api/head/:id"},
+		{Name: "Events", Kind: string(plugins.SSE), Path: "/api/events"},
+		{Name: "Delete", Kind: http.MethodDelete, Path: "/api/user/:id"},
+	} {
+		if err := d.routes.Add(api.Kind, api.Path, &serviceinfo.ServcieAPI{Name: "user", Method: api}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := &Gateway{discovery: d}
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   string
+	}{
+		{"get", http.MethodGet, "/api/user/1", "Get"},
+		{"head falls back to get", http.MethodHead, "/api/user/1", "Get"},
+		{"registered head first", http.MethodHead, "/api/head/1", "Head"},
+		{"sse by get", http.MethodGet, "/api/events", "Events"},
+		{"sse not by head", http.MethodHead, "/api/events", ""},
+		{"sse not by delete", http.MethodDelete, "/api/events", ""},
+		{"delete no fallback", http.MethodDelete, "/api/head/1", ""},
+		{"delete", http.MethodDelete, "/api/user/1", "Delete"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			apiservice, _, ok := g.findAPI(test.method, test.url)
+			if test.want == "" {
+				if ok {
+					t.Fatalf("findAPI %s %s = %s want not found", test.method, test.url, apiservice.Method.Name)
+				}
+				return
+			}
+			if !ok || apiservice.Method.Name != test.want {
+				t.Fatalf("findAPI %s %s = %v, %t want %s", test.method, test.url, apiservice, ok, test.want)
+			}
+		})
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter plugins.Formatter
+		mapping   bool
+		code      int
+		remote    bool
+		status    int
+	}{
+		{"legacy param", new(LegacyFormatter), false, customerror.ParamError, false, customerror.ParamError},
+		{"legacy route", new(LegacyFormatter), false, http.StatusNotFound, false, http.StatusNotFound},
+		{"legacy rpc param", new(LegacyFormatter), false, customerror.ParamError, true, http.StatusOK},
+		{"legacy rpc not find", new(LegacyFormatter), false, customerror.RPCNotFind, true, http.StatusOK},
+		{"legacy other", new(LegacyFormatter), false, customerror.Unauthorized, false, http.StatusOK},
+		{"rest param", new(RESTFormatter), false, customerror.ParamError, false, http.StatusBadRequest},
+		{"rest rpc", new(RESTFormatter), false, customerror.Forbidden, true, http.StatusForbidden},
+		{"rest business", new(RESTFormatter), false, 20001, true, http.StatusOK},
+		{"mapping", new(LegacyFormatter), true, 20001, true, http.StatusConflict},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := &Gateway{formatter: test.formatter, status: newStatusMapping()}
+			if test.mapping {
+				g.StatusMapping(20001, http.StatusConflict)
+			}
+			if status := g.httpStatus(test.code, test.remote); status != test.status {
+				t.Fatalf("httpStatus(%d, %t) = %d want %d", test.code, test.remote, status, test.status)
+			}
+		})
+	}
+}
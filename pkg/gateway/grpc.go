@@ -0,0 +1,488 @@
+package gateway
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/lib/uuid"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/pkg/context"
+	"github.com/tang-go/go-dog/pkg/schema"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+//grpcRefresh gRPC描述的刷新间隔
+const grpcRefresh = 10 * time.Second
+
+//grpcRegistry 由网关注册的API生成的gRPC方法 在锁外生成后整体替换
+type grpcRegistry struct {
+	methods map[string]*grpcMethod
+	set     *descriptorpb.FileDescriptorSet
+	time    time.Time
+	//正在生成时不为空 生成完成后关闭
+	building chan struct{}
+	lock     sync.RWMutex
+}
+
+//get 获取当前的gRPC方法以及生成时间
+func (r *grpcRegistry) get(path string) (*grpcMethod, *descriptorpb.FileDescriptorSet, time.Time, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	method, ok := r.methods[path]
+	return method, r.set, r.time, ok
+}
+
+//refresh 重新生成gRPC方法 同时只生成一次 since之后已经生成过时不再生成
+//返回的通道在生成完成后关闭
+func (r *grpcRegistry) refresh(since time.Time, build func() (map[string]*grpcMethod, *descriptorpb.FileDescriptorSet)) <-chan struct{} {
+	r.lock.Lock()
+	if r.building != nil {
+		building := r.building
+		r.lock.Unlock()
+		return building
+	}
+	building := make(chan struct{})
+	if r.time.After(since) {
+		r.lock.Unlock()
+		close(building)
+		return building
+	}
+	r.building = building
+	r.lock.Unlock()
+	defer close(building)
+	methods, set := build()
+	r.lock.Lock()
+	r.methods, r.set, r.time = methods, set, time.Now()
+	r.building = nil
+	r.lock.Unlock()
+	return building
+}
+
+//rawCodec 不做编解码 请求与响应由网关转换
+type rawCodec struct{}
+
+//Marshal 编码
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	buff, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("不支持的类型:%T", v)
+	}
+	return *buff, nil
+}
+
+//Unmarshal 解码
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	buff, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("不支持的类型:%T", v)
+	}
+	*buff = append((*buff)[:0], data...)
+	return nil
+}
+
+//String 名称
+func (rawCodec) String() string {
+	return "raw"
+}
+
+//GRPC 开启gRPC入口 gRPC-Web通过http端口访问 port小于等于0时只开启gRPC-Web
+//方法映射为 /服务名称.类名称/方法名称 没有类名称时为Service 描述文件通过/grpc/descriptors.pb获取
+func (g *Gateway) GRPC(port int) {
+	g.grpcEnable = true
+	g.grpcPort = port
+}
+
+//runGRPC 启动gRPC服务
+func (g *Gateway) runGRPC() error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", g.grpcPort))
+	if err != nil {
+		return err
+	}
+	g.grpcServer = grpc.NewServer(
+		//v1.26.0没有ForceServerCodec 使用CustomCodec不影响全局注册的codec
+		grpc.CustomCodec(rawCodec{}),
+		grpc.StreamInterceptor(g.grpcFirewall),
+		grpc.UnknownServiceHandler(g.grpcHandler),
+	)
+	log.Tracef("grpc 启动 0.0.0.0:%d", g.grpcPort)
+	return g.grpcServer.Serve(l)
+}
+
+//grpcMethods 获取gRPC方法 超过刷新间隔或者没有找到方法时重新生成
+//生成期间其他请求继续使用旧的方法 没有找到方法的请求等待生成完成
+func (g *Gateway) grpcMethods(path string) (*grpcMethod, *descriptorpb.FileDescriptorSet, bool) {
+	method, set, built, ok := g.grpcs.get(path)
+	if elapsed := time.Since(built); elapsed > grpcRefresh || (!ok && path != "" && elapsed > time.Second) {
+		done := g.grpcs.refresh(built, g.buildGRPC)
+		if ok {
+			return method, set, ok
+		}
+		<-done
+		method, set, _, ok = g.grpcs.get(path)
+	}
+	return method, set, ok
+}
+
+//buildGRPC 由网关注册的API生成gRPC方法
+func (g *Gateway) buildGRPC() (map[string]*grpcMethod, *descriptorpb.FileDescriptorSet) {
+	var apis []*serviceinfo.ServcieAPI
+	g.discovery.RangeAPI(func(url string, api *serviceinfo.ServcieAPI) {
+		//流式接口以及文件接口不支持gRPC
+		if api.Method.Kind == string(plugins.SSE) || schema.IsFile(api.Method.Response) {
+			return
+		}
+		apis = append(apis, api)
+	})
+	return buildProto(apis)
+}
+
+//grpcHandler 处理gRPC请求
+func (g *Gateway) grpcHandler(srv interface{}, stream grpc.ServerStream) error {
+	path, ok := grpc.MethodFromServerStream(stream)
+	if !ok {
+		return status.Error(codes.Internal, "获取方法失败")
+	}
+	method, _, ok := g.grpcMethods(path)
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "方法不存在:%s", path)
+	}
+	var request []byte
+	if err := stream.RecvMsg(&request); err != nil {
+		return err
+	}
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	address, _ := g.grpcPeer(stream.Context(), md)
+	reply, err := g.grpcCall(stream.Context(), method, request, address, func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	})
+	if err != nil {
+		e := customerror.DeCodeError(err)
+		return status.Error(grpcCode(e.Code), e.Msg)
+	}
+	return stream.SendMsg(&reply)
+}
+
+//grpcPeer 获取gRPC客户端ip以及国家 对端为防火墙配置的可信代理时才使用x-forwarded-for
+func (g *Gateway) grpcPeer(ctx stdcontext.Context, md metadata.MD) (string, string) {
+	remote := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remote = p.Addr.String()
+	}
+	fw := g.firewalls.get()
+	if fw == nil {
+		host, _, err := net.SplitHostPort(remote)
+		if err != nil {
+			return remote, ""
+		}
+		return host, ""
+	}
+	realIP := ""
+	if values := md.Get("x-real-ip"); len(values) > 0 {
+		realIP = values[0]
+	}
+	ip, trusted := fw.clientIP(remote, md.Get("x-forwarded-for"), realIP)
+	country := ""
+	if values := md.Get(fw.country); trusted && fw.country != "" && len(values) > 0 {
+		country = strings.ToUpper(strings.TrimSpace(values[0]))
+	}
+	return ip, country
+}
+
+//grpcFirewall gRPC入口的防火墙 按ip 国家 url前缀检查访问控制 请求内容检查大小以及拦截规则
+func (g *Gateway) grpcFirewall(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	fw := g.firewalls.get()
+	if fw == nil {
+		return handler(srv, stream)
+	}
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	ip, country := g.grpcPeer(stream.Context(), md)
+	path := info.FullMethod
+	if method, _, ok := g.grpcMethods(path); ok {
+		//访问控制按API路径匹配 与http入口一致
+		path = method.api.Method.Path
+	}
+	limit, rule, err := fw.access(ip, country, path)
+	if err != nil {
+		g.blocked(ip, path, rule, err)
+		return status.Error(grpcCode(err.Code), err.Msg)
+	}
+	return handler(srv, &firewallStream{ServerStream: stream, gateway: g, fw: fw, md: md, ip: ip, path: path, limit: limit})
+}
+
+//firewallStream 检查接收的消息
+type firewallStream struct {
+	grpc.ServerStream
+	gateway *Gateway
+	fw      *firewall
+	md      metadata.MD
+	ip      string
+	path    string
+	limit   int64
+}
+
+//RecvMsg 接收消息后检查大小以及拦截规则
+func (s *firewallStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	buff, ok := m.(*[]byte)
+	if !ok {
+		return nil
+	}
+	if s.limit > 0 && int64(len(*buff)) > s.limit {
+		err := customerror.EnCodeError(customerror.RequestTooLarge, "请求内容超过限制")
+		s.gateway.blocked(s.ip, s.path, "size", err)
+		return status.Error(grpcCode(err.Code), err.Msg)
+	}
+	rule := s.fw.match(&wafRequest{
+		method: http.MethodPost,
+		path:   s.path,
+		header: s.md.Get,
+		body: func() string {
+			body := *buff
+			if len(body) > wafBodySize {
+				body = body[:wafBodySize]
+			}
+			return string(body)
+		},
+	})
+	if rule != "" {
+		err := customerror.EnCodeError(customerror.Forbidden, "请求被拦截")
+		s.gateway.blocked(s.ip, s.path, rule, err)
+		return status.Error(grpcCode(err.Code), err.Msg)
+	}
+	return nil
+}
+
+//grpcWeb 处理gRPC-Web请求 非gRPC-Web请求继续执行后续处理
+func (g *Gateway) grpcWeb(c *gin.Context) {
+	contentType := c.Request.Header.Get("Content-Type")
+	if c.Request.Method != http.MethodPost || !strings.HasPrefix(contentType, "application/grpc-web") {
+		c.Next()
+		return
+	}
+	c.Abort()
+	text := strings.HasPrefix(contentType, "application/grpc-web-text")
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, g.cfg.GetMaxUploadSize()))
+	if err != nil {
+		e := bodyError(err)
+		g.grpcWebReply(c, text, nil, status.New(grpcCode(e.Code), e.Msg))
+		return
+	}
+	if text {
+		if body, err = base64.StdEncoding.DecodeString(string(body)); err != nil {
+			g.grpcWebReply(c, text, nil, status.New(codes.InvalidArgument, err.Error()))
+			return
+		}
+	}
+	if len(body) < 5 || body[0]&0x80 != 0 || int(binary.BigEndian.Uint32(body[1:5])) > len(body)-5 {
+		g.grpcWebReply(c, text, nil, status.New(codes.InvalidArgument, "请求格式错误"))
+		return
+	}
+	request := body[5 : 5+binary.BigEndian.Uint32(body[1:5])]
+	method, _, ok := g.grpcMethods(c.Request.URL.Path)
+	if !ok {
+		g.grpcWebReply(c, text, nil, status.Newf(codes.Unimplemented, "方法不存在:%s", c.Request.URL.Path))
+		return
+	}
+	ctx := c.Request.Context()
+	if timeout := c.Request.Header.Get("grpc-timeout"); timeout != "" {
+		if d, ok := grpcTimeout(timeout); ok {
+			var cancel stdcontext.CancelFunc
+			ctx, cancel = stdcontext.WithTimeout(ctx, d)
+			defer cancel()
+		}
+	}
+	reply, err := g.grpcCall(ctx, method, request, c.ClientIP(), c.Request.Header.Get)
+	if err != nil {
+		e := customerror.DeCodeError(err)
+		g.grpcWebReply(c, text, nil, status.New(grpcCode(e.Code), e.Msg))
+		return
+	}
+	g.grpcWebReply(c, text, reply, status.New(codes.OK, ""))
+}
+
+//grpcWebReply 返回gRPC-Web响应 数据帧之后为trailer帧
+func (g *Gateway) grpcWebReply(c *gin.Context, text bool, reply []byte, s *status.Status) {
+	var buff bytes.Buffer
+	if s.Code() == codes.OK {
+		buff.Write(grpcFrame(0x00, reply))
+	}
+	trailer := fmt.Sprintf("grpc-status: %d\r\ngrpc-message: %s\r\n", s.Code(), grpcMessage(s.Message()))
+	buff.Write(grpcFrame(0x80, []byte(trailer)))
+	contentType := "application/grpc-web+proto"
+	data := buff.Bytes()
+	if text {
+		contentType = "application/grpc-web-text+proto"
+		data = []byte(base64.StdEncoding.EncodeToString(data))
+	}
+	c.Header("grpc-status", strconv.Itoa(int(s.Code())))
+	c.Header("grpc-message", grpcMessage(s.Message()))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+//grpcDescriptors 获取gRPC描述文件(FileDescriptorSet) 可用于grpcurl -protoset
+func (g *Gateway) grpcDescriptors(c *gin.Context) {
+	if !g.docAuth(c) {
+		return
+	}
+	_, set, _ := g.grpcMethods("")
+	buff, err := proto.Marshal(set)
+	if err != nil {
+		g.fail(c, customerror.EnCodeError(customerror.InternalServerError, err.Error()))
+		return
+	}
+	c.Data(http.StatusOK, "application/octet-stream", buff)
+}
+
+//grpcCall 将gRPC请求转换为json后调用API
+func (g *Gateway) grpcCall(c stdcontext.Context, method *grpcMethod, request []byte, address string, header func(key string) string) ([]byte, error) {
+	apiservice := method.api
+	url := apiservice.Method.Path
+	//API key签名需要原始http请求 只允许签名访问的路由不能通过gRPC以及gRPC-Web访问
+	if g.signOnly(url) {
+		return nil, customerror.EnCodeError(customerror.Unauthorized, "该接口只允许API key签名访问")
+	}
+	body, err := method.decode(request)
+	if err != nil {
+		return nil, customerror.EnCodeError(customerror.ParamError, err.Error())
+	}
+	if errs := schema.ValidateJSON(apiservice.Method.Request, body); len(errs) > 0 {
+		return nil, customerror.EnCodeError(customerror.ParamError, errs.Error())
+	}
+	ttl := time.Second * 6
+	if deadline, ok := c.Deadline(); ok {
+		ttl = time.Until(deadline)
+	}
+	if ttl <= 0 {
+		return nil, customerror.EnCodeError(customerror.RequestTimeout, "请求超时")
+	}
+	traceID := header("traceID")
+	if traceID == "" {
+		traceID = uuid.GetToken()
+	}
+	isTest, _ := strconv.ParseBool(header("isTest"))
+	ctx := context.Background()
+	ctx.SetAddress(address)
+	ctx.SetIsTest(isTest)
+	ctx.SetTraceID(traceID)
+	ctx.SetURL(url)
+	ctx.SetClient(g.GetClient())
+	ctx = context.WithTimeout(ctx, int64(ttl))
+	defer ctx.Cancel()
+	//开启追踪
+	if span, err := g.jaeger.StartSpan(ctx, url); err == nil {
+		//请求内容脱敏后记录
+		span.LogKV("request", string(g.masker.JSON(body, apiservice.Method.Request)))
+		defer span.Finish()
+	}
+	//查看方法是否需要验证权限
+	if apiservice.Method.IsAuth {
+		if err := g.authenticate(ctx, header("token"), url, apiservice.Method); err != nil {
+			return nil, err
+		}
+	}
+	e := &plugins.Exchange{Ctx: ctx, URL: url, Service: apiservice.Name, API: apiservice.Method, Request: body}
+	back, err := g.exchange(e, apiservice)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := method.encode(back)
+	if err != nil {
+		return nil, customerror.EnCodeError(customerror.InternalServerError, err.Error())
+	}
+	return reply, nil
+}
+
+//grpcCode 错误码对应的gRPC状态码
+func grpcCode(code int) codes.Code {
+	switch code {
+	case customerror.ParamError:
+		return codes.InvalidArgument
+	case customerror.Unauthorized:
+		return codes.Unauthenticated
+	case customerror.Forbidden:
+		return codes.PermissionDenied
+	case customerror.RPCNotFind:
+		return codes.NotFound
+	case customerror.RequestTimeout:
+		return codes.DeadlineExceeded
+	case customerror.ClientLimitError, customerror.SeviceLimitError, customerror.RequestTooLarge:
+		return codes.ResourceExhausted
+	case customerror.ConnectClose:
+		return codes.Unavailable
+	case customerror.InternalServerError:
+		return codes.Internal
+	default:
+		return codes.Unknown
+	}
+}
+
+//grpcFrame gRPC消息帧 1字节标记 4字节长度
+func grpcFrame(flag byte, data []byte) []byte {
+	frame := make([]byte, 5+len(data))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(data)))
+	copy(frame[5:], data)
+	return frame
+}
+
+//grpcMessage grpc-message百分号编码
+func grpcMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c >= 0x20 && c <= 0x7e && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+//grpcTimeout 解析grpc-timeout 例如:10S 100m
+func grpcTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestGRPCRegistryRefresh(t *testing.T) {
+	r := new(grpcRegistry)
+	var builds int32
+	release := make(chan struct{})
+	build := func() (map[string]*grpcMethod, *descriptorpb.FileDescriptorSet) {
+		atomic.AddInt32(&builds, 1)
+		<-release
+		return map[string]*grpcMethod{"/svc.Service/Get": new(grpcMethod)}, new(descriptorpb.FileDescriptorSet)
+	}
+	_, _, since, _ := r.get("/svc.Service/Get")
+	var wait sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			<-r.refresh(since, build)
+		}()
+	}
+	//生成期间可以读取旧的方法
+	time.Sleep(time.Millisecond * 20)
+	if _, _, _, ok := r.get("/svc.Service/Get"); ok {
+		t.Fatal("method visible before build finished")
+	}
+	close(release)
+	wait.Wait()
+	if n := atomic.LoadInt32(&builds); n != 1 {
+		t.Fatalf("builds = %d want 1", n)
+	}
+	if _, _, _, ok := r.get("/svc.Service/Get"); !ok {
+		t.Fatal("method not found after build")
+	}
+	//已经生成过时不再生成
+	<-r.refresh(since, build)
+	if n := atomic.LoadInt32(&builds); n != 1 {
+		t.Fatalf("builds = %d want 1", n)
+	}
+}
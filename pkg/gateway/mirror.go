@@ -0,0 +1,89 @@
+package gateway
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/metrics"
+	"github.com/tang-go/go-dog/pkg/context"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/recover"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+//mirror 流量镜像
+type mirror struct {
+	service string
+	percent int
+}
+
+//mirrors 流量镜像列表
+type mirrors struct {
+	data map[string]*mirror
+	rnd  *rand.Rand
+	lock sync.RWMutex
+}
+
+func newMirrors() *mirrors {
+	return &mirrors{
+		data: make(map[string]*mirror),
+		rnd:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+//Mirror 按比例将url的请求镜像到影子服务 percent小于等于0时取消镜像
+func (g *Gateway) Mirror(url string, service string, percent int) {
+	g.mirrors.lock.Lock()
+	defer g.mirrors.lock.Unlock()
+	if percent <= 0 || service == "" {
+		delete(g.mirrors.data, url)
+		log.Tracef("取消流量镜像 | %s ", url)
+		return
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	g.mirrors.data[url] = &mirror{
+		service: service,
+		percent: percent,
+	}
+	log.Tracef("流量镜像 | %s | %s | %d%% ", url, service, percent)
+}
+
+//mirror 镜像请求 不等待返回,返回结果丢弃,错误只做统计
+func (g *Gateway) mirror(ctx plugins.Context, api *serviceinfo.ServcieAPI, body []byte) {
+	g.mirrors.lock.Lock()
+	m, ok := g.mirrors.data[api.Method.Path]
+	hit := ok && g.mirrors.rnd.Intn(100) < m.percent
+	g.mirrors.lock.Unlock()
+	if !hit {
+		return
+	}
+	datas := make(map[string][]byte)
+	for key, value := range ctx.GetData() {
+		datas[key] = value
+	}
+	mctx := context.NewContextByData(datas)
+	mctx.SetAddress(ctx.GetAddress())
+	mctx.SetIsTest(ctx.GetIsTest())
+	mctx.SetTraceID(ctx.GetTraceID())
+	mctx.SetToken(ctx.GetToken())
+	mctx.SetURL(ctx.GetURL())
+	mctx.SetClient(g.GetClient())
+	mctx = context.WithTimeout(mctx, ctx.GetTTL())
+	go func() {
+		defer recover.Recover()
+		defer mctx.Cancel()
+		_, err := g.GetClient().SendRequest(mctx, plugins.RandomMode, m.service, "", api.Method.Name, "json", body)
+		if err != nil {
+			e := customerror.DeCodeError(err)
+			metrics.MetricMirrorCount(m.service, api.Method.Path, "false", strconv.Itoa(e.Code))
+			return
+		}
+		metrics.MetricMirrorCount(m.service, api.Method.Path, "true", "0")
+	}()
+}
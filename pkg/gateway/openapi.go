@@ -0,0 +1,321 @@
+package gateway
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/pkg/schema"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+const (
+	//tokenSecurity token验证方案名称
+	tokenSecurity = "token"
+	//componentsPrefix OpenAPI结构定义引用前缀
+	componentsPrefix = "#/components/schemas/"
+)
+
+//OpenAPI OpenAPI 3.0文档
+type OpenAPI struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       OpenAPIInfo                     `json:"info"`
+	Servers    []OpenAPIServer                 `json:"servers"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+//OpenAPIInfo 文档信息
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+//OpenAPIServer 服务地址
+type OpenAPIServer struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+//Operation 接口描述
+type Operation struct {
+	Tags        []string              `json:"tags"`
+	Summary     string                `json:"summary"`
+	OperationID string                `json:"operationId"`
+	Parameters  []OpenAPIParameter    `json:"parameters"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+//OpenAPIParameter 参数描述
+type OpenAPIParameter struct {
+	Name        string              `json:"name"`
+	In          string              `json:"in"`
+	Description string              `json:"description,omitempty"`
+	Required    bool                `json:"required"`
+	Schema      *serviceinfo.Schema `json:"schema"`
+}
+
+//RequestBody 请求内容
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+//Response 响应内容
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+//MediaType 内容类型
+type MediaType struct {
+	Schema *serviceinfo.Schema `json:"schema"`
+}
+
+//Components 公共组件
+type Components struct {
+	Schemas         map[string]*serviceinfo.Schema `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme      `json:"securitySchemes"`
+}
+
+//SecurityScheme 验证方案
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+}
+
+//ReadOpenAPI 读取OpenAPI 3.0文档
+func (g *Gateway) ReadOpenAPI() string {
+	docs := &OpenAPI{
+		OpenAPI: "3.0.3",
+		Info: OpenAPIInfo{
+			Title:       g.name + "网管API文档",
+			Description: SwaggerInfo.Description,
+			Version:     SwaggerInfo.Version,
+		},
+		Servers: g.servers(),
+		Paths:   make(map[string]map[string]Operation),
+		Components: Components{
+			Schemas: make(map[string]*serviceinfo.Schema),
+			SecuritySchemes: map[string]SecurityScheme{
+				tokenSecurity: {
+					Type:        "apiKey",
+					Name:        "token",
+					In:          "header",
+					Description: "验证Token",
+				},
+			},
+		},
+	}
+	if SwaggerInfo.Title != "" {
+		docs.Info.Title = SwaggerInfo.Title
+	}
+	if docs.Info.Version == "" {
+		docs.Info.Version = "1.0"
+	}
+	g.discovery.RangeAPI(func(url string, service *serviceinfo.ServcieAPI) {
+		if service.Method.Request == nil || service.Method.Response == nil {
+			return
+		}
+		for _, s := range []*serviceinfo.Schema{service.Method.Request, service.Method.Response} {
+			for name, def := range s.Defs {
+				docs.Components.Schemas[name] = schema.Rewrite(def, componentsPrefix)
+			}
+		}
+		operation := Operation{
+			Tags:        []string{service.Explain + "[" + service.Tags + "]"},
+			Summary:     service.Method.Explain,
+			OperationID: strings.Replace(service.Name+"."+service.Method.Name+"."+service.Method.Version, "/", ".", -1),
+			Parameters:  headerParameters(),
+			Responses: map[string]Response{
+				"200": {
+					Description: "请求成功返回参数",
+					Content: map[string]MediaType{
+						"application/json": {Schema: g.envelope(schema.Rewrite(service.Method.Response, componentsPrefix))},
+					},
+				},
+			},
+		}
+		if schema.IsFile(service.Method.Response) {
+			operation.Responses["200"] = Response{
+				Description: "文件内容",
+				Content: map[string]MediaType{
+					"application/octet-stream": {Schema: &serviceinfo.Schema{Type: "string", Format: "binary"}},
+				},
+			}
+		}
+		kind := service.Method.Kind
+		if kind == string(plugins.SSE) {
+			kind = string(plugins.GET)
+			operation.Responses["200"] = Response{
+				Description: "事件流",
+				Content: map[string]MediaType{
+					"text/event-stream": {Schema: schema.Rewrite(service.Method.Response, componentsPrefix)},
+				},
+			}
+		}
+		if service.Method.IsAuth {
+			operation.Security = []map[string][]string{{tokenSecurity: []string{}}}
+		}
+		path, params := docPath(service.Method.Path)
+		operation.Parameters = append(operation.Parameters, openAPIPathParameters(service.Method.Request, params)...)
+		switch service.Method.Kind {
+		case string(plugins.POST), string(plugins.PUT), string(plugins.PATCH):
+			request := schema.Rewrite(service.Method.Request, componentsPrefix)
+			operation.RequestBody = &RequestBody{
+				Description: "请求内容",
+				Required:    true,
+				Content: map[string]MediaType{
+					"application/json":                  {Schema: request},
+					"application/x-www-form-urlencoded": {Schema: request},
+				},
+			}
+			if hasFile(service.Method.Request) {
+				operation.RequestBody.Content = map[string]MediaType{
+					"multipart/form-data": {Schema: request},
+				}
+			}
+		case string(plugins.GET), string(plugins.DELETE), string(plugins.HEAD), string(plugins.SSE):
+			operation.Parameters = append(operation.Parameters, queryParameters(service.Method.Request, params)...)
+		default:
+			return
+		}
+		value, ok := docs.Paths[path]
+		if !ok {
+			value = make(map[string]Operation)
+			docs.Paths[path] = value
+		}
+		value[strings.ToLower(kind)] = operation
+	})
+	buff, _ := json.Marshal(docs)
+	return string(buff)
+}
+
+//servers 当前网关的访问地址 读取配置文件openapi.servers 没有配置时使用相对地址,即文档所在的网关
+func (g *Gateway) servers() []OpenAPIServer {
+	c := struct {
+		OpenAPI struct {
+			Servers []OpenAPIServer `json:"servers"`
+		} `json:"openapi"`
+	}{}
+	if err := g.cfg.Unmarshal(&c); err != nil {
+		log.Traceln("读取openapi配置失败", err.Error())
+	}
+	if len(c.OpenAPI.Servers) <= 0 {
+		return []OpenAPIServer{{URL: "/", Description: g.name}}
+	}
+	for i := range c.OpenAPI.Servers {
+		if c.OpenAPI.Servers[i].Description == "" {
+			c.OpenAPI.Servers[i].Description = g.name
+		}
+	}
+	return c.OpenAPI.Servers
+}
+
+//headerParameters 公共请求头
+func headerParameters() []OpenAPIParameter {
+	return []OpenAPIParameter{
+		{
+			Name:        "timeOut",
+			In:          "header",
+			Description: "请求超时时间,单位秒",
+			Required:    true,
+			Schema:      &serviceinfo.Schema{Type: "integer"},
+		},
+		{
+			Name:        "traceID",
+			In:          "header",
+			Description: "链路请求ID",
+			Required:    true,
+			Schema:      &serviceinfo.Schema{Type: "string"},
+		},
+		{
+			Name:        "isTest",
+			In:          "header",
+			Description: "是否是测试请求",
+			Required:    true,
+			Schema:      &serviceinfo.Schema{Type: "boolean"},
+		},
+	}
+}
+
+//openAPIPathParameters 路径参数 类型从请求结构中获取
+func openAPIPathParameters(request *serviceinfo.Schema, names []string) (parameters []OpenAPIParameter) {
+	object := schema.Resolve(request, request)
+	for _, name := range names {
+		parameter := OpenAPIParameter{
+			Name:        name,
+			In:          "path",
+			Description: "路径参数",
+			Required:    true,
+			Schema:      &serviceinfo.Schema{Type: "string"},
+		}
+		if object != nil {
+			if property, ok := object.Properties[name]; ok {
+				parameter.Schema = schema.Rewrite(property, componentsPrefix)
+				if property.Description != "" {
+					parameter.Description = property.Description
+				}
+			}
+		}
+		parameters = append(parameters, parameter)
+	}
+	return
+}
+
+//queryParameters 将请求结构的字段转换为query参数 跳过路径参数
+func queryParameters(request *serviceinfo.Schema, params []string) (parameters []OpenAPIParameter) {
+	object := schema.Resolve(request, request)
+	if object == nil {
+		return
+	}
+	required := make(map[string]bool)
+	for _, name := range object.Required {
+		required[name] = true
+	}
+	skip := make(map[string]bool)
+	for _, name := range params {
+		skip[name] = true
+	}
+	names := make([]string, 0, len(object.Properties))
+	for name := range object.Properties {
+		if !skip[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property := object.Properties[name]
+		parameters = append(parameters, OpenAPIParameter{
+			Name:        name,
+			In:          "query",
+			Description: property.Description,
+			Required:    required[name],
+			Schema:      schema.Rewrite(property, componentsPrefix),
+		})
+	}
+	return
+}
+
+//envelope 网关统一返回结构 非旧版响应格式时直接返回响应内容
+func (g *Gateway) envelope(body *serviceinfo.Schema) *serviceinfo.Schema {
+	if _, ok := g.formatter.(*LegacyFormatter); !ok {
+		return body
+	}
+	return &serviceinfo.Schema{
+		Type: "object",
+		Properties: map[string]*serviceinfo.Schema{
+			"code": {Type: "integer", Description: "状态码 10000为成功", Example: 10000},
+			"body": body,
+			"time": {Type: "integer", Format: "int64", Description: "返回时间"},
+		},
+	}
+}
@@ -0,0 +1,567 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/pkg/schema"
+	"github.com/tang-go/go-dog/serviceinfo"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	//structProto google.protobuf.Value所在的文件
+	structProto = "google/protobuf/struct.proto"
+	//valueType 没有类型描述的字段使用google.protobuf.Value
+	valueType = ".google.protobuf.Value"
+	//wrapField 请求或响应不是对象时包装使用的字段
+	wrapField = "value"
+)
+
+//grpcMethod gRPC方法与API的对应关系
+type grpcMethod struct {
+	api     *serviceinfo.ServcieAPI
+	input   protoreflect.MessageDescriptor
+	output  protoreflect.MessageDescriptor
+	wrapIn  bool
+	wrapOut bool
+}
+
+//protoMethod 生成描述时记录的方法信息
+type protoMethod struct {
+	path    string
+	api     *serviceinfo.ServcieAPI
+	input   string
+	output  string
+	wrapIn  bool
+	wrapOut bool
+}
+
+//protoBuilder 将一个服务的结构描述转换为protobuf文件描述
+type protoBuilder struct {
+	file     *descriptorpb.FileDescriptorProto
+	defs     map[string]*serviceinfo.Schema
+	messages map[string]bool
+	err      error
+}
+
+//buildProto 按服务生成protobuf描述 package为服务名称,service为类名称(没有类时为Service),方法为方法名称
+func buildProto(apis []*serviceinfo.ServcieAPI) (map[string]*grpcMethod, *descriptorpb.FileDescriptorSet) {
+	services := make(map[string][]*serviceinfo.ServcieAPI)
+	for _, api := range apis {
+		services[api.Name] = append(services[api.Name], api)
+	}
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	methods := make(map[string]*grpcMethod)
+	set := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(structpb.File_google_protobuf_struct_proto)},
+	}
+	for _, name := range names {
+		apis := services[name]
+		sort.Slice(apis, func(i, j int) bool { return apis[i].Method.Name < apis[j].Method.Name })
+		pkg := protoName(name)
+		b := &protoBuilder{
+			file: &descriptorpb.FileDescriptorProto{
+				Name:       proto.String(pkg + ".proto"),
+				Package:    proto.String(pkg),
+				Syntax:     proto.String("proto3"),
+				Dependency: []string{structProto},
+			},
+			defs:     make(map[string]*serviceinfo.Schema),
+			messages: make(map[string]bool),
+		}
+		classes := make(map[string]*descriptorpb.ServiceDescriptorProto)
+		var pending []*protoMethod
+		for _, api := range apis {
+			if api.Method.Request == nil || api.Method.Response == nil {
+				continue
+			}
+			for key, def := range api.Method.Request.Defs {
+				b.defs[key] = def
+			}
+			for key, def := range api.Method.Response.Defs {
+				b.defs[key] = def
+			}
+			class, method := "Service", api.Method.Name
+			if index := strings.LastIndex(method, "."); index >= 0 {
+				class, method = method[:index], method[index+1:]
+			}
+			class, method = protoName(class), protoName(method)
+			service, ok := classes[class]
+			if !ok {
+				service = &descriptorpb.ServiceDescriptorProto{Name: proto.String(class)}
+				classes[class] = service
+				b.file.Service = append(b.file.Service, service)
+			}
+			input, wrapIn := b.root(class+method+"Request", api.Method.Request)
+			output, wrapOut := b.root(class+method+"Response", api.Method.Response)
+			service.Method = append(service.Method, &descriptorpb.MethodDescriptorProto{
+				Name:       proto.String(method),
+				InputType:  proto.String("." + pkg + "." + input),
+				OutputType: proto.String("." + pkg + "." + output),
+			})
+			pending = append(pending, &protoMethod{
+				path:    "/" + pkg + "." + class + "/" + method,
+				api:     api,
+				input:   input,
+				output:  output,
+				wrapIn:  wrapIn,
+				wrapOut: wrapOut,
+			})
+		}
+		if b.err != nil {
+			//字段编号不完整时不注册 避免编号变化后与调用方的生成代码不兼容
+			log.Errorf("grpc 描述生成失败 | %s | %s ", name, b.err.Error())
+			continue
+		}
+		fd, err := protodesc.NewFile(b.file, protoregistry.GlobalFiles)
+		if err != nil {
+			log.Errorf("grpc 描述生成失败 | %s | %s ", name, err.Error())
+			continue
+		}
+		set.File = append(set.File, b.file)
+		for _, p := range pending {
+			methods[p.path] = &grpcMethod{
+				api:     p.api,
+				input:   fd.Messages().ByName(protoreflect.Name(p.input)),
+				output:  fd.Messages().ByName(protoreflect.Name(p.output)),
+				wrapIn:  p.wrapIn,
+				wrapOut: p.wrapOut,
+			}
+		}
+	}
+	return methods, set
+}
+
+//root 请求或响应的消息 不是对象时包装在value字段中
+func (b *protoBuilder) root(name string, s *serviceinfo.Schema) (string, bool) {
+	if s.Ref != "" {
+		if def := schema.Resolve(s, s); def != nil && def.Type == "object" && def.AdditionalProperties == nil {
+			return b.ref(s.Ref), false
+		}
+	}
+	if s.Type == "object" && s.AdditionalProperties == nil {
+		b.message(name, s)
+		return name, false
+	}
+	if !b.messages[name] {
+		b.messages[name] = true
+		msg := &descriptorpb.DescriptorProto{Name: proto.String(name)}
+		b.file.MessageType = append(b.file.MessageType, msg)
+		msg.Field = append(msg.Field, b.field(msg, wrapField, 1, s))
+	}
+	return name, true
+}
+
+//ref 引用的结构定义对应的消息名称
+func (b *protoBuilder) ref(ref string) string {
+	key := strings.TrimPrefix(ref, schema.RefPrefix)
+	name := protoName(key)
+	if def, ok := b.defs[key]; ok {
+		b.message(name, def)
+	}
+	return name
+}
+
+//message 生成消息 所有消息都定义在文件顶层
+//字段编号使用结构体字段的pb或者protobuf标签 缺少或者重复时不生成该服务的描述
+func (b *protoBuilder) message(name string, s *serviceinfo.Schema) {
+	if b.messages[name] {
+		return
+	}
+	b.messages[name] = true
+	msg := &descriptorpb.DescriptorProto{Name: proto.String(name)}
+	b.file.MessageType = append(b.file.MessageType, msg)
+	keys := make([]string, 0, len(s.Properties))
+	numbers := make(map[int32]string)
+	for key, property := range s.Properties {
+		number := property.Field
+		if number <= 0 {
+			b.fail(fmt.Errorf("%s.%s缺少protobuf字段编号", name, key))
+			continue
+		}
+		if other, ok := numbers[number]; ok {
+			b.fail(fmt.Errorf("%s.%s与%s的protobuf字段编号%d重复", name, key, other, number))
+			continue
+		}
+		numbers[number] = key
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return s.Properties[keys[i]].Field < s.Properties[keys[j]].Field })
+	for _, key := range keys {
+		msg.Field = append(msg.Field, b.field(msg, key, s.Properties[key].Field, s.Properties[key]))
+	}
+}
+
+//fail 记录第一个错误
+func (b *protoBuilder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+//field 生成字段 字段的json名称为结构描述中的属性名称
+func (b *protoBuilder) field(owner *descriptorpb.DescriptorProto, key string, number int32, s *serviceinfo.Schema) *descriptorpb.FieldDescriptorProto {
+	field := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(protoName(key)),
+		JsonName: proto.String(key),
+		Number:   proto.Int32(number),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+	switch {
+	case s.Type == "array" && s.Items != nil && s.Items.Type != "array" && !isMap(s.Items):
+		field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		b.fieldType(field, owner.GetName()+"_"+protoName(key), s.Items)
+	case isMap(s):
+		entry := &descriptorpb.DescriptorProto{
+			Name:    proto.String(mapEntryName(field.GetName())),
+			Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("key"),
+					JsonName: proto.String("key"),
+					Number:   proto.Int32(1),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				},
+			},
+		}
+		value := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String("value"),
+			JsonName: proto.String("value"),
+			Number:   proto.Int32(2),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		if s.AdditionalProperties.Type == "array" || isMap(s.AdditionalProperties) {
+			value.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+			value.TypeName = proto.String(valueType)
+		} else {
+			b.fieldType(value, owner.GetName()+"_"+protoName(key), s.AdditionalProperties)
+		}
+		entry.Field = append(entry.Field, value)
+		owner.NestedType = append(owner.NestedType, entry)
+		field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		field.TypeName = proto.String("." + b.file.GetPackage() + "." + owner.GetName() + "." + entry.GetName())
+	default:
+		b.fieldType(field, owner.GetName()+"_"+protoName(key), s)
+	}
+	return field
+}
+
+//fieldType 设置字段类型
+func (b *protoBuilder) fieldType(field *descriptorpb.FieldDescriptorProto, name string, s *serviceinfo.Schema) {
+	if s.Ref != "" {
+		field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		field.TypeName = proto.String("." + b.file.GetPackage() + "." + b.ref(s.Ref))
+		return
+	}
+	switch s.Type {
+	case "boolean":
+		field.Type = descriptorpb.FieldDescriptorProto_TYPE_BOOL.Enum()
+	case "integer":
+		field.Type = descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum()
+		if s.Format == "int32" {
+			field.Type = descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum()
+		}
+	case "number":
+		field.Type = descriptorpb.FieldDescriptorProto_TYPE_DOUBLE.Enum()
+		if s.Format == "float" {
+			field.Type = descriptorpb.FieldDescriptorProto_TYPE_FLOAT.Enum()
+		}
+	case "string":
+		field.Type = descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+		if s.Format == "binary" || s.Format == "byte" {
+			field.Type = descriptorpb.FieldDescriptorProto_TYPE_BYTES.Enum()
+		}
+	case "object":
+		if len(s.Properties) > 0 {
+			b.message(name, s)
+			field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+			field.TypeName = proto.String("." + b.file.GetPackage() + "." + name)
+			return
+		}
+		field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		field.TypeName = proto.String(valueType)
+	default:
+		field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		field.TypeName = proto.String(valueType)
+	}
+}
+
+//isMap 是否为map结构
+func isMap(s *serviceinfo.Schema) bool {
+	return s.Type == "object" && s.AdditionalProperties != nil && len(s.Properties) <= 0
+}
+
+//protoName 转换为protobuf标识符
+func protoName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	s := b.String()
+	if s == "" || unicode.IsDigit(rune(s[0])) {
+		s = "_" + s
+	}
+	return s
+}
+
+//mapEntryName map字段对应的entry名称 与protoc的规则一致
+func mapEntryName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String() + "Entry"
+}
+
+//decode 将protobuf请求转换为json
+func (m *grpcMethod) decode(data []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(m.input)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	value := messageToJSON(msg)
+	if m.wrapIn {
+		return json.Marshal(value[wrapField])
+	}
+	return json.Marshal(value)
+}
+
+//encode 将json响应转换为protobuf
+func (m *grpcMethod) encode(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if m.wrapOut {
+		value = map[string]interface{}{wrapField: value}
+	}
+	msg := dynamicpb.NewMessage(m.output)
+	object, _ := value.(map[string]interface{})
+	if err := messageFromJSON(msg, object); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(msg)
+}
+
+//messageToJSON protobuf消息转换为json对象 proto3不区分零值与未设置 基础类型字段总是输出
+func messageToJSON(msg protoreflect.Message) map[string]interface{} {
+	value := make(map[string]interface{})
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		v := msg.Get(fd)
+		switch {
+		case fd.IsList():
+			list := v.List()
+			items := make([]interface{}, 0, list.Len())
+			for i := 0; i < list.Len(); i++ {
+				items = append(items, valueToJSON(fd, list.Get(i)))
+			}
+			value[fd.JSONName()] = items
+		case fd.IsMap():
+			items := make(map[string]interface{})
+			v.Map().Range(func(key protoreflect.MapKey, v protoreflect.Value) bool {
+				items[key.String()] = valueToJSON(fd.MapValue(), v)
+				return true
+			})
+			value[fd.JSONName()] = items
+		case fd.Kind() == protoreflect.MessageKind && !msg.Has(fd):
+			continue
+		default:
+			value[fd.JSONName()] = valueToJSON(fd, v)
+		}
+	}
+	return value
+}
+
+//valueToJSON protobuf字段值转换为json值
+func valueToJSON(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if fd.Message().FullName().Parent() == "google.protobuf" {
+			buff, err := protojson.Marshal(v.Message().Interface())
+			if err != nil {
+				return nil
+			}
+			return json.RawMessage(buff)
+		}
+		return messageToJSON(v.Message())
+	case protoreflect.BytesKind:
+		return v.Bytes()
+	default:
+		return v.Interface()
+	}
+}
+
+//messageFromJSON json对象写入protobuf消息
+func messageFromJSON(msg protoreflect.Message, value map[string]interface{}) error {
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		v, ok := value[fd.JSONName()]
+		if !ok {
+			v, ok = value[string(fd.Name())]
+		}
+		if !ok || v == nil {
+			continue
+		}
+		switch {
+		case fd.IsList():
+			items, ok := v.([]interface{})
+			if !ok {
+				return fmt.Errorf("%s必须为数组", fd.JSONName())
+			}
+			list := msg.Mutable(fd).List()
+			for _, item := range items {
+				if fd.Kind() == protoreflect.MessageKind {
+					element := list.NewElement()
+					if err := valueFromJSON(fd, element.Message(), item); err != nil {
+						return err
+					}
+					list.Append(element)
+					continue
+				}
+				element, err := scalarFromJSON(fd, item)
+				if err != nil {
+					return err
+				}
+				list.Append(element)
+			}
+		case fd.IsMap():
+			items, ok := v.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s必须为对象", fd.JSONName())
+			}
+			m := msg.Mutable(fd).Map()
+			for key, item := range items {
+				if fd.MapValue().Kind() == protoreflect.MessageKind {
+					element := m.NewValue()
+					if err := valueFromJSON(fd.MapValue(), element.Message(), item); err != nil {
+						return err
+					}
+					m.Set(protoreflect.ValueOfString(key).MapKey(), element)
+					continue
+				}
+				element, err := scalarFromJSON(fd.MapValue(), item)
+				if err != nil {
+					return err
+				}
+				m.Set(protoreflect.ValueOfString(key).MapKey(), element)
+			}
+		case fd.Kind() == protoreflect.MessageKind:
+			if err := valueFromJSON(fd, msg.Mutable(fd).Message(), v); err != nil {
+				return err
+			}
+		default:
+			element, err := scalarFromJSON(fd, v)
+			if err != nil {
+				return err
+			}
+			msg.Set(fd, element)
+		}
+	}
+	return nil
+}
+
+//valueFromJSON json值写入protobuf消息字段
+func valueFromJSON(fd protoreflect.FieldDescriptor, msg protoreflect.Message, v interface{}) error {
+	if fd.Message().FullName().Parent() == "google.protobuf" {
+		buff, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return protojson.Unmarshal(buff, msg.Interface())
+	}
+	object, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s必须为对象", fd.JSONName())
+	}
+	return messageFromJSON(msg, object)
+}
+
+//scalarFromJSON json值转换为protobuf基础类型
+func scalarFromJSON(fd protoreflect.FieldDescriptor, v interface{}) (protoreflect.Value, error) {
+	text := fmt.Sprint(v)
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("%s必须为布尔值", fd.JSONName())
+		}
+		return protoreflect.ValueOfBool(b), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(text, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("%s必须为整数", fd.JSONName())
+		}
+		return protoreflect.ValueOfInt32(int32(n)), nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("%s必须为整数", fd.JSONName())
+		}
+		return protoreflect.ValueOfInt64(n), nil
+	case protoreflect.FloatKind:
+		n, err := strconv.ParseFloat(text, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("%s必须为数字", fd.JSONName())
+		}
+		return protoreflect.ValueOfFloat32(float32(n)), nil
+	case protoreflect.DoubleKind:
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("%s必须为数字", fd.JSONName())
+		}
+		return protoreflect.ValueOfFloat64(n), nil
+	case protoreflect.BytesKind:
+		b, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("%s必须为base64编码", fd.JSONName())
+		}
+		return protoreflect.ValueOfBytes(b), nil
+	case protoreflect.StringKind:
+		if s, ok := v.(string); ok {
+			return protoreflect.ValueOfString(s), nil
+		}
+		buff, _ := json.Marshal(v)
+		return protoreflect.ValueOfString(string(buff)), nil
+	default:
+		return protoreflect.Value{}, fmt.Errorf("%s类型不支持", fd.JSONName())
+	}
+}
@@ -0,0 +1,127 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/metrics"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+const (
+	//sseTimeout SSE请求默认超时时间,单位秒
+	sseTimeout = 24 * 60 * 60
+	//sseHeartbeat SSE心跳间隔
+	sseHeartbeat = 15 * time.Second
+)
+
+//sseEvent 服务返回的事件
+type sseEvent struct {
+	ID    string          `json:"id"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+	Retry int             `json:"retry"`
+}
+
+//sse 将服务的流式响应以text/event-stream返回 客户端断开时取消服务端的请求
+func (g *Gateway) sse(c *gin.Context, ctx plugins.Context, apiservice *serviceinfo.ServcieAPI, body []byte) {
+	defer ctx.Cancel()
+	url := ctx.GetURL()
+	lastEventID := c.Request.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	if lastEventID != "" {
+		ctx.SetData(plugins.LastEventIDKey, lastEventID)
+	}
+	metrics.MetricRequestBytes(g.name, url, float64(len(body)))
+	replies, err := g.GetClient().Stream(ctx, plugins.RandomMode, apiservice.Name, "", apiservice.Method.Name, "json", body)
+	if err != nil {
+		g.failRPC(c, customerror.DeCodeError(err))
+		return
+	}
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		g.fail(c, customerror.EnCodeError(customerror.InternalServerError, "不支持流式响应"))
+		return
+	}
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	flusher.Flush()
+	ticker := time.NewTicker(sseHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			log.Tracef("sse 客户端断开 | %s | %s ", c.ClientIP(), url)
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case reply, ok := <-replies:
+			if !ok {
+				return
+			}
+			if reply.Error != nil {
+				e := customerror.DeCodeError(reply.Error)
+				data, _ := json.Marshal(e)
+				fmt.Fprintf(c.Writer, "event: error\ndata: %s\n\n", data)
+				flusher.Flush()
+				return
+			}
+			metrics.MetricResponseBytes(g.name, url, float64(len(reply.Reply)))
+			event := new(sseEvent)
+			if err := json.Unmarshal(reply.Reply, event); err != nil {
+				log.Errorln(err.Error())
+				continue
+			}
+			if _, err := c.Writer.WriteString(encodeEvent(event)); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+//encodeEvent 编码为text/event-stream格式
+func encodeEvent(event *sseEvent) string {
+	var b strings.Builder
+	if event.ID != "" {
+		b.WriteString("id: " + singleLine(event.ID) + "\n")
+	}
+	if event.Event != "" {
+		b.WriteString("event: " + singleLine(event.Event) + "\n")
+	}
+	if event.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", event.Retry)
+	}
+	data := string(event.Data)
+	if data == "" {
+		data = "null"
+	}
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+//singleLine 去掉换行 防止注入额外的字段
+func singleLine(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
@@ -0,0 +1,390 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/lib/uuid"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/metrics"
+	"github.com/tang-go/go-dog/pkg/auth"
+	"github.com/tang-go/go-dog/pkg/context"
+	"github.com/tang-go/go-dog/pkg/schema"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/recover"
+)
+
+const (
+	//WebSocketUserKey 验证函数通过ctx.SetData设置的用户标识 未设置时使用身份信息的Subject
+	//没有验证过的用户标识时只能按连接ID推送
+	WebSocketUserKey = "UserID"
+	//wsWriteWait 写消息超时时间
+	wsWriteWait = 10 * time.Second
+	//wsPongWait 等待pong的超时时间
+	wsPongWait = 60 * time.Second
+	//wsPingPeriod 发送ping的间隔
+	wsPingPeriod = wsPongWait * 9 / 10
+	//wsSendSize 每个连接的发送队列长度
+	wsSendSize = 256
+	//wsConcurrent 每个连接同时处理的请求数量 超过时暂停读取消息
+	wsConcurrent = 8
+)
+
+//wsRequest websocket客户端请求 路由到网关注册的API
+type wsRequest struct {
+	ID      string          `json:"id"`      //请求ID 原样返回
+	Method  string          `json:"method"`  //请求类型 默认POST
+	URL     string          `json:"url"`     //API路径
+	TimeOut int             `json:"timeOut"` //超时时间,单位秒
+	Body    json.RawMessage `json:"body"`    //请求内容
+}
+
+//wsResponse websocket返回给客户端的消息
+type wsResponse struct {
+	ID    string      `json:"id,omitempty"`    //请求ID
+	Event string      `json:"event,omitempty"` //推送事件名称
+	Code  int         `json:"code"`            //状态码 10000为成功
+	Msg   string      `json:"msg,omitempty"`   //错误信息
+	Body  interface{} `json:"body,omitempty"`  //返回内容
+	Time  int64       `json:"time"`            //返回时间
+}
+
+//wsConn websocket连接
+type wsConn struct {
+	id      string
+	user    string
+	token   string
+	address string
+	isTest  bool
+	data    map[string][]byte
+	conn    *websocket.Conn
+	send    chan []byte
+	closed  chan struct{}
+	once    sync.Once
+}
+
+//close 关闭连接
+func (c *wsConn) close() {
+	c.once.Do(func() {
+		close(c.closed)
+		c.conn.Close()
+	})
+}
+
+//write 将消息放入发送队列 队列满时丢弃
+func (c *wsConn) write(msg []byte) bool {
+	select {
+	case <-c.closed:
+		return false
+	case c.send <- msg:
+		return true
+	default:
+		log.Warnf("websocket 发送队列已满 | %s | %s ", c.id, c.user)
+		return false
+	}
+}
+
+//wsHub websocket连接管理
+type wsHub struct {
+	conns map[string]*wsConn
+	users map[string]map[string]*wsConn
+	lock  sync.RWMutex
+}
+
+func newWSHub() *wsHub {
+	return &wsHub{
+		conns: make(map[string]*wsConn),
+		users: make(map[string]map[string]*wsConn),
+	}
+}
+
+//add 添加连接
+func (h *wsHub) add(c *wsConn) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.conns[c.id] = c
+	if c.user == "" {
+		return
+	}
+	conns, ok := h.users[c.user]
+	if !ok {
+		conns = make(map[string]*wsConn)
+		h.users[c.user] = conns
+	}
+	conns[c.id] = c
+}
+
+//remove 删除连接
+func (h *wsHub) remove(c *wsConn) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.conns, c.id)
+	if conns, ok := h.users[c.user]; ok {
+		delete(conns, c.id)
+		if len(conns) <= 0 {
+			delete(h.users, c.user)
+		}
+	}
+}
+
+//find 查找推送目标
+func (h *wsHub) find(user, id string) (conns []*wsConn) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if id != "" {
+		if c, ok := h.conns[id]; ok && (user == "" || c.user == user) {
+			conns = append(conns, c)
+		}
+		return
+	}
+	if user != "" {
+		for _, c := range h.users[user] {
+			conns = append(conns, c)
+		}
+		return
+	}
+	for _, c := range h.conns {
+		conns = append(conns, c)
+	}
+	return
+}
+
+//WebSocket 开启websocket 客户端消息路由到网关注册的API 后端服务通过网关的WebSocket.Push RPC推送消息
+func (g *Gateway) WebSocket(path string) {
+	g.wsPath = path
+}
+
+//pushMessage 推送消息到当前网关实例上的连接
+func (g *Gateway) pushMessage(ctx plugins.Context, msg *plugins.PushMessage) (*plugins.PushReply, error) {
+	if err := g.rpcCaller(ctx); err != nil {
+		return nil, err
+	}
+	resp := &wsResponse{
+		Event: msg.Event,
+		Code:  10000,
+		Time:  time.Now().Unix(),
+	}
+	if len(msg.Data) > 0 {
+		resp.Body = json.RawMessage(msg.Data)
+	}
+	buff, err := json.Marshal(resp)
+	if err != nil {
+		return nil, customerror.EnCodeError(customerror.ParamError, err.Error())
+	}
+	reply := new(plugins.PushReply)
+	for _, c := range g.ws.find(msg.User, msg.Conn) {
+		if c.write(buff) {
+			reply.Count++
+		}
+	}
+	log.Tracef("websocket 推送 | %s | %s | %s | %d ", msg.Event, msg.User, msg.Conn, reply.Count)
+	return reply, nil
+}
+
+//serveWebSocket 建立websocket连接 连接时验证token
+func (g *Gateway) serveWebSocket(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		token = c.Request.Header.Get("token")
+	}
+	isTest, _ := strconv.ParseBool(c.Query("isTest"))
+	ctx := context.Background()
+	ctx.SetAddress(c.ClientIP())
+	ctx.SetIsTest(isTest)
+	ctx.SetTraceID(uuid.GetToken())
+	ctx.SetURL(g.wsPath)
+	ctx.SetClient(g.GetClient())
+	if g.authfunc != nil || g.authenticator != nil {
+		if err := g.authenticate(ctx, token, g.wsPath, nil); err != nil {
+			g.fail(c, err)
+			return
+		}
+	}
+	var user string
+	ctx.GetDataByKey(WebSocketUserKey, &user)
+	if claims, ok := auth.Claims(ctx); ok && user == "" {
+		user = claims.Subject
+	}
+	upgrader := websocket.Upgrader{
+		//按跨域策略检查来源
+		CheckOrigin: g.cors.CheckOrigin,
+	}
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Traceln(err.Error())
+		return
+	}
+	conn := &wsConn{
+		id:      uuid.GetToken(),
+		user:    user,
+		token:   token,
+		address: c.ClientIP(),
+		isTest:  isTest,
+		data:    ctx.GetData(),
+		conn:    ws,
+		send:    make(chan []byte, wsSendSize),
+		closed:  make(chan struct{}),
+	}
+	g.ws.add(conn)
+	metrics.MetricServiceRun(g.name+"_websocket", 1)
+	log.Tracef("websocket 连接 | %s | %s | %s ", conn.id, conn.user, conn.address)
+	defer func() {
+		g.ws.remove(conn)
+		conn.close()
+		metrics.MetricServiceRun(g.name+"_websocket", -1)
+		log.Tracef("websocket 断开 | %s | %s | %s ", conn.id, conn.user, conn.address)
+	}()
+	go g.wsWrite(conn)
+	ws.SetReadDeadline(time.Now().Add(wsPongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	ws.SetReadLimit(g.cfg.GetMaxUploadSize())
+	//告诉客户端连接ID
+	conn.write(g.wsEncode(&wsResponse{Event: "connected", Code: 10000, Body: gin.H{"conn": conn.id}}))
+	//限制每个连接同时处理的请求数量
+	sem := make(chan struct{}, wsConcurrent)
+	for {
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Traceln(err.Error())
+			}
+			return
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-conn.closed:
+			return
+		}
+		go func() {
+			defer func() { <-sem }()
+			g.wsHandle(conn, msg)
+		}()
+	}
+}
+
+//wsWrite 发送消息以及心跳
+func (g *Gateway) wsWrite(conn *wsConn) {
+	defer recover.Recover()
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-conn.closed:
+			return
+		case msg := <-conn.send:
+			conn.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				log.Traceln(err.Error())
+				conn.close()
+				return
+			}
+		case <-ticker.C:
+			conn.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				conn.close()
+				return
+			}
+		}
+	}
+}
+
+//wsHandle 处理客户端请求
+func (g *Gateway) wsHandle(conn *wsConn, msg []byte) {
+	defer recover.Recover()
+	request := new(wsRequest)
+	if err := json.Unmarshal(msg, request); err != nil {
+		conn.write(g.wsError("", customerror.EnCodeError(customerror.ParamError, err.Error())))
+		return
+	}
+	back, err := g.wsCall(conn, request)
+	if err != nil {
+		conn.write(g.wsError(request.ID, err))
+		return
+	}
+	var resp interface{}
+	g.GetClient().GetCodec().DeCode("json", back, &resp)
+	conn.write(g.wsEncode(&wsResponse{ID: request.ID, Code: 10000, Body: resp}))
+}
+
+//wsCall 将客户端请求路由到API
+func (g *Gateway) wsCall(conn *wsConn, request *wsRequest) ([]byte, error) {
+	method := strings.ToUpper(request.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	apiservice, params, ok := g.discovery.GetAPIByURL(method, request.URL)
+	if !ok {
+		return nil, customerror.EnCodeError(http.StatusNotFound, "路由URL错误")
+	}
+	if schema.IsFile(apiservice.Method.Response) {
+		return nil, customerror.EnCodeError(customerror.ParamError, "websocket不支持文件响应")
+	}
+	body := []byte(request.Body)
+	if len(body) <= 0 || string(body) == "null" {
+		body = []byte("{}")
+	}
+	body, errs := g.bind(body, apiservice.Method.Request, params)
+	if len(errs) > 0 {
+		return nil, customerror.EnCodeError(customerror.ParamError, errs.Error())
+	}
+	if errs := schema.ValidateJSON(apiservice.Method.Request, body); len(errs) > 0 {
+		return nil, customerror.EnCodeError(customerror.ParamError, errs.Error())
+	}
+	timeout := request.TimeOut
+	if timeout <= 0 {
+		timeout = 6
+	}
+	datas := make(map[string][]byte)
+	for key, value := range conn.data {
+		datas[key] = value
+	}
+	ctx := context.NewContextByData(datas)
+	ctx.SetAddress(conn.address)
+	ctx.SetIsTest(conn.isTest)
+	ctx.SetTraceID(uuid.GetToken())
+	ctx.SetToken(conn.token)
+	ctx.SetURL(request.URL)
+	ctx.SetClient(g.GetClient())
+	ctx = context.WithTimeout(ctx, int64(time.Second*time.Duration(timeout)))
+	defer ctx.Cancel()
+	//开启追踪
+	if span, err := g.jaeger.StartSpan(ctx, request.URL); err == nil {
+		//请求内容脱敏后记录
+		span.LogKV("request", string(g.masker.JSON(body, apiservice.Method.Request)))
+		defer span.Finish()
+	}
+	//API key签名需要原始http请求 只允许签名访问的路由不能通过websocket访问
+	if g.signOnly(request.URL) {
+		return nil, customerror.EnCodeError(customerror.Unauthorized, "该接口只允许API key签名访问")
+	}
+	//每次请求重新验证 连接期间token可能过期
+	if apiservice.Method.IsAuth {
+		if err := g.authenticate(ctx, conn.token, request.URL, apiservice.Method); err != nil {
+			return nil, err
+		}
+	}
+	e := &plugins.Exchange{Ctx: ctx, URL: request.URL, Service: apiservice.Name, API: apiservice.Method, Params: params, Request: body}
+	return g.exchange(e, apiservice)
+}
+
+//wsError 错误消息
+func (g *Gateway) wsError(id string, err error) []byte {
+	e := customerror.DeCodeError(err)
+	return g.wsEncode(&wsResponse{ID: id, Code: e.Code, Msg: e.Msg})
+}
+
+//wsEncode 编码消息
+func (g *Gateway) wsEncode(resp *wsResponse) []byte {
+	resp.Time = time.Now().Unix()
+	buff, _ := json.Marshal(resp)
+	return buff
+}
@@ -0,0 +1,402 @@
+package mask
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/pkg/schema"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+const (
+	//All 全部替换
+	All = "all"
+	//Phone 手机号 保留前3位以及后4位
+	Phone = "phone"
+	//ID 身份证号 保留前3位以及后4位
+	ID = "id"
+	//Email 邮箱 保留第一个字符以及域名
+	Email = "email"
+	//Name 姓名 保留第一个字
+	Name = "name"
+)
+
+//stars 全部替换使用的字符串
+const stars = "******"
+
+//定义时间类型
+var typeOfTime = reflect.TypeOf(time.Time{})
+
+//tagged 是否出现过带有sensitive标签的类型 没有配置字段名称并且没有出现过时interface{}不需要脱敏
+var tagged int32
+
+//typeKey 类型是否需要脱敏的缓存key interface{}的结果与是否出现过sensitive标签有关
+type typeKey struct {
+	t      reflect.Type
+	tagged bool
+}
+
+//rules 脱敏规则
+var rules = map[string]func(value string) string{
+	All:   func(string) string { return stars },
+	Phone: func(value string) string { return keep(value, 3, 4) },
+	ID:    func(value string) string { return keep(value, 3, 4) },
+	Email: email,
+	Name:  func(value string) string { return keep(value, 1, 0) },
+}
+
+//rulesLock 脱敏规则锁
+var rulesLock sync.RWMutex
+
+//Register 注册自定义脱敏规则 字段标签sensitive:"规则名称"使用
+func Register(rule string, f func(value string) string) {
+	rulesLock.Lock()
+	rules[rule] = f
+	rulesLock.Unlock()
+}
+
+//Mask 按规则脱敏 true以及未知的规则全部替换
+func Mask(rule, value string) string {
+	rulesLock.RLock()
+	f, ok := rules[rule]
+	rulesLock.RUnlock()
+	if !ok {
+		return stars
+	}
+	return f(value)
+}
+
+//maskConfig 配置文件中的mask字段
+type maskConfig struct {
+	//按字段名称脱敏 字段名称(json名称 不区分大小写)对应脱敏规则 例如{"password":"all","mobile":"phone"}
+	Fields map[string]string `json:"fields"`
+}
+
+//Masker 敏感字段脱敏 支持字段标签sensitive以及配置的字段名称 配置变化时重新加载
+type Masker struct {
+	fields map[string]string
+	types  *sync.Map
+	lock   sync.RWMutex
+}
+
+//NewMasker 创建脱敏 读取配置的mask字段
+func NewMasker(cfg plugins.Cfg) *Masker {
+	m := new(Masker)
+	m.load(cfg)
+	cfg.Listen(func() {
+		m.load(cfg)
+	})
+	return m
+}
+
+//load 加载配置
+func (m *Masker) load(cfg plugins.Cfg) {
+	c := struct {
+		Mask maskConfig `json:"mask"`
+	}{}
+	if err := cfg.Unmarshal(&c); err != nil {
+		log.Traceln("读取mask配置失败", err.Error())
+	}
+	fields := make(map[string]string)
+	for name, rule := range c.Mask.Fields {
+		fields[strings.ToLower(name)] = rule
+	}
+	m.lock.Lock()
+	m.fields = fields
+	//字段配置变化后重新判断类型是否需要脱敏
+	m.types = new(sync.Map)
+	m.lock.Unlock()
+}
+
+//config 获取当前配置
+func (m *Masker) config() (map[string]string, *sync.Map) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.fields, m.types
+}
+
+//Value 复制并脱敏 返回与v类型相同的值 没有敏感字段时直接返回v
+func (m *Masker) Value(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	fields, types := m.config()
+	value := reflect.ValueOf(v)
+	if !needs(value.Type(), fields, types, make(map[reflect.Type]bool)) {
+		return v
+	}
+	return m.copy(value, fields, types).Interface()
+}
+
+//String 脱敏后的json字符串 用于日志以及链路追踪
+func (m *Masker) String(v interface{}) string {
+	data, err := json.Marshal(m.Value(v))
+	if err != nil {
+		return fmt.Sprintf("%T", v)
+	}
+	return string(data)
+}
+
+//JSON 按结构描述以及配置的字段名称脱敏json 用于网关转发的请求以及响应
+func (m *Masker) JSON(data []byte, root *serviceinfo.Schema) []byte {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return data
+	}
+	fields, _ := m.config()
+	masked, err := json.Marshal(walk(value, root, root, fields))
+	if err != nil {
+		return data
+	}
+	return masked
+}
+
+//copy 深复制并替换敏感字段
+func (m *Masker) copy(v reflect.Value, fields map[string]string, types *sync.Map) reflect.Value {
+	if !v.IsValid() || !needs(v.Type(), fields, types, make(map[reflect.Type]bool)) {
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.New(v.Type().Elem())
+		n.Elem().Set(m.copy(v.Elem(), fields, types))
+		return n
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.New(v.Type()).Elem()
+		n.Set(m.copy(v.Elem(), fields, types))
+		return n
+	case reflect.Struct:
+		n := reflect.New(v.Type()).Elem()
+		n.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if rule := fieldRule(field, fields); rule != "" {
+				n.Field(i).Set(replace(rule, v.Field(i)))
+				continue
+			}
+			n.Field(i).Set(m.copy(v.Field(i), fields, types))
+		}
+		return n
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			n.Index(i).Set(m.copy(v.Index(i), fields, types))
+		}
+		return n
+	case reflect.Array:
+		n := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			n.Index(i).Set(m.copy(v.Index(i), fields, types))
+		}
+		return n
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key()
+			if key.Kind() == reflect.String {
+				if rule, ok := fields[strings.ToLower(key.String())]; ok {
+					n.SetMapIndex(key, replace(rule, iter.Value()))
+					continue
+				}
+			}
+			n.SetMapIndex(key, m.copy(iter.Value(), fields, types))
+		}
+		return n
+	}
+	return v
+}
+
+//needs 类型是否包含需要脱敏的字段 结果按类型缓存
+func needs(t reflect.Type, fields map[string]string, types *sync.Map, visiting map[reflect.Type]bool) bool {
+	key := typeKey{t: t, tagged: atomic.LoadInt32(&tagged) > 0}
+	if result, ok := types.Load(key); ok {
+		return result.(bool)
+	}
+	if visiting[t] {
+		//递归类型在外层判断
+		return false
+	}
+	visiting[t] = true
+	result := false
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		result = needs(t.Elem(), fields, types, visiting)
+	case reflect.Interface:
+		//具体类型在复制时判断 只有配置了字段名称或者出现过sensitive标签时才可能需要脱敏
+		result = len(fields) > 0 || key.tagged
+	case reflect.Map:
+		result = (t.Key().Kind() == reflect.String && len(fields) > 0) || needs(t.Elem(), fields, types, visiting)
+	case reflect.Struct:
+		if t == typeOfTime {
+			break
+		}
+		for i := 0; i < t.NumField() && !result; i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if rule := field.Tag.Get("sensitive"); rule != "" && rule != "false" {
+				atomic.StoreInt32(&tagged, 1)
+			}
+			result = fieldRule(field, fields) != "" || needs(field.Type, fields, types, visiting)
+		}
+	}
+	delete(visiting, t)
+	if len(visiting) <= 0 {
+		//递归类型的中间结果不缓存
+		types.Store(key, result)
+	}
+	return result
+}
+
+//fieldRule 字段的脱敏规则 优先使用sensitive标签 其次使用配置的字段名称
+func fieldRule(field reflect.StructField, fields map[string]string) string {
+	switch rule := field.Tag.Get("sensitive"); rule {
+	case "", "false":
+	case "true":
+		return All
+	default:
+		return rule
+	}
+	name := field.Tag.Get("json")
+	if index := strings.Index(name, ","); index >= 0 {
+		name = name[:index]
+	}
+	if name == "" || name == "-" {
+		name = field.Name
+	}
+	return fields[strings.ToLower(name)]
+}
+
+//replace 替换敏感值 字符串按规则脱敏 其他类型使用零值
+func replace(rule string, v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(Mask(rule, v.String())).Convert(v.Type())
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.New(v.Type().Elem())
+		n.Elem().Set(replace(rule, v.Elem()))
+		return n
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.New(v.Type()).Elem()
+		if v.Type().NumMethod() == 0 {
+			//interface{}中的数字等类型转换为脱敏后的字符串
+			n.Set(reflect.ValueOf(Mask(rule, fmt.Sprint(v.Elem().Interface()))))
+		} else {
+			n.Set(replace(rule, v.Elem()))
+		}
+		return n
+	}
+	return reflect.Zero(v.Type())
+}
+
+//walk 按结构描述脱敏json解析后的值
+func walk(value interface{}, root, s *serviceinfo.Schema, fields map[string]string) interface{} {
+	s = schema.Resolve(root, s)
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			var property *serviceinfo.Schema
+			if s != nil {
+				if property = s.Properties[key]; property == nil {
+					property = s.AdditionalProperties
+				}
+			}
+			if rule := schemaRule(property, key, fields); rule != "" {
+				v[key] = maskJSON(rule, item)
+				continue
+			}
+			v[key] = walk(item, root, property, fields)
+		}
+	case []interface{}:
+		var items *serviceinfo.Schema
+		if s != nil {
+			items = s.Items
+		}
+		for i, item := range v {
+			v[i] = walk(item, root, items, fields)
+		}
+	}
+	return value
+}
+
+//schemaRule json字段的脱敏规则 优先使用结构描述 其次使用配置的字段名称
+func schemaRule(s *serviceinfo.Schema, key string, fields map[string]string) string {
+	if s != nil {
+		switch s.Sensitive {
+		case "", "false":
+		case "true":
+			return All
+		default:
+			return s.Sensitive
+		}
+	}
+	return fields[strings.ToLower(key)]
+}
+
+//maskJSON 脱敏json的值 对象以及数组全部替换
+func maskJSON(rule string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return Mask(rule, v)
+	case json.Number, bool:
+		return Mask(rule, fmt.Sprint(v))
+	}
+	return stars
+}
+
+//keep 保留前head个以及后tail个字符 其余替换为*
+func keep(value string, head, tail int) string {
+	runes := []rune(value)
+	if len(runes) <= head+tail {
+		if len(runes) <= 1 {
+			return stars
+		}
+		//长度不够时只保留第一个字符
+		head, tail = 1, 0
+	}
+	return string(runes[:head]) + strings.Repeat("*", len(runes)-head-tail) + string(runes[len(runes)-tail:])
+}
+
+//email 邮箱保留第一个字符以及域名
+func email(value string) string {
+	index := strings.LastIndex(value, "@")
+	if index <= 0 {
+		return keep(value, 1, 0)
+	}
+	return keep(value[:index], 1, 0) + value[index:]
+}
@@ -0,0 +1,287 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/plugins"
+)
+
+//defaultReload 默认证书检查间隔 单位秒
+const defaultReload = 60
+
+//tlsConfig 配置文件中的tls字段
+type tlsConfig struct {
+	//是否开启RPC的TLS
+	Enable bool `json:"enable"`
+	//证书文件
+	Cert string `json:"cert"`
+	//私钥文件
+	Key string `json:"key"`
+	//CA证书文件 服务端配置时要求客户端证书(mTLS) 客户端为空时使用系统证书
+	CA string `json:"ca"`
+	//信任域 不为空时对端证书需要包含spiffe://信任域/ 开头的URI
+	TrustDomain string `json:"trust_domain"`
+	//证书文件检查间隔 单位秒
+	Reload int64 `json:"reload"`
+}
+
+//TLS RPC传输层TLS 证书文件变化时自动重新加载
+type TLS struct {
+	cfg     tlsConfig
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time
+	//证书检查是否运行
+	running bool
+	closed  bool
+	close   chan struct{}
+	lock    sync.RWMutex
+}
+
+//NewTLS 创建TLS 读取配置的tls字段 配置变化以及证书文件变化时重新加载
+//开启TLS时才定时检查证书文件
+func NewTLS(cfg plugins.Cfg) *TLS {
+	t := &TLS{
+		close: make(chan struct{}),
+	}
+	t.load(cfg)
+	cfg.Listen(func() {
+		t.load(cfg)
+	})
+	return t
+}
+
+//Close 停止检查证书文件
+func (t *TLS) Close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.closed {
+		t.closed = true
+		close(t.close)
+	}
+}
+
+//load 加载配置以及证书
+func (t *TLS) load(cfg plugins.Cfg) {
+	c := struct {
+		TLS tlsConfig `json:"tls"`
+	}{}
+	if err := cfg.Unmarshal(&c); err != nil {
+		log.Traceln("读取tls配置失败", err.Error())
+	}
+	if c.TLS.Reload <= 0 {
+		c.TLS.Reload = defaultReload
+	}
+	t.lock.Lock()
+	t.cfg = c.TLS
+	t.modTime = time.Time{}
+	if t.cfg.Enable && !t.running && !t.closed {
+		t.running = true
+		go t.eventloop()
+	}
+	t.lock.Unlock()
+	t.reload()
+}
+
+//eventloop 定时检查证书文件 关闭TLS或者Close后退出
+func (t *TLS) eventloop() {
+	for {
+		t.lock.Lock()
+		if !t.cfg.Enable {
+			t.running = false
+			t.lock.Unlock()
+			return
+		}
+		reload := t.cfg.Reload
+		t.lock.Unlock()
+		select {
+		case <-t.close:
+			return
+		case <-time.After(time.Duration(reload) * time.Second):
+		}
+		t.reload()
+	}
+}
+
+//reload 证书文件变化时重新加载 加载失败时继续使用旧的证书
+func (t *TLS) reload() {
+	t.lock.RLock()
+	cfg := t.cfg
+	last := t.modTime
+	t.lock.RUnlock()
+	if !cfg.Enable {
+		return
+	}
+	modTime := latest(cfg.Cert, cfg.Key, cfg.CA)
+	if !modTime.After(last) {
+		return
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+	if err != nil {
+		log.Errorln("加载tls证书失败", err.Error())
+		return
+	}
+	var pool *x509.CertPool
+	if cfg.CA != "" {
+		data, err := ioutil.ReadFile(cfg.CA)
+		if err != nil {
+			log.Errorln("加载tls CA证书失败", err.Error())
+			return
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			log.Errorln("加载tls CA证书失败", cfg.CA)
+			return
+		}
+	}
+	t.lock.Lock()
+	t.cert = &cert
+	t.pool = pool
+	t.modTime = modTime
+	t.lock.Unlock()
+	log.Traceln("tls证书加载完成", cfg.Cert)
+}
+
+//Enable 是否开启TLS
+func (t *TLS) Enable() bool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.cfg.Enable && t.cert != nil
+}
+
+//ServerConfig 服务端配置 每次握手使用最新的证书
+func (t *TLS) ServerConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			t.lock.RLock()
+			defer t.lock.RUnlock()
+			if t.cert == nil {
+				return nil, errors.New("没有tls证书")
+			}
+			c := &tls.Config{
+				Certificates:          []tls.Certificate{*t.cert},
+				MinVersion:            tls.VersionTLS12,
+				ClientAuth:            tls.NoClientCert,
+				VerifyPeerCertificate: t.verifyIdentity,
+			}
+			if t.pool != nil {
+				c.ClientAuth = tls.RequireAndVerifyClientCert
+				c.ClientCAs = t.pool
+			}
+			return c, nil
+		},
+	}
+}
+
+//ClientConfig 客户端配置 服务通过ip访问 只验证证书链以及信任域 不验证主机名
+func (t *TLS) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			t.lock.RLock()
+			defer t.lock.RUnlock()
+			if t.cert == nil {
+				return new(tls.Certificate), nil
+			}
+			return t.cert, nil
+		},
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			certs := make([]*x509.Certificate, 0, len(raw))
+			for _, data := range raw {
+				cert, err := x509.ParseCertificate(data)
+				if err != nil {
+					return err
+				}
+				certs = append(certs, cert)
+			}
+			if len(certs) <= 0 {
+				return errors.New("服务端没有证书")
+			}
+			t.lock.RLock()
+			pool := t.pool
+			t.lock.RUnlock()
+			opts := x509.VerifyOptions{
+				Roots:         pool,
+				Intermediates: x509.NewCertPool(),
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			}
+			for _, cert := range certs[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			if _, err := certs[0].Verify(opts); err != nil {
+				return err
+			}
+			return t.verifyIdentity(raw, nil)
+		},
+	}
+}
+
+//verifyIdentity 校验对端证书的信任域
+func (t *TLS) verifyIdentity(raw [][]byte, _ [][]*x509.Certificate) error {
+	t.lock.RLock()
+	domain := t.cfg.TrustDomain
+	t.lock.RUnlock()
+	if domain == "" || len(raw) <= 0 {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(raw[0])
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(Identity(cert), "spiffe://"+domain+"/") {
+		return errors.New("对端证书不属于信任域:" + domain)
+	}
+	return nil
+}
+
+//Peer 获取连接对端证书的身份 非tls连接或者对端没有证书时返回空
+func Peer(state tls.ConnectionState) string {
+	if len(state.PeerCertificates) <= 0 {
+		return ""
+	}
+	return Identity(state.PeerCertificates[0])
+}
+
+//Identity 证书的身份 优先使用spiffe://开头的URI 否则使用CommonName
+func Identity(cert *x509.Certificate) string {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String()
+		}
+	}
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	return cert.Subject.CommonName
+}
+
+//ServiceName 身份中的服务名称 spiffe://信任域/路径 取路径最后一段
+func ServiceName(identity string) string {
+	if !strings.HasPrefix(identity, "spiffe://") {
+		return identity
+	}
+	return identity[strings.LastIndex(identity, "/")+1:]
+}
+
+//latest 文件最近的修改时间
+func latest(files ...string) time.Time {
+	var modTime time.Time
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime
+}
@@ -3,6 +3,7 @@ package register
 import (
 	"context"
 	"fmt"
+	"strconv"
 
 	"github.com/tang-go/go-dog/nacos"
 	"github.com/tang-go/go-dog/plugins"
@@ -43,6 +44,9 @@ func (s *Register) RegisterRPCService(ctx context.Context, info *serviceinfo.Ser
 			"Longitude": fmt.Sprintf("%d", info.Longitude),
 			"Latitude":  fmt.Sprintf("%d", info.Latitude),
 			"Explain":   info.Explain,
+			"Zone":      info.Zone,
+			"Version":   info.Version,
+			"Shadow":    strconv.FormatBool(info.Shadow),
 		},
 	}
 	nacos.GetRegister().Register(param)
@@ -69,6 +73,9 @@ func (s *Register) RegisterHTTPService(ctx context.Context, info *serviceinfo.Se
 			"Longitude": fmt.Sprintf("%d", info.Longitude),
 			"Latitude":  fmt.Sprintf("%d", info.Latitude),
 			"Explain":   info.Explain,
+			"Zone":      info.Zone,
+			"Version":   info.Version,
+			"Shadow":    strconv.FormatBool(info.Shadow),
 		},
 	}
 	nacos.GetRegister().Register(param)
@@ -0,0 +1,165 @@
+package route
+
+import (
+	"fmt"
+	"strings"
+)
+
+//node 路由节点
+type node struct {
+	children map[string]*node       //静态子节点
+	param    *node                  //参数子节点 :name
+	wildcard *node                  //通配子节点 *name
+	name     string                 //参数名称
+	values   map[string]interface{} //请求类型对应的值
+	paths    map[string]string      //请求类型对应的注册路径
+}
+
+func newNode(name string) *node {
+	return &node{
+		children: make(map[string]*node),
+		name:     name,
+		values:   make(map[string]interface{}),
+		paths:    make(map[string]string),
+	}
+}
+
+//empty 节点是否为空
+func (n *node) empty() bool {
+	return len(n.children) <= 0 && n.param == nil && n.wildcard == nil && len(n.values) <= 0
+}
+
+//Tree 路由树 支持:param参数以及*wildcard通配,匹配优先级为静态>参数>通配 非并发安全
+type Tree struct {
+	root *node
+}
+
+//NewTree 新建一个路由树
+func NewTree() *Tree {
+	return &Tree{
+		root: newNode(""),
+	}
+}
+
+//split 拆分路径
+func split(path string) []string {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+//Add 添加路由 路由冲突时返回错误
+func (t *Tree) Add(method, path string, value interface{}) error {
+	n := t.root
+	segments := split(path)
+	for i, segment := range segments {
+		switch segment[0] {
+		case ':':
+			name := segment[1:]
+			if name == "" {
+				return fmt.Errorf("路由%s参数名称不能为空", path)
+			}
+			if n.param == nil {
+				n.param = newNode(name)
+			} else if n.param.name != name {
+				return fmt.Errorf("路由%s的参数:%s与已注册的参数:%s冲突", path, name, n.param.name)
+			}
+			n = n.param
+		case '*':
+			name := segment[1:]
+			if name == "" {
+				return fmt.Errorf("路由%s通配名称不能为空", path)
+			}
+			if i != len(segments)-1 {
+				return fmt.Errorf("路由%s的通配*%s必须在最后", path, name)
+			}
+			if n.wildcard == nil {
+				n.wildcard = newNode(name)
+			} else if n.wildcard.name != name {
+				return fmt.Errorf("路由%s的通配*%s与已注册的通配*%s冲突", path, name, n.wildcard.name)
+			}
+			n = n.wildcard
+		default:
+			child, ok := n.children[segment]
+			if !ok {
+				child = newNode("")
+				n.children[segment] = child
+			}
+			n = child
+		}
+	}
+	if exist, ok := n.paths[method]; ok {
+		return fmt.Errorf("路由%s %s与已注册的路由%s冲突", method, path, exist)
+	}
+	n.values[method] = value
+	n.paths[method] = path
+	return nil
+}
+
+//Remove 删除路由
+func (t *Tree) Remove(method, path string) {
+	remove(t.root, method, split(path))
+}
+
+//remove 递归删除 并清理空节点
+func remove(n *node, method string, segments []string) bool {
+	if len(segments) <= 0 {
+		delete(n.values, method)
+		delete(n.paths, method)
+		return n.empty()
+	}
+	segment := segments[0]
+	switch segment[0] {
+	case ':':
+		if n.param != nil && remove(n.param, method, segments[1:]) {
+			n.param = nil
+		}
+	case '*':
+		if n.wildcard != nil && remove(n.wildcard, method, segments[1:]) {
+			n.wildcard = nil
+		}
+	default:
+		if child, ok := n.children[segment]; ok && remove(child, method, segments[1:]) {
+			delete(n.children, segment)
+		}
+	}
+	return n.empty()
+}
+
+//Find 查找路由 返回路由值以及路径参数
+func (t *Tree) Find(method, path string) (interface{}, map[string]string, bool) {
+	params := make(map[string]string)
+	value, ok := find(t.root, method, split(path), params)
+	return value, params, ok
+}
+
+//find 递归查找 静态节点不匹配时回溯到参数以及通配节点
+func find(n *node, method string, segments []string, params map[string]string) (interface{}, bool) {
+	if len(segments) <= 0 {
+		value, ok := n.values[method]
+		return value, ok
+	}
+	segment := segments[0]
+	if child, ok := n.children[segment]; ok {
+		if value, ok := find(child, method, segments[1:], params); ok {
+			return value, true
+		}
+	}
+	if n.param != nil {
+		if value, ok := find(n.param, method, segments[1:], params); ok {
+			params[n.param.name] = segment
+			return value, true
+		}
+	}
+	if n.wildcard != nil {
+		if value, ok := n.wildcard.values[method]; ok {
+			params[n.wildcard.name] = strings.Join(segments, "/")
+			return value, true
+		}
+	}
+	return nil, false
+}
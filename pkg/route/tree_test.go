@@ -0,0 +1,126 @@
+package route
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTreeAddConflict(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes [][2]string
+		add    [2]string
+		ok     bool
+	}{
+		{"same path", [][2]string{{"GET", "/api/user"}}, [2]string{"GET", "/api/user"}, false},
+		{"same path other method", [][2]string{{"GET", "/api/user"}}, [2]string{"POST", "/api/user"}, true},
+		{"same param", [][2]string{{"GET", "/api/user/:id"}}, [2]string{"GET", "/api/user/:id"}, false},
+		{"param name", [][2]string{{"GET", "/api/user/:id"}}, [2]string{"DELETE", "/api/user/:uid"}, false},
+		{"param child", [][2]string{{"GET", "/api/user/:id"}}, [2]string{"GET", "/api/user/:id/name"}, true},
+		{"wildcard name", [][2]string{{"GET", "/static/*file"}}, [2]string{"POST", "/static/*path"}, false},
+		{"wildcard not last", nil, [2]string{"GET", "/static/*file/name"}, false},
+		{"empty param", nil, [2]string{"GET", "/api/user/:"}, false},
+		{"empty wildcard", nil, [2]string{"GET", "/static/*"}, false},
+		{"static and param", [][2]string{{"GET", "/api/user/:id"}}, [2]string{"GET", "/api/user/me"}, true},
+		{"trailing slash", [][2]string{{"GET", "/api/user"}}, [2]string{"GET", "/api/user/"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := NewTree()
+			for _, r := range test.routes {
+				if err := tree.Add(r[0], r[1], r[1]); err != nil {
+					t.Fatalf("add %s %s: %v", r[0], r[1], err)
+				}
+			}
+			err := tree.Add(test.add[0], test.add[1], test.add[1])
+			if (err == nil) != test.ok {
+				t.Fatalf("add %s %s: err=%v want ok=%t", test.add[0], test.add[1], err, test.ok)
+			}
+		})
+	}
+}
+
+func TestTreeFind(t *testing.T) {
+	tree := NewTree()
+	for _, r := range [][2]string{
+		{"GET", "/api/user/me"},
+		{"GET", "/api/user/:id"},
+		{"GET", "/api/user/:id/name"},
+		{"GET", "/api/user/*path"},
+		{"POST", "/api/user/:id"},
+		{"GET", "/api/file/*path"},
+		{"GET", "/api/file/list"},
+	} {
+		if err := tree.Add(r[0], r[1], r[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   string
+		params map[string]string
+	}{
+		{"static first", "GET", "/api/user/me", "/api/user/me", map[string]string{}},
+		{"param", "GET", "/api/user/10", "/api/user/:id", map[string]string{"id": "10"}},
+		{"param child", "GET", "/api/user/10/name", "/api/user/:id/name", map[string]string{"id": "10"}},
+		{"backtrack to wildcard", "GET", "/api/user/10/age", "/api/user/*path", map[string]string{"path": "10/age"}},
+		{"static prefix backtrack", "GET", "/api/user/me/name", "/api/user/:id/name", map[string]string{"id": "me"}},
+		{"method", "POST", "/api/user/10", "/api/user/:id", map[string]string{"id": "10"}},
+		{"wildcard", "GET", "/api/file/a/b.txt", "/api/file/*path", map[string]string{"path": "a/b.txt"}},
+		{"static over wildcard", "GET", "/api/file/list", "/api/file/list", map[string]string{}},
+		{"slashes", "GET", "//api//user/me/", "/api/user/me", map[string]string{}},
+		{"not found", "GET", "/api/order/1", "", nil},
+		{"method not found", "DELETE", "/api/user/10", "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, params, ok := tree.Find(test.method, test.path)
+			if test.want == "" {
+				if ok {
+					t.Fatalf("find %s %s = %v want not found", test.method, test.path, value)
+				}
+				return
+			}
+			if !ok || value != test.want {
+				t.Fatalf("find %s %s = %v, %t want %s", test.method, test.path, value, ok, test.want)
+			}
+			if !reflect.DeepEqual(params, test.params) {
+				t.Fatalf("find %s %s params = %v want %v", test.method, test.path, params, test.params)
+			}
+		})
+	}
+}
+
+func TestTreeRemove(t *testing.T) {
+	tree := NewTree()
+	for _, r := range [][2]string{
+		{"GET", "/api/user/:id"},
+		{"POST", "/api/user/:id"},
+		{"GET", "/api/user/:id/name"},
+	} {
+		if err := tree.Add(r[0], r[1], r[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tree.Remove("GET", "/api/user/:id")
+	if _, _, ok := tree.Find("GET", "/api/user/1"); ok {
+		t.Fatal("removed route found")
+	}
+	if _, _, ok := tree.Find("POST", "/api/user/1"); !ok {
+		t.Fatal("other method removed")
+	}
+	if _, _, ok := tree.Find("GET", "/api/user/1/name"); !ok {
+		t.Fatal("child route removed")
+	}
+	tree.Remove("POST", "/api/user/:id")
+	tree.Remove("GET", "/api/user/:id/name")
+	if !tree.root.empty() {
+		t.Fatal("empty nodes not cleaned")
+	}
+	//参数节点清理后可以注册不同名称的参数
+	if err := tree.Add("GET", "/api/user/:uid", nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"unicode/utf8"
 
 	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/pkg/schema"
 	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
 )
 
 //定义错误类型
@@ -38,7 +40,7 @@ func NewRouter() *Router {
 }
 
 //RegisterByMethod 注册方法
-func (pointer *Router) RegisterByMethod(name string, fn interface{}) (arg map[string]interface{}, reply map[string]interface{}) {
+func (pointer *Router) RegisterByMethod(name string, fn interface{}) (arg *serviceinfo.Schema, reply *serviceinfo.Schema) {
 	// if _, ok := pointer.methods[strings.ToLower(name)]; ok {
 	// 	panic("此函数名称已经存在")
 	// }
@@ -70,97 +72,7 @@ func (pointer *Router) RegisterByMethod(name string, fn interface{}) (arg map[st
 		panic("第二个返回值必须为error")
 	}
 	pointer.methods[strings.ToLower(name)] = &methodstruct{name: name, method: method, ctxType: ctxType, argType: argType}
-	return pointer.analysisStruct(nil, "", pointer.new(argType)), pointer.analysisStruct(nil, "", pointer.new(replyType))
-}
-
-//analysisStruct 解析参数
-func (pointer *Router) analysisStruct(index *int, name string, class interface{}) map[string]interface{} {
-	explain := make(map[string]interface{})
-	t := reflect.TypeOf(class)
-	if t.Kind() == reflect.Ptr {
-		t = t.Elem()
-	}
-	if t.Kind() != reflect.Struct {
-		tgs := map[string]string{
-			"type":        t.Kind().String(),
-			"description": t.Kind().String(),
-			"required":    "false",
-		}
-		explain[strings.ToLower(t.Name())] = tgs
-		return explain
-	}
-	fieldNum := t.NumField()
-	for i := 0; i < fieldNum; i++ {
-		required := "false"
-		if t.Field(i).Tag.Get("required") == "true" {
-			required = "true"
-		}
-		//检测每一个字段的深度
-		kind := t.Field(i).Type.Kind()
-		if kind == reflect.Struct {
-			class := pointer.new(t.Field(i).Type)
-			if index == nil {
-				i := 0
-				index = &i
-			}
-			tg := pointer.analysisStruct(index, "", class)
-			tgs := map[string]interface{}{
-				"type":        "object",
-				"description": t.Field(i).Tag.Get("description"),
-				"object":      tg,
-				"required":    required,
-			}
-			explain[t.Field(i).Tag.Get("json")] = tgs
-			continue
-		}
-		if kind == reflect.Slice {
-			class := pointer.new(t.Field(i).Type.Elem())
-			classType := reflect.TypeOf(class)
-			if classType.Kind() == reflect.Ptr {
-				classType = classType.Elem()
-			}
-			kind := classType.Kind()
-			if kind == reflect.Struct {
-				if index == nil {
-					i := 0
-					index = &i
-				}
-				tg := make(map[string]interface{})
-				if classType.Name() == name {
-					*index = *index + 1
-					if *index < 2 {
-						tg = pointer.analysisStruct(index, classType.Name(), class)
-					}
-				} else {
-					tg = pointer.analysisStruct(index, classType.Name(), class)
-				}
-				tgs := map[string]interface{}{
-					"type":        "array",
-					"description": t.Field(i).Tag.Get("description"),
-					"slice":       tg,
-					"required":    required,
-				}
-				explain[t.Field(i).Tag.Get("json")] = tgs
-
-			} else {
-				tgs := map[string]interface{}{
-					"type":        "array",
-					"description": t.Field(i).Tag.Get("description"),
-					"slice":       kind.String(),
-					"required":    required,
-				}
-				explain[t.Field(i).Tag.Get("json")] = tgs
-			}
-			continue
-		}
-		tgs := map[string]string{
-			"type":        t.Field(i).Tag.Get("type"),
-			"description": t.Field(i).Tag.Get("description"),
-			"required":    required,
-		}
-		explain[t.Field(i).Tag.Get("json")] = tgs
-	}
-	return explain
+	return schema.Generate(argType), schema.Generate(replyType)
 }
 
 //GetMethodArg 获取方法请求的参数
@@ -14,9 +14,13 @@ import (
 	"github.com/tang-go/go-dog/recover"
 )
 
+//streamSize 流式响应缓冲数量
+const streamSize = 64
+
 type callmsg struct {
 	response chan *header.Response
 	resquest *header.Request
+	closed   chan struct{}
 }
 
 //ClientRPC 客户端
@@ -117,6 +121,73 @@ func (c *ClientRPC) SendRequest(ctx plugins.Context, name, method string, code s
 	req.Method = method
 	req.Arg = arg
 	req.Code = code
+	return c.exchange(ctx, req)
+}
+
+//Chunk 发送上传文件的分片 id为上传请求的ID
+func (c *ClientRPC) Chunk(ctx plugins.Context, id, name, method string, part int, data []byte) error {
+	if atomic.LoadInt32(&c.isClose) > 0 {
+		return customerror.EnCodeError(customerror.ConnectClose, "链接已经关闭")
+	}
+	if ctx.GetTimeOut() < time.Now().UnixNano() {
+		return customerror.EnCodeError(customerror.RequestTimeout, "请求超时")
+	}
+	req := new(header.Request)
+	req.ID = id
+	req.Name = name
+	req.Method = method
+	req.TimeOut = ctx.GetTimeOut()
+	req.Chunk = true
+	req.Part = part
+	req.Arg = data
+	buff, err := c.codec.EnCode("msgpack", req)
+	if err != nil {
+		return customerror.EnCodeError(customerror.ParamError, err.Error())
+	}
+	if _, err := io.Write(c.conn, buff); err != nil {
+		c.Close()
+		return customerror.EnCodeError(customerror.ConnectClose, "链接已经关闭")
+	}
+	return nil
+}
+
+//SendUpload 发送包含分片上传文件的请求 id与分片的id相同
+func (c *ClientRPC) SendUpload(ctx plugins.Context, id, name, method string, code string, arg []byte) (reply []byte, e error) {
+	defer recover.Recover()
+	c.wait.Add(1)
+	defer c.wait.Done()
+	if atomic.LoadInt32(&c.isClose) > 0 {
+		return nil, customerror.EnCodeError(customerror.ConnectClose, "链接已经关闭")
+	}
+	if ctx.GetTimeOut() < time.Now().UnixNano() {
+		return nil, customerror.EnCodeError(customerror.RequestTimeout, "请求超时")
+	}
+	req := new(header.Request)
+	req.TTL = ctx.GetTTL()
+	req.TimeOut = ctx.GetTimeOut()
+	req.IsTest = ctx.GetIsTest()
+	req.TraceID = ctx.GetTraceID()
+	req.Address = ctx.GetAddress()
+	req.Data = ctx.GetData()
+	req.Token = ctx.GetToken()
+	req.Source = ctx.GetSource()
+	req.URL = ctx.GetURL()
+	req.ID = id
+	req.Name = name
+	req.Method = method
+	req.Arg = arg
+	req.Code = code
+	req.Upload = true
+	return c.exchange(ctx, req)
+}
+
+//CancelUpload 通知服务端丢弃id对应的上传文件
+func (c *ClientRPC) CancelUpload(id, name, method string) {
+	c.cancel(&header.Request{ID: id, Name: name, Method: method})
+}
+
+//exchange 发送请求并等待响应
+func (c *ClientRPC) exchange(ctx plugins.Context, req *header.Request) ([]byte, error) {
 	done := make(chan *header.Response, 1)
 	go c.call(ctx, req, done)
 	select {
@@ -136,6 +207,112 @@ func (c *ClientRPC) SendRequest(ctx plugins.Context, name, method string, code s
 	}
 }
 
+//Stream 发起流式请求 服务端返回End或者ctx结束时关闭返回的通道 ctx结束时通知服务端取消
+func (c *ClientRPC) Stream(ctx plugins.Context, name, method string, code string, arg []byte) (<-chan *plugins.StreamReply, error) {
+	if atomic.LoadInt32(&c.isClose) > 0 {
+		return nil, customerror.EnCodeError(customerror.ConnectClose, "链接已经关闭")
+	}
+	if ctx.GetTimeOut() < time.Now().UnixNano() {
+		return nil, customerror.EnCodeError(customerror.RequestTimeout, "请求超时")
+	}
+	req := new(header.Request)
+	req.TTL = ctx.GetTTL()
+	req.TimeOut = ctx.GetTimeOut()
+	req.IsTest = ctx.GetIsTest()
+	req.TraceID = ctx.GetTraceID()
+	req.Address = ctx.GetAddress()
+	req.Data = ctx.GetData()
+	req.Token = ctx.GetToken()
+	req.Source = ctx.GetSource()
+	req.URL = ctx.GetURL()
+	req.ID = uuid.GetToken()
+	req.Name = name
+	req.Method = method
+	req.Arg = arg
+	req.Code = code
+	req.Stream = true
+	buff, err := c.codec.EnCode("msgpack", req)
+	if err != nil {
+		return nil, customerror.EnCodeError(customerror.ParamError, err.Error())
+	}
+	msg := &callmsg{
+		resquest: req,
+		response: make(chan *header.Response, streamSize),
+		closed:   make(chan struct{}),
+	}
+	c.lock.Lock()
+	c.queue[req.ID] = msg
+	c.lock.Unlock()
+	if _, err := io.Write(c.conn, buff); err != nil {
+		c.lock.Lock()
+		delete(c.queue, req.ID)
+		c.lock.Unlock()
+		c.Close()
+		return nil, customerror.EnCodeError(customerror.ConnectClose, "链接已经关闭")
+	}
+	replies := make(chan *plugins.StreamReply, streamSize)
+	go func() {
+		defer recover.Recover()
+		defer close(replies)
+		defer func() {
+			c.lock.Lock()
+			delete(c.queue, req.ID)
+			c.lock.Unlock()
+			close(msg.closed)
+		}()
+		for {
+			select {
+			case rep := <-msg.response:
+				if rep.Error != nil {
+					select {
+					case replies <- &plugins.StreamReply{Error: rep.Error}:
+					case <-ctx.Done():
+						c.cancel(req)
+					}
+					return
+				}
+				if !rep.Stream || rep.End {
+					return
+				}
+				if len(rep.Reply) <= 0 {
+					//心跳
+					continue
+				}
+				select {
+				case replies <- &plugins.StreamReply{Reply: rep.Reply}:
+				case <-ctx.Done():
+					c.cancel(req)
+					return
+				}
+			case <-ctx.Done():
+				c.cancel(req)
+				return
+			}
+		}
+	}()
+	return replies, nil
+}
+
+//cancel 通知服务端取消流式请求或者丢弃上传文件
+func (c *ClientRPC) cancel(request *header.Request) {
+	if atomic.LoadInt32(&c.isClose) > 0 {
+		return
+	}
+	req := new(header.Request)
+	req.ID = request.ID
+	req.Name = request.Name
+	req.Method = request.Method
+	req.TimeOut = time.Now().Add(time.Second * 5).UnixNano()
+	req.Cancel = true
+	buff, err := c.codec.EnCode("msgpack", req)
+	if err != nil {
+		return
+	}
+	if _, err := io.Write(c.conn, buff); err != nil {
+		c.Close()
+	}
+}
+
 //Call 调用函数
 func (c *ClientRPC) call(ctx plugins.Context, req *header.Request, response chan *header.Response) {
 	defer recover.Recover()
@@ -164,10 +341,13 @@ func (c *ClientRPC) call(ctx plugins.Context, req *header.Request, response chan
 
 func (c *ClientRPC) done(response *header.Response) {
 	c.lock.RLock()
-	defer c.lock.RUnlock()
 	done, ok := c.queue[response.ID]
+	c.lock.RUnlock()
 	if ok {
-		done.response <- response
+		select {
+		case done.response <- response:
+		case <-done.closed:
+		}
 	}
 }
 
@@ -213,7 +393,10 @@ func (c *ClientRPC) eventloop() {
 			response.Name = vali.resquest.Name
 			response.Error = customerror.EnCodeError(customerror.InternalServerError, "服务链接已经关闭")
 			response.Method = vali.resquest.Method
-			vali.response <- response
+			select {
+			case vali.response <- response:
+			case <-vali.closed:
+			}
 		}
 		c.lock.RUnlock()
 		if c.closecallback != nil {
@@ -7,6 +7,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	customerror "github.com/tang-go/go-dog/error"
 	"github.com/tang-go/go-dog/header"
 	"github.com/tang-go/go-dog/lib/io"
 	"github.com/tang-go/go-dog/log"
@@ -20,7 +21,9 @@ type ServiceRPC struct {
 	codec      plugins.Codec
 	conn       net.Conn
 	isClose    int32
+	streams    int32
 	callNotice func(*header.Request) *header.Response
+	uploads    map[string]*Files
 	lock       sync.RWMutex
 }
 
@@ -30,6 +33,7 @@ func NewServiceRPC(conn net.Conn, codec plugins.Codec) *ServiceRPC {
 		conn:    conn,
 		isClose: 0,
 		codec:   codec,
+		uploads: make(map[string]*Files),
 	}
 	go s.eventloop()
 	return s
@@ -54,6 +58,12 @@ func (s *ServiceRPC) call(req *header.Request) {
 	if s.callNotice != nil {
 		metrics.MetricRequestCount(req.Name, req.Method)
 		rep := s.callNotice(req)
+		if rep == nil {
+			//流式请求以及取消请求由处理方通过Push返回
+			metrics.MetricResponseTime(req.Name, req.Method, time.Since(start).Seconds())
+			metrics.MetricWorkingCount(req.Name, req.Method, -1)
+			return
+		}
 		if rep.Error != nil {
 			metrics.MetricResponseCount(rep.Name, rep.Method, "false", strconv.Itoa(rep.Error.Code))
 		} else {
@@ -65,6 +75,65 @@ func (s *ServiceRPC) call(req *header.Request) {
 	metrics.MetricWorkingCount(req.Name, req.Method, -1)
 }
 
+//Hold 开始一个流式请求 存在流式请求时链接不做空闲超时关闭
+func (s *ServiceRPC) Hold() {
+	atomic.AddInt32(&s.streams, 1)
+}
+
+//Release 结束一个流式请求
+func (s *ServiceRPC) Release() {
+	atomic.AddInt32(&s.streams, -1)
+}
+
+//Push 主动发送响应 用于流式请求
+func (s *ServiceRPC) Push(response *header.Response) error {
+	if atomic.LoadInt32(&s.isClose) > 0 {
+		return customerror.EnCodeError(customerror.ConnectClose, "链接已经关闭")
+	}
+	s.send(response)
+	if atomic.LoadInt32(&s.isClose) > 0 {
+		return customerror.EnCodeError(customerror.ConnectClose, "链接已经关闭")
+	}
+	return nil
+}
+
+//Files 获取id对应的上传文件 调用方使用完后Close
+func (s *ServiceRPC) Files(id string) (*Files, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	files, ok := s.uploads[id]
+	delete(s.uploads, id)
+	return files, ok
+}
+
+//chunk 保存上传文件的分片 分片按顺序在eventloop中处理
+func (s *ServiceRPC) chunk(req *header.Request) {
+	ttl := time.Duration(req.TimeOut - time.Now().UnixNano())
+	s.lock.Lock()
+	files, ok := s.uploads[req.ID]
+	if !ok {
+		if ttl <= 0 {
+			s.lock.Unlock()
+			return
+		}
+		files = &Files{parts: make(map[int]*part)}
+		//请求超时没有收到请求时丢弃
+		files.timer = time.AfterFunc(ttl, func() {
+			s.drop(req.ID)
+		})
+		s.uploads[req.ID] = files
+	}
+	s.lock.Unlock()
+	files.write(req.Part, req.Arg)
+}
+
+//drop 丢弃id对应的上传文件
+func (s *ServiceRPC) drop(id string) {
+	if files, ok := s.Files(id); ok {
+		files.Close()
+	}
+}
+
 //Send 发送
 func (s *ServiceRPC) send(response *header.Response) {
 	if atomic.LoadInt32(&s.isClose) == 0 {
@@ -86,10 +155,20 @@ func (s *ServiceRPC) eventloop() {
 	defer recover.Recover()
 	defer func() {
 		s.conn.Close()
+		s.lock.Lock()
+		uploads := s.uploads
+		s.uploads = make(map[string]*Files)
+		s.lock.Unlock()
+		for _, files := range uploads {
+			files.Close()
+		}
 	}()
 	for {
 		_, buff, err := io.ReadByTime(s.conn, time.Now().Add(time.Minute*5))
 		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() && atomic.LoadInt32(&s.streams) > 0 {
+				continue
+			}
 			s.Close()
 			return
 		}
@@ -99,6 +178,14 @@ func (s *ServiceRPC) eventloop() {
 			log.Traceln(err.Error())
 			continue
 		}
+		if request.Chunk {
+			s.chunk(request)
+			metrics.MetricRequestBytes(request.Name, request.Method, float64(len(buff)))
+			continue
+		}
+		if request.Cancel {
+			s.drop(request.ID)
+		}
 		go s.call(request)
 		metrics.MetricRequestBytes(request.Name, request.Method, float64(len(buff)))
 	}
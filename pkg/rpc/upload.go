@@ -0,0 +1,125 @@
+package rpc
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tang-go/go-dog/log"
+)
+
+//uploadMemory 单个上传文件在内存中的最大长度 超过后写入临时文件
+const uploadMemory = 1 << 20
+
+//part 上传文件的内容
+type part struct {
+	buff bytes.Buffer
+	file *os.File
+}
+
+//write 写入分片 超过uploadMemory时转存到临时文件
+func (p *part) write(data []byte) error {
+	if p.file == nil && p.buff.Len()+len(data) > uploadMemory {
+		file, err := ioutil.TempFile("", "go-dog-upload-")
+		if err != nil {
+			return err
+		}
+		p.file = file
+		if _, err := file.Write(p.buff.Bytes()); err != nil {
+			return err
+		}
+		p.buff = bytes.Buffer{}
+	}
+	if p.file != nil {
+		_, err := p.file.Write(data)
+		return err
+	}
+	_, err := p.buff.Write(data)
+	return err
+}
+
+//reader 读取文件内容
+func (p *part) reader() (io.Reader, error) {
+	if p.file == nil {
+		return bytes.NewReader(p.buff.Bytes()), nil
+	}
+	if _, err := p.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return p.file, nil
+}
+
+//close 删除临时文件
+func (p *part) close() {
+	if p.file != nil {
+		p.file.Close()
+		os.Remove(p.file.Name())
+	}
+}
+
+//Files 服务端接收的分片上传文件 请求超时或者取消时丢弃
+type Files struct {
+	parts  map[int]*part
+	timer  *time.Timer
+	err    error
+	closed bool
+	lock   sync.Mutex
+}
+
+//Reader 获取序号对应的文件内容
+func (f *Files) Reader(index int) (io.Reader, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	p, ok := f.parts[index]
+	if !ok {
+		return nil, false
+	}
+	reader, err := p.reader()
+	if err != nil {
+		log.Traceln("读取上传文件失败", err.Error())
+		return nil, false
+	}
+	return reader, true
+}
+
+//Err 接收分片时的错误
+func (f *Files) Err() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.err
+}
+
+//Close 删除上传文件
+func (f *Files) Close() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return
+	}
+	f.closed = true
+	f.timer.Stop()
+	for _, p := range f.parts {
+		p.close()
+	}
+}
+
+//write 写入分片
+func (f *Files) write(index int, data []byte) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed || f.err != nil {
+		return
+	}
+	p, ok := f.parts[index]
+	if !ok {
+		p = new(part)
+		f.parts[index] = p
+	}
+	if err := p.write(data); err != nil {
+		log.Traceln("保存上传文件失败", err.Error())
+		f.err = err
+	}
+}
@@ -0,0 +1,128 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/header"
+	"github.com/tang-go/go-dog/metrics"
+	"github.com/tang-go/go-dog/pkg/codec"
+	"github.com/tang-go/go-dog/pkg/context"
+)
+
+func init() {
+	metrics.Init(&metrics.MetricOpts{NameSpace: "t"})
+}
+
+//newUploadPair 创建通过内存链接相连的客户端以及服务端 服务端返回接收到的文件内容
+func newUploadPair(t *testing.T) (*ClientRPC, *ServiceRPC) {
+	clientConn, serviceConn := net.Pipe()
+	client := NewClientRPC(clientConn, codec.NewCodec(), func(net.Conn) {})
+	service := NewServiceRPC(serviceConn, codec.NewCodec())
+	service.RegisterCallNotice(func(req *header.Request) *header.Response {
+		if req.Cancel {
+			return nil
+		}
+		rep := &header.Response{ID: req.ID, Name: req.Name, Method: req.Method, Code: req.Code}
+		if !req.Upload {
+			return rep
+		}
+		files, ok := service.Files(req.ID)
+		if !ok {
+			rep.Error = customerror.EnCodeError(customerror.ParamError, "上传文件不存在")
+			return rep
+		}
+		defer files.Close()
+		var parts []int
+		json.Unmarshal(req.Arg, &parts)
+		var result [][]byte
+		for _, part := range parts {
+			reader, ok := files.Reader(part)
+			if !ok {
+				rep.Error = customerror.EnCodeError(customerror.ParamError, "上传文件不存在")
+				return rep
+			}
+			data, _ := ioutil.ReadAll(reader)
+			result = append(result, data)
+		}
+		rep.Reply, _ = json.Marshal(result)
+		return rep
+	})
+	t.Cleanup(func() {
+		client.Close()
+		service.Close()
+	})
+	return client, service
+}
+
+func TestUpload(t *testing.T) {
+	large := bytes.Repeat([]byte("a"), uploadMemory+10)
+	tests := []struct {
+		name   string
+		chunks map[int][][]byte
+		parts  []int
+		cancel bool
+		want   [][]byte
+		ok     bool
+	}{
+		{"single", map[int][][]byte{0: {[]byte("hello "), []byte("world")}}, []int{0}, false, [][]byte{[]byte("hello world")}, true},
+		{"multiple", map[int][][]byte{0: {[]byte("a")}, 1: {[]byte("b")}}, []int{1, 0}, false, [][]byte{[]byte("b"), []byte("a")}, true},
+		{"empty", map[int][][]byte{0: {{}}}, []int{0}, false, [][]byte{{}}, true},
+		{"temp file", map[int][][]byte{0: {large[:uploadMemory], large[uploadMemory:]}}, []int{0}, false, [][]byte{large}, true},
+		{"missing part", map[int][][]byte{0: {[]byte("a")}}, []int{1}, false, nil, false},
+		{"canceled", map[int][][]byte{0: {[]byte("a")}}, []int{0}, true, nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, _ := newUploadPair(t)
+			ctx := context.WithTimeout(context.Background(), int64(time.Second*5))
+			for part := 0; part < len(test.chunks); part++ {
+				for _, chunk := range test.chunks[part] {
+					if err := client.Chunk(ctx, "id", "svc", "Upload", part, chunk); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if test.cancel {
+				client.CancelUpload("id", "svc", "Upload")
+			}
+			arg, _ := json.Marshal(test.parts)
+			reply, err := client.SendUpload(ctx, "id", "svc", "Upload", "json", arg)
+			if (err == nil) != test.ok {
+				t.Fatalf("SendUpload err=%v want ok=%t", err, test.ok)
+			}
+			if !test.ok {
+				return
+			}
+			var result [][]byte
+			if err := json.Unmarshal(reply, &result); err != nil {
+				t.Fatal(err)
+			}
+			if len(result) != len(test.want) {
+				t.Fatalf("files = %d want %d", len(result), len(test.want))
+			}
+			for i := range result {
+				if !bytes.Equal(result[i], test.want[i]) {
+					t.Fatalf("file %d = %d bytes want %d", i, len(result[i]), len(test.want[i]))
+				}
+			}
+		})
+	}
+}
+
+func TestUploadExpire(t *testing.T) {
+	client, service := newUploadPair(t)
+	ctx := context.WithTimeout(context.Background(), int64(time.Millisecond*50))
+	if err := client.Chunk(ctx, "id", "svc", "Upload", 0, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 200)
+	if _, ok := service.Files("id"); ok {
+		t.Fatal("expired upload not dropped")
+	}
+}
@@ -0,0 +1,307 @@
+package schema
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+const (
+	//Draft 生成的JSON Schema版本
+	Draft = "https://json-schema.org/draft/2020-12/schema"
+	//RefPrefix 结构定义引用前缀
+	RefPrefix = "#/$defs/"
+)
+
+//定义时间类型
+var typeOfTime = reflect.TypeOf(time.Time{})
+
+//定义上传文件类型
+var typeOfFormFile = reflect.TypeOf(plugins.FormFile{})
+
+//定义文件响应类型
+var typeOfFileReply = reflect.TypeOf(plugins.FileReply{})
+
+//Name 结构定义名称 包路径加类型名称保证不同服务的同名结构不冲突
+func Name(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.PkgPath() == "" {
+		return t.Name()
+	}
+	return strings.Replace(t.PkgPath(), "/", ".", -1) + "." + t.Name()
+}
+
+//Generate 生成类型的完整结构描述 引用的结构定义放在$defs中
+func Generate(t reflect.Type) *serviceinfo.Schema {
+	defs := make(map[string]*serviceinfo.Schema)
+	s := Reflect(t, defs)
+	s.Dialect = Draft
+	if len(defs) > 0 {
+		s.Defs = defs
+	}
+	return s
+}
+
+//Resolve 解析引用 返回root的$defs中的结构定义
+func Resolve(root, s *serviceinfo.Schema) *serviceinfo.Schema {
+	for s != nil && s.Ref != "" {
+		if root == nil {
+			return nil
+		}
+		def, ok := root.Defs[strings.TrimPrefix(s.Ref, RefPrefix)]
+		if !ok {
+			return nil
+		}
+		s = def
+	}
+	return s
+}
+
+//Rewrite 复制结构描述并将引用前缀替换为prefix,去掉$schema以及$defs 用于生成文档
+func Rewrite(s *serviceinfo.Schema, prefix string) *serviceinfo.Schema {
+	if s == nil {
+		return nil
+	}
+	n := *s
+	n.Dialect = ""
+	n.Defs = nil
+	if n.Ref != "" {
+		n.Ref = prefix + strings.TrimPrefix(n.Ref, RefPrefix)
+	}
+	if s.Properties != nil {
+		n.Properties = make(map[string]*serviceinfo.Schema, len(s.Properties))
+		for key, value := range s.Properties {
+			n.Properties[key] = Rewrite(value, prefix)
+		}
+	}
+	n.Items = Rewrite(s.Items, prefix)
+	n.AdditionalProperties = Rewrite(s.AdditionalProperties, prefix)
+	return &n
+}
+
+//IsFile 结构描述是否为文件
+func IsFile(root *serviceinfo.Schema) bool {
+	s := Resolve(root, root)
+	return s != nil && s.Type == "string" && s.Format == "binary"
+}
+
+//Reflect 通过反射生成结构描述 命名的结构体放入defs并返回引用
+func Reflect(t reflect.Type, defs map[string]*serviceinfo.Schema) *serviceinfo.Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == typeOfTime {
+		return &serviceinfo.Schema{Type: "string", Format: "date-time"}
+	}
+	if t == typeOfFormFile || t == typeOfFileReply {
+		return &serviceinfo.Schema{Type: "string", Format: "binary"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &serviceinfo.Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64:
+		return &serviceinfo.Schema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &serviceinfo.Schema{Type: "integer", Format: "int32"}
+	case reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &serviceinfo.Schema{Type: "integer", Format: "int64", Minimum: new(float64)}
+	case reflect.Uint8, reflect.Uint16:
+		return &serviceinfo.Schema{Type: "integer", Format: "int32", Minimum: new(float64)}
+	case reflect.Float32:
+		return &serviceinfo.Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &serviceinfo.Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &serviceinfo.Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &serviceinfo.Schema{Type: "string", Format: "byte"}
+		}
+		return &serviceinfo.Schema{Type: "array", Items: Reflect(t.Elem(), defs)}
+	case reflect.Map:
+		return &serviceinfo.Schema{Type: "object", AdditionalProperties: Reflect(t.Elem(), defs)}
+	case reflect.Chan:
+		//流式响应 使用通道中元素的结构描述
+		return Reflect(t.Elem(), defs)
+	case reflect.Struct:
+		if t.Name() == "" {
+			return object(t, defs)
+		}
+		name := Name(t)
+		if _, ok := defs[name]; !ok {
+			//先占位 防止递归结构死循环
+			defs[name] = new(serviceinfo.Schema)
+			defs[name] = object(t, defs)
+		}
+		return &serviceinfo.Schema{Ref: RefPrefix + name}
+	default:
+		return new(serviceinfo.Schema)
+	}
+}
+
+//object 解析结构体字段
+func object(t reflect.Type, defs map[string]*serviceinfo.Schema) *serviceinfo.Schema {
+	s := &serviceinfo.Schema{
+		Type:       "object",
+		Properties: make(map[string]*serviceinfo.Schema),
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := fieldName(field)
+		if !ok {
+			continue
+		}
+		//匿名结构体字段展开
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != typeOfTime {
+				embed := object(ft, defs)
+				for key, value := range embed.Properties {
+					s.Properties[key] = value
+				}
+				s.Required = append(s.Required, embed.Required...)
+				continue
+			}
+			name = ft.Name()
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property := Reflect(field.Type, defs)
+		if property.Ref != "" {
+			//引用不能附带其他描述
+			description, sensitive, number := field.Tag.Get("description"), field.Tag.Get("sensitive"), fieldNumber(field)
+			if description != "" || sensitive != "" || number > 0 {
+				s.Properties[name] = &serviceinfo.Schema{Ref: property.Ref, Description: description, Sensitive: sensitive, Field: number}
+			} else {
+				s.Properties[name] = property
+			}
+		} else {
+			tags(property, field)
+			s.Properties[name] = property
+		}
+		if field.Tag.Get("required") == "true" {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+//fieldName 获取字段json名称
+func fieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" && !field.Anonymous {
+		return "", false
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	if index := strings.Index(tag, ","); index >= 0 {
+		tag = tag[:index]
+	}
+	return tag, true
+}
+
+//fieldNumber 字段的protobuf编号 支持pb:"1"以及protoc生成的protobuf:"bytes,1,opt,name=..."
+func fieldNumber(field reflect.StructField) int32 {
+	tag := field.Tag.Get("pb")
+	if tag == "" {
+		if parts := strings.Split(field.Tag.Get("protobuf"), ","); len(parts) > 1 {
+			tag = parts[1]
+		}
+	}
+	number, err := strconv.ParseInt(tag, 10, 32)
+	if err != nil || number <= 0 {
+		return 0
+	}
+	return int32(number)
+}
+
+//tags 解析字段标签
+func tags(s *serviceinfo.Schema, field reflect.StructField) {
+	if description := field.Tag.Get("description"); description != "" {
+		s.Description = description
+	}
+	if format := field.Tag.Get("format"); format != "" {
+		s.Format = format
+	}
+	kind := field.Type.Kind()
+	if kind == reflect.Ptr {
+		kind = field.Type.Elem().Kind()
+	}
+	if enum := field.Tag.Get("enum"); enum != "" {
+		for _, value := range strings.Split(enum, ",") {
+			s.Enum = append(s.Enum, convert(kind, strings.TrimSpace(value)))
+		}
+	}
+	if example := field.Tag.Get("example"); example != "" {
+		s.Example = convert(kind, example)
+	}
+	if pattern := field.Tag.Get("pattern"); pattern != "" {
+		s.Pattern = pattern
+	}
+	if sensitive := field.Tag.Get("sensitive"); sensitive != "" {
+		s.Sensitive = sensitive
+	}
+	s.Field = fieldNumber(field)
+	//min max 数字限制大小 字符串限制长度 数组限制元素数量
+	for _, tag := range []string{"min", "max"} {
+		value, err := strconv.ParseFloat(field.Tag.Get(tag), 64)
+		if err != nil {
+			continue
+		}
+		length := int(value)
+		switch s.Type {
+		case "integer", "number":
+			if tag == "min" {
+				s.Minimum = &value
+			} else {
+				s.Maximum = &value
+			}
+		case "string":
+			if tag == "min" {
+				s.MinLength = &length
+			} else {
+				s.MaxLength = &length
+			}
+		case "array":
+			if tag == "min" {
+				s.MinItems = &length
+			} else {
+				s.MaxItems = &length
+			}
+		}
+	}
+}
+
+//convert 将标签中的字符串转换为字段类型的值
+func convert(kind reflect.Kind, value string) interface{} {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return v
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v, err := strconv.ParseUint(value, 10, 64); err == nil {
+			return v
+		}
+	case reflect.Float32, reflect.Float64:
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return v
+		}
+	case reflect.Bool:
+		if v, err := strconv.ParseBool(value); err == nil {
+			return v
+		}
+	}
+	return value
+}
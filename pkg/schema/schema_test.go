@@ -0,0 +1,94 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+//testBase 测试匿名嵌入的结构
+type testBase struct {
+	ID int64 `json:"id" required:"true"`
+}
+
+//testNode 测试递归结构
+type testNode struct {
+	Name     string      `json:"name" description:"名称"`
+	Children []*testNode `json:"children"`
+	Parent   *testNode   `json:"parent,omitempty"`
+}
+
+//testRequest 测试请求结构
+type testRequest struct {
+	testBase
+	Birthday time.Time         `json:"birthday"`
+	Age      *int32            `json:"age"`
+	Extra    map[string]*int64 `json:"extra"`
+	Tree     testNode          `json:"tree" description:"树"`
+	Ignore   string            `json:"-"`
+	private  string
+}
+
+func TestGenerate(t *testing.T) {
+	root := Generate(reflect.TypeOf(&testRequest{}))
+	if root.Dialect != Draft {
+		t.Fatalf("$schema %q", root.Dialect)
+	}
+	request := Resolve(root, root)
+	if request == nil || request.Type != "object" {
+		t.Fatalf("请求结构 %+v", request)
+	}
+	if len(request.Properties) != 5 {
+		t.Fatalf("字段数量 %d", len(request.Properties))
+	}
+	if id := request.Properties["id"]; id == nil || id.Type != "integer" || id.Format != "int64" {
+		t.Fatalf("嵌入字段 %+v", id)
+	}
+	if !reflect.DeepEqual(request.Required, []string{"id"}) {
+		t.Fatalf("必须字段 %v", request.Required)
+	}
+	if birthday := request.Properties["birthday"]; birthday.Type != "string" || birthday.Format != "date-time" {
+		t.Fatalf("时间字段 %+v", birthday)
+	}
+	if age := request.Properties["age"]; age.Type != "integer" || age.Format != "int32" {
+		t.Fatalf("指针字段 %+v", age)
+	}
+	extra := request.Properties["extra"]
+	if extra.Type != "object" || extra.AdditionalProperties == nil || extra.AdditionalProperties.Format != "int64" {
+		t.Fatalf("map字段 %+v", extra)
+	}
+	tree := request.Properties["tree"]
+	if tree.Ref != RefPrefix+Name(reflect.TypeOf(testNode{})) || tree.Description != "树" {
+		t.Fatalf("结构体字段 %+v", tree)
+	}
+	node := Resolve(root, tree)
+	if node == nil || node.Properties["name"].Description != "名称" {
+		t.Fatalf("结构定义 %+v", node)
+	}
+	children := node.Properties["children"]
+	if children.Type != "array" || children.Items == nil || children.Items.Ref != tree.Ref {
+		t.Fatalf("递归数组 %+v", children)
+	}
+	if parent := node.Properties["parent"]; parent.Ref != tree.Ref {
+		t.Fatalf("递归指针 %+v", parent)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	root := Generate(reflect.TypeOf(testNode{}))
+	doc := Rewrite(root, "#/definitions/")
+	if doc.Dialect != "" || doc.Defs != nil {
+		t.Fatalf("文档结构 %+v", doc)
+	}
+	want := "#/definitions/" + Name(reflect.TypeOf(testNode{}))
+	if doc.Ref != want {
+		t.Fatalf("引用 %q", doc.Ref)
+	}
+	node := Rewrite(root.Defs[Name(reflect.TypeOf(testNode{}))], "#/definitions/")
+	if node.Properties["children"].Items.Ref != want {
+		t.Fatalf("字段引用 %q", node.Properties["children"].Items.Ref)
+	}
+	if root.Defs[Name(reflect.TypeOf(testNode{}))].Properties["children"].Items.Ref != RefPrefix+Name(reflect.TypeOf(testNode{})) {
+		t.Fatal("Rewrite修改了原结构")
+	}
+}
@@ -0,0 +1,308 @@
+package schema
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+//正则缓存
+var patterns sync.Map
+
+//FieldError 字段校验错误
+type FieldError struct {
+	Path string //字段路径 例如:user.tags[0]
+	Msg  string //错误说明
+}
+
+//Error 错误内容
+func (e *FieldError) Error() string {
+	if e.Path == "" {
+		return e.Msg
+	}
+	return e.Path + ":" + e.Msg
+}
+
+//FieldErrors 字段校验错误列表
+type FieldErrors []*FieldError
+
+//Error 错误内容
+func (e FieldErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, ";")
+}
+
+//Validate 按结构描述校验json解码后的值 返回全部字段的错误
+func Validate(root *serviceinfo.Schema, value interface{}) FieldErrors {
+	var errs FieldErrors
+	validate(root, root, "", value, &errs)
+	return errs
+}
+
+//ValidateJSON 按结构描述校验json内容 数字按json.Number解析避免精度丢失
+func ValidateJSON(root *serviceinfo.Schema, data []byte) FieldErrors {
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return FieldErrors{{Msg: "请求内容不是合法的json:" + err.Error()}}
+	}
+	return Validate(root, value)
+}
+
+//validate 递归校验
+func validate(root, s *serviceinfo.Schema, path string, value interface{}, errs *FieldErrors) {
+	if s != nil && s.Ref != "" {
+		s = Resolve(root, s)
+	}
+	if s == nil || value == nil {
+		//null按零值处理
+		return
+	}
+	add := func(format string, a ...interface{}) {
+		*errs = append(*errs, &FieldError{Path: path, Msg: fmt.Sprintf(format, a...)})
+	}
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			add("需要参数是object")
+			return
+		}
+		for _, key := range s.Required {
+			if _, ok := object[key]; !ok {
+				*errs = append(*errs, &FieldError{Path: join(path, key), Msg: "必须传入"})
+			}
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			v := object[key]
+			if property, ok := s.Properties[key]; ok {
+				validate(root, property, join(path, key), v, errs)
+			} else if s.AdditionalProperties != nil {
+				validate(root, s.AdditionalProperties, join(path, key), v, errs)
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			add("需要参数是array")
+			return
+		}
+		if s.MinItems != nil && len(array) < *s.MinItems {
+			add("元素数量不能小于%d", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(array) > *s.MaxItems {
+			add("元素数量不能大于%d", *s.MaxItems)
+		}
+		for i, v := range array {
+			validate(root, s.Items, fmt.Sprintf("%s[%d]", path, i), v, errs)
+		}
+	case "string":
+		if s.Format == "binary" {
+			//上传的文件由网关组装
+			return
+		}
+		str, ok := value.(string)
+		if !ok {
+			add("需要参数是string")
+			return
+		}
+		switch s.Format {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				add("需要参数是RFC3339格式的时间")
+			}
+		case "byte":
+			if _, err := base64.StdEncoding.DecodeString(str); err != nil {
+				add("需要参数是base64编码")
+			}
+		}
+		length := utf8.RuneCountInString(str)
+		if s.MinLength != nil && length < *s.MinLength {
+			add("长度不能小于%d", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			add("长度不能大于%d", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			if re, err := pattern(s.Pattern); err == nil && !re.MatchString(str) {
+				add("格式不正确,需要匹配%s", s.Pattern)
+			}
+		}
+	case "integer", "number":
+		n, ok := number(value)
+		if !ok {
+			add("需要参数是%s", s.Type)
+			return
+		}
+		if s.Type == "integer" {
+			if n != math.Trunc(n) {
+				add("需要参数是integer")
+				return
+			}
+			if s.Format == "int32" && (n < math.MinInt32 || n > math.MaxInt32) {
+				add("超出int32范围")
+			}
+		}
+		if s.Minimum != nil && compare(value, n, *s.Minimum) < 0 {
+			add("不能小于%v", *s.Minimum)
+		}
+		if s.Maximum != nil && compare(value, n, *s.Maximum) > 0 {
+			add("不能大于%v", *s.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			add("需要参数是boolean")
+			return
+		}
+	}
+	if len(s.Enum) > 0 {
+		in := false
+		for _, e := range s.Enum {
+			if equal(e, value) {
+				in = true
+				break
+			}
+		}
+		if !in {
+			add("必须是%v中的一个", s.Enum)
+		}
+	}
+}
+
+//equal 比较json值 类型不同时不相等 数字按数值比较
+func equal(a, b interface{}) bool {
+	switch v := b.(type) {
+	case string:
+		s, ok := a.(string)
+		return ok && s == v
+	case bool:
+		t, ok := a.(bool)
+		return ok && t == v
+	}
+	if x, ok := integer(a); ok {
+		if y, ok := integer(b); ok {
+			return x == y
+		}
+	}
+	x, ok := number(a)
+	if !ok {
+		return false
+	}
+	y, ok := number(b)
+	return ok && x == y
+}
+
+//compare 比较数值与边界 整数按int64比较 避免超过2^53的数值转换为float64后丢失精度
+func compare(value interface{}, n, bound float64) int {
+	if i, ok := integer(value); ok && bound == math.Trunc(bound) && bound >= math.MinInt64 && bound < math.MaxInt64 {
+		b := int64(bound)
+		switch {
+		case i < b:
+			return -1
+		case i > b:
+			return 1
+		}
+		return 0
+	}
+	switch {
+	case n < bound:
+		return -1
+	case n > bound:
+		return 1
+	}
+	return 0
+}
+
+//join 拼接字段路径
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+//number 转换数字
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		n, err := strconv.ParseFloat(string(v), 64)
+		return n, err == nil
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+//integer 转换整数 只接受原值为整数的类型
+func integer(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		return n, err == nil
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
+//pattern 编译正则
+func pattern(expr string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(expr, re)
+	return re, nil
+}
@@ -0,0 +1,111 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+//testSchema 测试使用的结构描述
+const testSchema = `{
+	"$defs": {
+		"Tag": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string", "minLength": 1}}}
+	},
+	"type": "object",
+	"required": ["id", "name"],
+	"properties": {
+		"id": {"type": "integer", "format": "int64", "minimum": 1},
+		"big": {"type": "integer", "format": "int64", "minimum": -9007199254740992, "maximum": 9007199254740992},
+		"age": {"type": "integer", "format": "int32"},
+		"score": {"type": "number", "maximum": 100},
+		"name": {"type": "string", "minLength": 2, "maxLength": 4},
+		"phone": {"type": "string", "pattern": "^1[0-9]{10}$"},
+		"birthday": {"type": "string", "format": "date-time"},
+		"avatar": {"type": "string", "format": "byte"},
+		"file": {"type": "string", "format": "binary"},
+		"admin": {"type": "boolean"},
+		"level": {"type": "integer", "enum": [1, 2, 3]},
+		"kind": {"type": "string", "enum": ["1", "2"]},
+		"tags": {"type": "array", "minItems": 1, "maxItems": 2, "items": {"$ref": "#/$defs/Tag"}},
+		"extra": {"type": "object", "additionalProperties": {"type": "integer"}}
+	}
+}`
+
+func TestValidateJSON(t *testing.T) {
+	root := new(serviceinfo.Schema)
+	if err := json.Unmarshal([]byte(testSchema), root); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		data  string
+		paths []string
+	}{
+		{"valid", `{"id":1,"name":"张三","level":2,"kind":"1","tags":[{"name":"a"}],"extra":{"a":1}}`, nil},
+		{"not json", `{"id":`, []string{""}},
+		{"not object", `[1]`, []string{""}},
+		{"required", `{}`, []string{"id", "name"}},
+		{"null as zero value", `{"id":1,"name":"张三","age":null}`, nil},
+		{"integer type", `{"id":"1","name":"张三"}`, []string{"id"}},
+		{"integer fraction", `{"id":1.5,"name":"张三"}`, []string{"id"}},
+		{"int64 precision", `{"id":9007199254740993,"name":"张三"}`, nil},
+		{"int64 maximum equal", `{"id":1,"name":"张三","big":9007199254740992}`, nil},
+		{"int64 maximum exact", `{"id":1,"name":"张三","big":9007199254740993}`, []string{"big"}},
+		{"int64 minimum exact", `{"id":1,"name":"张三","big":-9007199254740993}`, []string{"big"}},
+		{"int32 range", `{"id":1,"name":"张三","age":2147483648}`, []string{"age"}},
+		{"minimum", `{"id":0,"name":"张三"}`, []string{"id"}},
+		{"maximum", `{"id":1,"name":"张三","score":100.5}`, []string{"score"}},
+		{"length counts runes", `{"id":1,"name":"张三李四王"}`, []string{"name"}},
+		{"min length", `{"id":1,"name":"a"}`, []string{"name"}},
+		{"pattern", `{"id":1,"name":"张三","phone":"12345"}`, []string{"phone"}},
+		{"date-time", `{"id":1,"name":"张三","birthday":"2020-01-01"}`, []string{"birthday"}},
+		{"byte", `{"id":1,"name":"张三","avatar":"not base64!"}`, []string{"avatar"}},
+		{"binary skipped", `{"id":1,"name":"张三","file":1}`, nil},
+		{"boolean", `{"id":1,"name":"张三","admin":"true"}`, []string{"admin"}},
+		{"enum number", `{"id":1,"name":"张三","level":4}`, []string{"level"}},
+		{"enum number as string", `{"id":1,"name":"张三","level":"1"}`, []string{"level"}},
+		{"enum string as number", `{"id":1,"name":"张三","kind":1}`, []string{"kind"}},
+		{"min items", `{"id":1,"name":"张三","tags":[]}`, []string{"tags"}},
+		{"max items", `{"id":1,"name":"张三","tags":[{"name":"a"},{"name":"b"},{"name":"c"}]}`, []string{"tags"}},
+		{"ref items", `{"id":1,"name":"张三","tags":[{"name":""},{}]}`, []string{"tags[0].name", "tags[1].name"}},
+		{"additional properties", `{"id":1,"name":"张三","extra":{"a":"x"}}`, []string{"extra.a"}},
+		{"unknown field ignored", `{"id":1,"name":"张三","other":"x"}`, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errs := ValidateJSON(root, []byte(test.data))
+			var paths []string
+			for _, err := range errs {
+				paths = append(paths, err.Path)
+			}
+			if !reflect.DeepEqual(paths, test.paths) {
+				t.Fatalf("ValidateJSON(%s) = %v want paths %v", test.data, errs, test.paths)
+			}
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b interface{}
+		want bool
+	}{
+		{float64(1), json.Number("1"), true},
+		{float64(1), json.Number("1.0"), true},
+		{float64(1), "1", false},
+		{"1", json.Number("1"), false},
+		{"a", "a", true},
+		{true, true, true},
+		{true, "true", false},
+		{int64(2), json.Number("2"), true},
+		{json.Number("9007199254740993"), json.Number("9007199254740992"), false},
+		{int64(9007199254740993), json.Number("9007199254740993"), true},
+	}
+	for _, test := range tests {
+		if got := equal(test.a, test.b); got != test.want {
+			t.Errorf("equal(%#v, %#v) = %t want %t", test.a, test.b, got, test.want)
+		}
+	}
+}
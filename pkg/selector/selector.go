@@ -13,8 +13,10 @@ import (
 
 //Selector 选择器
 type Selector struct {
-	rnd  *rand.Rand
-	lock sync.RWMutex
+	rnd       *rand.Rand
+	zone      string
+	threshold float64
+	lock      sync.RWMutex
 }
 
 //NewSelector 新建一个选择器
@@ -24,6 +26,44 @@ func NewSelector() *Selector {
 	return s
 }
 
+//SetZone 设置调用方所在可用区以及故障转移阈值
+func (s *Selector) SetZone(zone string, threshold float64) {
+	s.lock.Lock()
+	s.zone = zone
+	s.threshold = threshold
+	s.lock.Unlock()
+}
+
+//locality 按可用区筛选服务
+//本可用区健康实例占比不低于阈值时只返回本可用区实例,否则返回全部健康实例
+func (s *Selector) locality(services []*serviceinfo.ServiceInfo, fusing plugins.Fusing, method string) []*serviceinfo.ServiceInfo {
+	s.lock.RLock()
+	zone, threshold := s.zone, s.threshold
+	s.lock.RUnlock()
+	var healthy, local []*serviceinfo.ServiceInfo
+	total := 0
+	for _, service := range services {
+		isLocal := zone != "" && service.Zone == zone
+		if isLocal {
+			total++
+		}
+		if fusing.IsFusing(service.Key, method) {
+			continue
+		}
+		healthy = append(healthy, service)
+		if isLocal {
+			local = append(local, service)
+		}
+	}
+	if len(local) <= 0 {
+		return healthy
+	}
+	if float64(len(local))/float64(total) < threshold {
+		return healthy
+	}
+	return local
+}
+
 //GetByAddress 通过地址获取rpc服务信息
 func (s *Selector) GetByAddress(discovery plugins.Discovery, address string, fusing plugins.Fusing, name string, method string) (*serviceinfo.ServiceInfo, error) {
 	services := discovery.GetRPCServiceByName(name)
@@ -39,13 +79,7 @@ func (s *Selector) GetByAddress(discovery plugins.Discovery, address string, fus
 
 //RandomMode 随机模式(失败即返回)
 func (s *Selector) RandomMode(discovery plugins.Discovery, fusing plugins.Fusing, name string, method string) (*serviceinfo.ServiceInfo, error) {
-	var rpc []*serviceinfo.ServiceInfo
-	services := discovery.GetRPCServiceByName(name)
-	for _, service := range services {
-		if !fusing.IsFusing(service.Key, method) {
-			rpc = append(rpc, service)
-		}
-	}
+	rpc := s.locality(discovery.GetRPCServiceByName(name), fusing, method)
 	count := len(rpc)
 	if count <= 0 {
 		return nil, customerror.EnCodeError(customerror.InternalServerError, "没有可用服务")
@@ -57,13 +91,26 @@ func (s *Selector) RandomMode(discovery plugins.Discovery, fusing plugins.Fusing
 }
 
 //RangeMode 遍历模式(一个返回成功,或者全部返回失败))
+//本可用区的服务优先遍历
 func (s *Selector) RangeMode(discovery plugins.Discovery, fusing plugins.Fusing, name string, method string, f func(*serviceinfo.ServiceInfo) bool) error {
 	services := discovery.GetRPCServiceByName(name)
 	count := len(services)
 	if count <= 0 {
 		return customerror.EnCodeError(customerror.InternalServerError, "没有可用服务")
 	}
+	s.lock.RLock()
+	zone := s.zone
+	s.lock.RUnlock()
+	local := make([]*serviceinfo.ServiceInfo, 0, count)
+	other := make([]*serviceinfo.ServiceInfo, 0, count)
 	for _, service := range services {
+		if zone != "" && service.Zone == zone {
+			local = append(local, service)
+		} else {
+			other = append(other, service)
+		}
+	}
+	for _, service := range append(local, other...) {
 		if !fusing.IsFusing(service.Key, method) {
 			if f(service) == true {
 				break
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"strings"
+
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/pkg/auth"
+	"github.com/tang-go/go-dog/plugins"
+)
+
+//authenticate 通过身份验证插件验证token 身份信息写入ctx并校验方法的访问权限
+func (s *Service) authenticate(ctx plugins.Context, method, token string) error {
+	if token == "" {
+		return customerror.EnCodeError(customerror.Unauthorized, "token不能为空")
+	}
+	claims, err := s.authenticator.Verify(ctx, token)
+	if err != nil {
+		log.Traceln("身份验证失败", method, err.Error())
+		return customerror.EnCodeError(customerror.Unauthorized, "token不正确")
+	}
+	if err := ctx.SetData(plugins.ClaimsKey, claims); err != nil {
+		return customerror.EnCodeError(customerror.InternalServerError, err.Error())
+	}
+	return auth.Check(claims, s.access[strings.ToLower(method)])
+}
+
+//checkClaims 校验可信网关转发的身份信息的访问权限
+func (s *Service) checkClaims(ctx plugins.Context, method string) error {
+	claims, ok := auth.Claims(ctx)
+	if !ok {
+		return customerror.EnCodeError(customerror.Unauthorized, "身份信息不正确")
+	}
+	return auth.Check(claims, s.access[strings.ToLower(method)])
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"strings"
+	"sync"
+
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/header"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/metrics"
+	"github.com/tang-go/go-dog/pkg/mtls"
+	"github.com/tang-go/go-dog/plugins"
+)
+
+const (
+	//PolicyAllow 默认允许调用
+	PolicyAllow = "allow"
+	//PolicyDeny 默认拒绝调用
+	PolicyDeny = "deny"
+)
+
+//rule 方法的调用方规则 服务名称或者完整的证书身份 *表示全部调用方
+type rule struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+//policies 服务间调用授权 代码中声明的规则以及配置文件policy字段中的规则
+type policies struct {
+	//默认策略 allow deny
+	def string
+	//代码中声明的规则
+	code map[string]*rule
+	//配置的规则 key为方法名称 Class.*或者*
+	methods map[string]*rule
+	//可信的网关 服务名称或者完整的证书身份
+	gateways []string
+	lock     sync.RWMutex
+}
+
+func newPolicies() *policies {
+	return &policies{
+		def:     PolicyAllow,
+		code:    make(map[string]*rule),
+		methods: make(map[string]*rule),
+	}
+}
+
+//load 加载配置
+func (p *policies) load(cfg plugins.Cfg) {
+	c := struct {
+		Policy struct {
+			Default string           `json:"default"`
+			Methods map[string]*rule `json:"methods"`
+			//可信的网关 通过mTLS识别 转发的已验证身份信息直接使用
+			Gateways []string `json:"gateways"`
+		} `json:"policy"`
+	}{}
+	if err := cfg.Unmarshal(&c); err != nil {
+		log.Traceln("读取policy配置失败", err.Error())
+	}
+	methods := make(map[string]*rule)
+	for method, r := range c.Policy.Methods {
+		if r != nil {
+			methods[strings.ToLower(method)] = r
+		}
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.def = PolicyAllow
+	if c.Policy.Default == PolicyDeny {
+		p.def = PolicyDeny
+	}
+	p.methods = methods
+	p.gateways = c.Policy.Gateways
+}
+
+//gateway 调用方是否为可信的网关 没有证书身份时不可信
+func (p *policies) gateway(identity string) bool {
+	if identity == "" {
+		return false
+	}
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return matchAny(p.gateways, []string{identity, mtls.ServiceName(identity)})
+}
+
+//add 添加代码中声明的规则
+func (p *policies) add(method string, allow, deny []string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	method = strings.ToLower(method)
+	r, ok := p.code[method]
+	if !ok {
+		r = new(rule)
+		p.code[method] = r
+	}
+	r.Allow = append(r.Allow, allow...)
+	r.Deny = append(r.Deny, deny...)
+}
+
+//allow 调用方是否可以调用方法 拒绝规则优先 存在允许规则时只允许列出的调用方
+func (p *policies) allow(method string, identity string) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	method = strings.ToLower(method)
+	rules := []*rule{p.code[method], p.methods[method], p.methods["*"]}
+	if i := strings.LastIndex(method, "."); i > 0 {
+		rules = append(rules, p.methods[method[:i]+".*"])
+	}
+	names := []string{"*"}
+	if identity != "" {
+		names = append(names, identity, mtls.ServiceName(identity))
+	}
+	restricted := false
+	allowed := false
+	for _, r := range rules {
+		if r == nil {
+			continue
+		}
+		if matchAny(r.Deny, names) {
+			return false
+		}
+		if len(r.Allow) > 0 {
+			restricted = true
+			allowed = allowed || matchAny(r.Allow, names)
+		}
+	}
+	if restricted {
+		return allowed
+	}
+	return p.def == PolicyAllow
+}
+
+//matchAny list中是否包含names中的任意一个
+func matchAny(list []string, names []string) bool {
+	for _, item := range list {
+		for _, name := range names {
+			if item == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//authorize 校验调用方是否可以调用方法 调用方身份来自mTLS证书 拒绝时记录审计日志以及指标
+func (s *Service) authorize(ctx plugins.Context, req *header.Request) error {
+	if s.policies.allow(req.Method, ctx.GetPeer()) {
+		return nil
+	}
+	caller := ctx.GetPeer()
+	if caller == "" {
+		caller = "anonymous"
+	}
+	log.Warnf("服务调用被拒绝 | %s | %s | %s | %s | %s ", caller, req.Address, req.Source, req.Method, req.TraceID)
+	metrics.MetricPolicyDenyCount(s.name, req.Method, mtls.ServiceName(caller))
+	return customerror.EnCodeError(customerror.Forbidden, "服务"+caller+"没有调用权限")
+}
@@ -1,11 +1,13 @@
 package service
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -24,7 +26,10 @@ import (
 	"github.com/tang-go/go-dog/pkg/codec"
 	"github.com/tang-go/go-dog/pkg/config"
 	"github.com/tang-go/go-dog/pkg/context"
+	"github.com/tang-go/go-dog/pkg/cors"
 	"github.com/tang-go/go-dog/pkg/limit"
+	"github.com/tang-go/go-dog/pkg/mask"
+	"github.com/tang-go/go-dog/pkg/mtls"
 	consulRegister "github.com/tang-go/go-dog/pkg/register/consul"
 	nacosRegister "github.com/tang-go/go-dog/pkg/register/nacos"
 	"github.com/tang-go/go-dog/pkg/router"
@@ -34,6 +39,9 @@ import (
 	"github.com/tang-go/go-dog/serviceinfo"
 )
 
+//handshakeTimeout tls握手超时时间
+const handshakeTimeout = time.Second * 3
+
 type MetricOpts struct {
 	NameSpace     string                 // 必填
 	SystemName    string                 // 必填
@@ -90,6 +98,63 @@ func (a *HTTP) Level(level int8) plugins.HTTP {
 	return a
 }
 
+//Roles 需要拥有其中一个角色 同时开启验证
+func (a *HTTP) Roles(roles ...string) plugins.HTTP {
+	if a.api.Access == nil {
+		a.api.Access = new(serviceinfo.Access)
+	}
+	a.api.Access.Roles = roles
+	a.api.IsAuth = true
+	return a
+}
+
+//Permissions 需要拥有全部权限 同时开启验证
+func (a *HTTP) Permissions(permissions ...string) plugins.HTTP {
+	if a.api.Access == nil {
+		a.api.Access = new(serviceinfo.Access)
+	}
+	a.api.Access.Permissions = permissions
+	a.api.IsAuth = true
+	return a
+}
+
+//restrict 记录最后注册的API的访问权限要求
+func (a *HTTP) restrict(method string) {
+	if a.api.Access == nil {
+		return
+	}
+	a.s.api.API[len(a.s.api.API)-1].Access = a.api.Access
+	a.s.access[strings.ToLower(method)] = a.api.Access
+}
+
+//Cache 网关缓存GET响应
+func (a *HTTP) Cache(ttl int64, vary ...string) plugins.HTTP {
+	if a.api.Cache == nil {
+		a.api.Cache = new(serviceinfo.Cache)
+	}
+	a.api.Cache.TTL = ttl
+	a.api.Cache.Vary = vary
+	return a
+}
+
+//Stale 缓存过期后返回旧数据的时间
+func (a *HTTP) Stale(stale int64) plugins.HTTP {
+	if a.api.Cache == nil {
+		a.api.Cache = new(serviceinfo.Cache)
+	}
+	a.api.Cache.Stale = stale
+	return a
+}
+
+//Tags 缓存标签
+func (a *HTTP) Tags(tags ...string) plugins.HTTP {
+	if a.api.Cache == nil {
+		a.api.Cache = new(serviceinfo.Cache)
+	}
+	a.api.Cache.Tags = tags
+	return a
+}
+
 //GET APi GET路由
 func (a *HTTP) GET(method string, path string, explain string, fn interface{}) {
 	a.api.Path = path
@@ -106,6 +171,10 @@ func (a *HTTP) GET(method string, path string, explain string, fn interface{}) {
 		method = a.class + "." + method
 	}
 	a.s.RegisterAPI(a.api.Gate, a.api.Group, method, a.api.Version, path, plugins.GET, a.api.Level, a.api.IsAuth, explain, fn)
+	a.restrict(method)
+	if a.api.Cache != nil && a.api.Cache.TTL > 0 {
+		a.s.api.API[len(a.s.api.API)-1].Cache = a.api.Cache
+	}
 }
 
 //DELETE APi DELETE路由
@@ -124,6 +193,7 @@ func (a *HTTP) DELETE(method string, path string, explain string, fn interface{}
 		method = a.class + "." + method
 	}
 	a.s.RegisterAPI(a.api.Gate, a.api.Group, method, a.api.Version, path, plugins.DELETE, a.api.Level, a.api.IsAuth, explain, fn)
+	a.restrict(method)
 }
 
 //POST POST路由
@@ -142,6 +212,7 @@ func (a *HTTP) POST(method string, path string, explain string, fn interface{})
 		method = a.class + "." + method
 	}
 	a.s.RegisterAPI(a.api.Gate, a.api.Group, method, a.api.Version, path, plugins.POST, a.api.Level, a.api.IsAuth, explain, fn)
+	a.restrict(method)
 }
 
 //PUT PUT路由
@@ -160,6 +231,64 @@ func (a *HTTP) PUT(method string, path string, explain string, fn interface{}) {
 		method = a.class + "." + method
 	}
 	a.s.RegisterAPI(a.api.Gate, a.api.Group, method, a.api.Version, path, plugins.PUT, a.api.Level, a.api.IsAuth, explain, fn)
+	a.restrict(method)
+}
+
+//PATCH PATCH路由
+func (a *HTTP) PATCH(method string, path string, explain string, fn interface{}) {
+	a.api.Path = path
+	if a.api.Group == "" {
+		a.api.Group = a.s.name
+	}
+	if a.api.Version == "" {
+		a.api.Version = "v1"
+	}
+	if a.api.Level <= 0 {
+		a.api.Level = 1
+	}
+	if a.class != "" {
+		method = a.class + "." + method
+	}
+	a.s.RegisterAPI(a.api.Gate, a.api.Group, method, a.api.Version, path, plugins.PATCH, a.api.Level, a.api.IsAuth, explain, fn)
+	a.restrict(method)
+}
+
+//HEAD HEAD路由 只返回响应头
+func (a *HTTP) HEAD(method string, path string, explain string, fn interface{}) {
+	a.api.Path = path
+	if a.api.Group == "" {
+		a.api.Group = a.s.name
+	}
+	if a.api.Version == "" {
+		a.api.Version = "v1"
+	}
+	if a.api.Level <= 0 {
+		a.api.Level = 1
+	}
+	if a.class != "" {
+		method = a.class + "." + method
+	}
+	a.s.RegisterAPI(a.api.Gate, a.api.Group, method, a.api.Version, path, plugins.HEAD, a.api.Level, a.api.IsAuth, explain, fn)
+	a.restrict(method)
+}
+
+//SSE SSE路由 处理函数返回(<-chan *plugins.Event, error)
+func (a *HTTP) SSE(method string, path string, explain string, fn interface{}) {
+	a.api.Path = path
+	if a.api.Group == "" {
+		a.api.Group = a.s.name
+	}
+	if a.api.Version == "" {
+		a.api.Version = "v1"
+	}
+	if a.api.Level <= 0 {
+		a.api.Level = 1
+	}
+	if a.class != "" {
+		method = a.class + "." + method
+	}
+	a.s.RegisterAPI(a.api.Gate, a.api.Group, method, a.api.Version, path, plugins.SSE, a.api.Level, a.api.IsAuth, explain, fn)
+	a.restrict(method)
 }
 
 //RPC RPC注册
@@ -167,6 +296,8 @@ type RPC struct {
 	method *serviceinfo.Method
 	s      *Service
 	class  string
+	allow  []string
+	deny   []string
 }
 
 func newRPC(s *Service, method *serviceinfo.Method) plugins.RPC {
@@ -194,6 +325,38 @@ func (a *RPC) NoAuth() plugins.RPC {
 	return a
 }
 
+//Roles 需要拥有其中一个角色 同时开启验证
+func (a *RPC) Roles(roles ...string) plugins.RPC {
+	if a.method.Access == nil {
+		a.method.Access = new(serviceinfo.Access)
+	}
+	a.method.Access.Roles = roles
+	a.method.IsAuth = true
+	return a
+}
+
+//Permissions 需要拥有全部权限 同时开启验证
+func (a *RPC) Permissions(permissions ...string) plugins.RPC {
+	if a.method.Access == nil {
+		a.method.Access = new(serviceinfo.Access)
+	}
+	a.method.Access.Permissions = permissions
+	a.method.IsAuth = true
+	return a
+}
+
+//Allow 只允许指定的服务调用 服务名称或者完整的证书身份
+func (a *RPC) Allow(services ...string) plugins.RPC {
+	a.allow = append(a.allow, services...)
+	return a
+}
+
+//Deny 拒绝指定的服务调用 服务名称或者完整的证书身份
+func (a *RPC) Deny(services ...string) plugins.RPC {
+	a.deny = append(a.deny, services...)
+	return a
+}
+
 //Level 等级
 func (a *RPC) Level(level int8) plugins.RPC {
 	a.method.Level = level
@@ -209,6 +372,13 @@ func (a *RPC) Method(method string, explain string, fn interface{}) {
 		method = a.class + "." + method
 	}
 	a.s.RegisterRPC(method, a.method.Level, a.method.IsAuth, explain, fn)
+	if len(a.allow) > 0 || len(a.deny) > 0 {
+		a.s.policies.add(method, a.allow, a.deny)
+	}
+	if a.method.Access != nil {
+		a.s.rpc.Methods[len(a.s.rpc.Methods)-1].Access = a.method.Access
+		a.s.access[strings.ToLower(method)] = a.method.Access
+	}
 }
 
 //Service 服务
@@ -217,6 +387,8 @@ type Service struct {
 	name string
 	//验证插件
 	auth func(ctx plugins.Context, method, token string) error
+	//身份验证插件
+	authenticator plugins.Authenticator
 	//配置插件
 	cfg plugins.Cfg
 	//注册中心插件
@@ -231,6 +403,8 @@ type Service struct {
 	discovery plugins.Discovery
 	//鉴权方法
 	authMethod map[string]string
+	//方法的访问权限要求
+	access map[string]*serviceinfo.Access
 	//api信息
 	api *serviceinfo.ServiceInfo
 	//rpc服务信息
@@ -247,6 +421,16 @@ type Service struct {
 	metricValue []*metrics.MetricValue
 	//等待
 	wait sync.WaitGroup
+	//进行中的流式请求
+	streams sync.Map
+	//RPC传输层tls
+	tls *mtls.TLS
+	//服务间调用授权
+	policies *policies
+	//跨域策略
+	cors *cors.CORS
+	//敏感字段脱敏
+	masker *mask.Masker
 }
 
 //CreateService 创建一个服务
@@ -255,6 +439,7 @@ func CreateService(name string, param ...interface{}) plugins.Service {
 		close:      0,
 		name:       name,
 		authMethod: make(map[string]string),
+		access:     make(map[string]*serviceinfo.Access),
 	}
 	for _, plugin := range param {
 		if cfg, ok := plugin.(plugins.Cfg); ok {
@@ -281,6 +466,9 @@ func CreateService(name string, param ...interface{}) plugins.Service {
 		if client, ok := plugin.(plugins.Client); ok {
 			service.client = client
 		}
+		if authenticator, ok := plugin.(plugins.Authenticator); ok {
+			service.authenticator = authenticator
+		}
 	}
 	if service.cfg == nil {
 		//默认配置
@@ -308,6 +496,10 @@ func CreateService(name string, param ...interface{}) plugins.Service {
 		//默认限流插件
 		service.limit = limit.NewLimit(service.cfg.GetMaxServiceLimitRequest())
 	}
+	//配置变化时更新限流
+	service.cfg.Listen(func() {
+		service.limit.SetLimit(service.cfg.GetMaxServiceLimitRequest())
+	})
 	if service.interceptor == nil {
 		//链路追踪插件
 		service.interceptor = jaeger.NewJaeger(name, service.cfg)
@@ -320,10 +512,25 @@ func CreateService(name string, param ...interface{}) plugins.Service {
 			service.client = client.NewClient(service.cfg)
 		}
 	}
+	//RPC传输层tls
+	service.tls = mtls.NewTLS(service.cfg)
+	//敏感字段脱敏
+	service.masker = mask.NewMasker(service.cfg)
+	//跨域策略
+	service.cors = cors.NewCORS(service.cfg, "POST", "GET", "OPTIONS")
+	//服务间调用授权
+	service.policies = newPolicies()
+	service.policies.load(service.cfg)
+	service.cfg.Listen(func() {
+		service.policies.load(service.cfg)
+	})
 	//注册rpc服务
 	service.rpc = &serviceinfo.ServiceInfo{
 		Name:    service.name,
 		Address: service.cfg.GetHost(),
+		Zone:    service.cfg.GetZone(),
+		Version: service.cfg.GetVersion(),
+		Shadow:  service.cfg.GetShadow(),
 		Port:    service.cfg.GetRPCPort(),
 		Explain: service.cfg.GetExplain(),
 		Time:    time.Now().Format("2006-01-02 15:04:05"),
@@ -332,6 +539,9 @@ func CreateService(name string, param ...interface{}) plugins.Service {
 	service.api = &serviceinfo.ServiceInfo{
 		Name:    service.name,
 		Address: service.cfg.GetHost(),
+		Zone:    service.cfg.GetZone(),
+		Version: service.cfg.GetVersion(),
+		Shadow:  service.cfg.GetShadow(),
 		Port:    service.cfg.GetHTTPPort(),
 		Explain: service.cfg.GetExplain(),
 		Time:    time.Now().Format("2006-01-02 15:04:05"),
@@ -349,6 +559,11 @@ func (s *Service) GetCfg() plugins.Cfg {
 	return s.cfg
 }
 
+//GetTLS 获取RPC传输层TLS
+func (s *Service) GetTLS() *mtls.TLS {
+	return s.tls
+}
+
 //GetLimit 获取限流插件
 func (s *Service) GetLimit() plugins.Limit {
 	return s.limit
@@ -476,7 +691,7 @@ func (s *Service) runHTTP() error {
 	//注册http接口服务
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
-	router.Use(s.cors())
+	router.Use(s.cors.Handler())
 	if s.cfg.GetRunmode() == "trace" {
 		pprof.Register(router)
 	}
@@ -528,24 +743,9 @@ func (s *Service) logger() gin.HandlerFunc {
 	}
 }
 
-//cors 处理跨域问题
-func (s *Service) cors() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		method := c.Request.Method
-
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Headers", "Content-Type,TraceID, IsTest, Token,TimeOut")
-		c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-		c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Content-Type")
-		c.Header("Access-Control-Allow-Credentials", "true")
-
-		//放行所有OPTIONS方法
-		if method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-		}
-		// 处理请求
-		c.Next()
-	}
+//RunRPC 只启动RPC服务 HTTP服务以及退出信号由调用方管理
+func (s *Service) RunRPC() error {
+	return s.runTCP()
 }
 
 //runTCP 启动TCP
@@ -555,6 +755,10 @@ func (s *Service) runTCP() error {
 		return err
 	}
 	defer l.Close()
+	if s.tls.Enable() {
+		l = tls.NewListener(l, s.tls.ServerConfig())
+		log.Traceln("RPC开启tls")
+	}
 	s.register.RegisterRPCService(context.Background(), s.rpc)
 	for {
 		if atomic.LoadInt32(&s.close) > 0 {
@@ -595,10 +799,27 @@ func (s *Service) log(address, name, method string, respone *header.Response) fu
 
 // ServeConn 拦截一个链接
 func (s *Service) serveConn(conn net.Conn) {
+	//tls连接先完成握手 获取对端证书身份
+	var peer string
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		tlsConn.SetDeadline(time.Now().Add(handshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			log.Traceln("tls握手失败", conn.RemoteAddr().String(), err.Error())
+			conn.Close()
+			return
+		}
+		tlsConn.SetDeadline(time.Time{})
+		peer = mtls.Peer(tlsConn.ConnectionState())
+	}
 	serviceRPC := rpc.NewServiceRPC(conn, s.codec)
 	serviceRPC.RegisterCallNotice(
 		func(req *header.Request) *header.Response {
 			defer recover.Recover()
+			//取消流式请求
+			if req.Cancel {
+				s.cancel(req.ID)
+				return nil
+			}
 			rep := new(header.Response)
 			rep.ID = req.ID
 			rep.Method = req.Method
@@ -632,6 +853,11 @@ func (s *Service) serveConn(conn net.Conn) {
 			for key, value := range req.Data {
 				datas[key] = value
 			}
+			//只使用可信网关转发的已验证身份信息 其他调用方传入的身份信息在身份验证通过后再写入
+			_, verified := datas[plugins.ClaimsKey]
+			if verified = verified && s.policies.gateway(peer); !verified {
+				delete(datas, plugins.ClaimsKey)
+			}
 			ctx := context.NewContextByData(datas)
 			ctx.SetAddress(req.Address)
 			ctx.SetTraceID(req.TraceID)
@@ -639,36 +865,77 @@ func (s *Service) serveConn(conn net.Conn) {
 			ctx.SetToken(req.Token)
 			ctx.SetSource(req.Source)
 			ctx.SetURL(req.URL)
+			ctx.SetPeer(peer)
 			ctx.SetClient(s.client)
 
 			ctx = context.WithTimeout(ctx, ttl)
-
+			//服务间调用授权
+			if err := s.authorize(ctx, req); err != nil {
+				rep.Error = customerror.DeCodeError(err)
+				return rep
+			}
+			//分片上传的文件 处理函数返回后删除
+			var files *rpc.Files
+			if req.Upload {
+				var ok bool
+				if files, ok = serviceRPC.Files(req.ID); !ok {
+					rep.Error = customerror.EnCodeError(customerror.ParamError, "上传文件不存在")
+					return rep
+				}
+				defer files.Close()
+				if err := files.Err(); err != nil {
+					rep.Error = customerror.EnCodeError(customerror.InternalServerError, "保存上传文件失败:"+err.Error())
+					return rep
+				}
+			}
 			if argv, ok := s.router.GetMethodArg(req.Method); ok {
 				err := s.codec.DeCode(req.Code, req.Arg, argv)
 				if err != nil {
 					rep.Error = customerror.EnCodeError(customerror.ParamError, "请求参数错误:"+err.Error())
 					return rep
 				}
+				if files != nil {
+					if err := attach(reflect.ValueOf(argv), files); err != nil {
+						rep.Error = customerror.DeCodeError(err)
+						return rep
+					}
+				}
 				//先判断此方法是否需要鉴权
-				if _, o := s.authMethod[strings.ToLower(req.Method)]; o {
+				if _, o := s.authMethod[strings.ToLower(req.Method)]; o && verified {
+					//可信网关已经验证身份 API key签名访问时没有token
+					if err := s.checkClaims(ctx, req.Method); err != nil {
+						rep.Error = customerror.DeCodeError(err)
+						return rep
+					}
+				} else if o {
 					if s.auth != nil {
 						if err := s.auth(ctx, req.Name, req.Token); err != nil {
 							rep.Error = customerror.DeCodeError(err)
 							return rep
 						}
 					}
+					if s.authenticator != nil {
+						if err := s.authenticate(ctx, req.Method, req.Token); err != nil {
+							rep.Error = customerror.DeCodeError(err)
+							return rep
+						}
+					}
 				}
 				if s.interceptor != nil {
-					s.interceptor.Request(ctx, req.Name, req.Method, argv)
+					//拦截器中的参数脱敏
+					s.interceptor.Request(ctx, req.Name, req.Method, s.masker.Value(argv))
 				}
 				back, err := s.router.Call(ctx, req.Method, argv)
 				if s.interceptor != nil {
-					s.interceptor.Respone(ctx, rep.Name, rep.Method, back, err)
+					s.interceptor.Respone(ctx, rep.Name, rep.Method, s.masker.Value(back), err)
 				}
 				if err != nil {
 					rep.Error = customerror.DeCodeError(err)
 					return rep
 				}
+				if req.Stream {
+					return s.stream(serviceRPC, ctx, req, back)
+				}
 				reply, err := s.codec.EnCode(req.Code, back)
 				if err != nil {
 					rep.Error = customerror.EnCodeError(customerror.ParamError, "返回参数"+err.Error())
@@ -685,9 +952,15 @@ func (s *Service) serveConn(conn net.Conn) {
 //Close 关闭服务
 func (s *Service) Close() {
 	atomic.AddInt32(&s.close, 1)
+	//结束全部流式请求
+	s.streams.Range(func(key, value interface{}) bool {
+		value.(plugins.Context).Cancel()
+		return true
+	})
 	s.wait.Wait()
 	s.register.Cancellation()
 	s.limit.Close()
 	s.client.Close()
 	s.interceptor.Close()
+	s.tls.Close()
 }
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"reflect"
+	"time"
+
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/header"
+	"github.com/tang-go/go-dog/log"
+	"github.com/tang-go/go-dog/pkg/rpc"
+	"github.com/tang-go/go-dog/plugins"
+	"github.com/tang-go/go-dog/recover"
+)
+
+//streamHeartbeat 流式响应心跳间隔 防止链接空闲超时
+const streamHeartbeat = time.Minute
+
+//stream 流式响应 将处理函数返回通道中的数据持续发送给客户端 通道关闭或者ctx结束时发送End
+func (s *Service) stream(serviceRPC *rpc.ServiceRPC, ctx plugins.Context, req *header.Request, back interface{}) *header.Response {
+	ch := reflect.ValueOf(back)
+	if ch.Kind() != reflect.Chan || ch.Type().ChanDir()&reflect.RecvDir == 0 {
+		ctx.Cancel()
+		return &header.Response{
+			ID:     req.ID,
+			Name:   req.Name,
+			Method: req.Method,
+			Code:   req.Code,
+			Error:  customerror.EnCodeError(customerror.InternalServerError, "流式方法必须返回通道"),
+		}
+	}
+	s.streams.Store(req.ID, ctx)
+	s.wait.Add(1)
+	serviceRPC.Hold()
+	go func() {
+		defer recover.Recover()
+		defer s.wait.Done()
+		defer serviceRPC.Release()
+		defer s.streams.Delete(req.ID)
+		defer ctx.Cancel()
+		ticker := time.NewTicker(streamHeartbeat)
+		defer ticker.Stop()
+		response := func() *header.Response {
+			return &header.Response{
+				ID:     req.ID,
+				Name:   req.Name,
+				Method: req.Method,
+				Code:   req.Code,
+				Stream: true,
+			}
+		}
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: ch},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ticker.C)},
+		}
+		log.Tracef("流式请求开始 | %s | %s | %s ", req.Address, req.Method, req.ID)
+		defer log.Tracef("流式请求结束 | %s | %s | %s ", req.Address, req.Method, req.ID)
+		for {
+			chosen, value, ok := reflect.Select(cases)
+			rep := response()
+			switch chosen {
+			case 0:
+				if !ok {
+					rep.End = true
+					serviceRPC.Push(rep)
+					return
+				}
+				reply, err := s.codec.EnCode(req.Code, value.Interface())
+				if err != nil {
+					rep.End = true
+					rep.Error = customerror.EnCodeError(customerror.ParamError, "返回参数"+err.Error())
+					serviceRPC.Push(rep)
+					return
+				}
+				rep.Reply = reply
+				if err := serviceRPC.Push(rep); err != nil {
+					return
+				}
+			case 1:
+				rep.End = true
+				serviceRPC.Push(rep)
+				return
+			case 2:
+				if err := serviceRPC.Push(rep); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+//cancel 取消流式请求
+func (s *Service) cancel(id string) {
+	if value, ok := s.streams.Load(id); ok {
+		value.(plugins.Context).Cancel()
+	}
+}
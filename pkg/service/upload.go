@@ -0,0 +1,50 @@
+package service
+
+import (
+	"reflect"
+
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/pkg/rpc"
+	"github.com/tang-go/go-dog/plugins"
+)
+
+//typeOfFormFile 上传文件类型
+var typeOfFormFile = reflect.TypeOf(plugins.FormFile{})
+
+//attach 将分片上传的文件设置到请求参数中的plugins.FormFile
+func attach(v reflect.Value, files *rpc.Files) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			return attach(v.Elem(), files)
+		}
+	case reflect.Struct:
+		if v.Type() == typeOfFormFile {
+			if !v.CanAddr() {
+				return nil
+			}
+			file := v.Addr().Interface().(*plugins.FormFile)
+			reader, ok := files.Reader(file.Part)
+			if !ok {
+				return customerror.EnCodeError(customerror.ParamError, "上传文件"+file.Filename+"不存在")
+			}
+			file.SetReader(reader)
+			return nil
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			if err := attach(v.Field(i), files); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := attach(v.Index(i), files); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package plugins
+
+const (
+	//APIKeyHeader API key请求头
+	APIKeyHeader = "X-Api-Key"
+	//TimestampHeader 签名时间戳请求头 unix秒
+	TimestampHeader = "X-Timestamp"
+	//NonceHeader 签名随机数请求头 时间窗口内不能重复
+	NonceHeader = "X-Nonce"
+	//SignatureHeader 签名请求头
+	//签名为hex(HMAC-SHA256(secret, 请求方法\n路径\n排序后的query\n时间戳\n随机数\nhex(sha256(请求内容))))
+	SignatureHeader = "X-Signature"
+)
+
+//APIKey 合作方的API key
+type APIKey struct {
+	Key         string   `json:"key"`         //API key
+	Secret      string   `json:"secret"`      //签名密钥
+	Name        string   `json:"name"`        //合作方名称 作为身份信息的sub
+	Quota       int      `json:"quota"`       //每个网关实例每秒最多请求数 小于等于0时不限制
+	Routes      []string `json:"routes"`      //允许访问的url前缀 为空时不限制
+	Roles       []string `json:"roles"`       //角色
+	Permissions []string `json:"permissions"` //权限
+	Disabled    bool     `json:"disabled"`    //是否停用
+}
+
+//KeyStore API key存储
+type KeyStore interface {
+	//GetAPIKey 获取API key 不存在时返回nil
+	GetAPIKey(key string) (*APIKey, error)
+}
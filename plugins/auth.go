@@ -0,0 +1,20 @@
+package plugins
+
+//ClaimsKey 身份验证通过后身份信息在Context data中的key
+const ClaimsKey = "Claims"
+
+//Claims 令牌中的身份信息
+type Claims struct {
+	Subject     string                 `json:"sub"`         //用户标识
+	Issuer      string                 `json:"iss"`         //签发者
+	ExpiresAt   int64                  `json:"exp"`         //过期时间 unix秒
+	Roles       []string               `json:"roles"`       //角色
+	Permissions []string               `json:"permissions"` //权限
+	Extra       map[string]interface{} `json:"extra"`       //全部原始字段
+}
+
+//Authenticator 身份验证插件
+type Authenticator interface {
+	//Verify 验证token并返回身份信息
+	Verify(ctx Context, token string) (*Claims, error)
+}
@@ -0,0 +1,13 @@
+package plugins
+
+//InvalidateRequest 按标签失效网关响应缓存
+//后端服务通过 client.Broadcast(ctx, 网关名称, "Cache", "Invalidate", req, reply) 失效全部网关实例的缓存
+//调用方需要在网关配置gateway_rpc.allow中 没有配置时需要开启mTLS并且证书身份为在该网关注册了API的服务
+type InvalidateRequest struct {
+	Tags []string `json:"tags"` //缓存标签
+}
+
+//InvalidateReply 缓存失效结果
+type InvalidateReply struct {
+	Count int `json:"count"` //当前网关实例失效的缓存数量
+}
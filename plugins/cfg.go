@@ -16,6 +16,21 @@ type Cfg interface {
 	//获取分组名称
 	GetGroupName() string
 
+	//GetZone 获取可用区
+	GetZone() string
+
+	//GetZoneFailoverThreshold 获取可用区故障转移阈值
+	GetZoneFailoverThreshold() float64
+
+	//GetVersion 获取服务版本标签
+	GetVersion() string
+
+	//GetRouteRule 获取路由规则配置
+	GetRouteRule() *config.RouteRuleCfg
+
+	//GetShadow 是否影子实例
+	GetShadow() bool
+
 	//GetRPCPort 获取RPC端口
 	GetRPCPort() int
 
@@ -67,6 +82,27 @@ type Cfg interface {
 	//GetMaxClientLimitRequest 获取客户端最大的限流数
 	GetMaxClientLimitRequest() int
 
+	//GetFusingTTL 获取熔断统计时间 单位秒
+	GetFusingTTL() int
+
+	//GetMaxUploadSize 获取网关请求内容大小限制 单位字节
+	GetMaxUploadSize() int64
+
+	//GetMaxFileSize 获取网关单个上传文件大小限制 单位字节
+	GetMaxFileSize() int64
+
+	//GetGatewayCache 获取网关响应缓存存储 mem redis
+	GetGatewayCache() string
+
+	//GetStatusMapping 获取网关错误码对应的http状态码
+	GetStatusMapping() map[int]int
+
+	//Unmarshal 将配置内容解析到自定义结构
+	Unmarshal(v interface{}) error
+
+	//Listen 监听配置变化
+	Listen(f func())
+
 	//GetDiscoveryModel 获取服务发现模型
 	GetDiscoveryModel() string
 }
@@ -38,6 +38,12 @@ type Client interface {
 	//SendRequest 发生请求
 	SendRequest(ctx Context, mode Mode, server string, class string, method string, code string, args []byte) (reply []byte, e error)
 
+	//Stream 发起流式请求 ctx结束时取消请求
+	Stream(ctx Context, mode Mode, server string, class string, method string, code string, args []byte) (<-chan *StreamReply, error)
+
+	//Upload 分片上传文件 文件分片与请求发送到同一个服务实例
+	Upload(ctx Context, mode Mode, server string, class string, method string) (Upload, error)
+
 	//CallByAddress 指定地址调用
 	CallByAddress(ctx Context, address string, server string, class string, method string, args interface{}, reply interface{}) error
 
@@ -51,6 +51,12 @@ type Context interface {
 	//GetTraceID 获取traceid
 	GetTraceID() string
 
+	//SetPeer 设置对端服务的证书身份
+	SetPeer(peer string)
+
+	//GetPeer 获取对端服务的证书身份 mTLS连接时为spiffe://信任域/服务名称或者证书CommonName
+	GetPeer() string
+
 	//SetToken 设置token
 	SetToken(token string)
 
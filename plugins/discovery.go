@@ -19,8 +19,8 @@ type Discovery interface {
 	//GetAPIServiceByName 通过名称获取API服务
 	GetAPIServiceByName(name string) (services []*serviceinfo.ServiceInfo)
 
-	//GetAPIByURL 通过RUL获取API服务
-	GetAPIByURL(url string) (*serviceinfo.ServcieAPI, bool)
+	//GetAPIByURL 通过请求类型以及路径匹配API服务 返回路径参数
+	GetAPIByURL(method, path string) (*serviceinfo.ServcieAPI, map[string]string, bool)
 
 	//RangeAPI 遍历api
 	RangeAPI(f func(url string, api *serviceinfo.ServcieAPI))
@@ -0,0 +1,18 @@
+package plugins
+
+//LastEventIDKey 网关将客户端的Last-Event-ID放入context data 服务通过ctx.GetDataByKey获取后从该事件之后继续推送
+const LastEventIDKey = "LastEventID"
+
+//Event SSE事件 SSE接口的处理函数返回(<-chan *Event, error) 关闭通道结束推送
+type Event struct {
+	ID    string      `json:"id"`    //事件ID 客户端重连时通过Last-Event-ID带回
+	Event string      `json:"event"` //事件名称 为空时为message
+	Data  interface{} `json:"data"`  //事件内容 json编码后发送
+	Retry int         `json:"retry"` //客户端重连间隔,单位毫秒
+}
+
+//StreamReply 流式响应 Error不为空时流结束
+type StreamReply struct {
+	Reply []byte
+	Error error
+}
@@ -0,0 +1,52 @@
+package plugins
+
+import (
+	"io"
+	"time"
+)
+
+//FormFile multipart/form-data上传的文件 网关将文件内容分片流式发送到服务
+//服务接收完全部分片后调用处理函数 通过Read读取文件内容
+type FormFile struct {
+	Filename    string `json:"filename"`    //文件名称
+	ContentType string `json:"contentType"` //文件类型
+	Size        int64  `json:"size"`        //文件大小
+	Part        int    `json:"part"`        //文件在上传请求中的序号
+	reader      io.Reader
+}
+
+//Read 读取文件内容
+func (f *FormFile) Read(p []byte) (int, error) {
+	if f.reader == nil {
+		return 0, io.EOF
+	}
+	return f.reader.Read(p)
+}
+
+//SetReader 设置文件内容 服务接收完上传文件后调用
+func (f *FormFile) SetReader(reader io.Reader) {
+	f.reader = reader
+}
+
+//Upload 分片上传文件 发送完全部分片后通过Send发送请求
+type Upload interface {
+	//Write 发送文件分片 part为文件序号
+	Write(part int, data []byte) error
+
+	//Send 发送请求 请求中的FormFile通过Part关联上传的文件
+	Send(code string, args []byte) ([]byte, error)
+
+	//Cancel 取消上传 服务丢弃已经接收的分片 Send之后调用不做处理
+	Cancel()
+}
+
+//FileReply 文件响应 网关不做包装直接将文件内容返回给http客户端
+type FileReply struct {
+	Filename     string    `json:"filename"`     //文件名称
+	ContentType  string    `json:"contentType"`  //文件类型 为空时按文件名称推断
+	Inline       bool      `json:"inline"`       //是否在浏览器中直接打开 默认作为附件下载
+	CacheControl string    `json:"cacheControl"` //缓存控制 例如:max-age=3600
+	ETag         string    `json:"etag"`         //内容标识 用于If-None-Match
+	LastModified time.Time `json:"lastModified"` //最后修改时间 用于If-Modified-Since
+	Data         []byte    `json:"data"`         //文件内容
+}
@@ -2,32 +2,70 @@ package plugins
 
 import (
 	"github.com/gin-gonic/gin"
+	customerror "github.com/tang-go/go-dog/error"
 	"github.com/tang-go/go-dog/metrics"
 )
 
+//Formatter 网关响应格式化
+type Formatter interface {
+	//Success 格式化成功响应 返回http状态码以及响应内容
+	Success(c *gin.Context, body interface{}) (int, interface{})
+
+	//Error 格式化错误响应 status为错误码映射后的http状态码
+	Error(c *gin.Context, status int, err *customerror.Error) (int, interface{})
+}
+
 //Gateway 网关
 type Gateway interface {
 	//SwaggerAuthCheck swagger权限检测
 	SwaggerAuthCheck(swaggerAuthCheck func(token string) error)
 
-	//GetRequestIntercept 拦截get请求
+	//GetRequestIntercept 拦截get/delete/head请求 已由中间件替代,请使用Use
 	GetRequestIntercept(f func(c Context, url string, request []byte) ([]byte, bool, error))
 
-	//GetResponseIntercept 拦截get请求响应
+	//GetResponseIntercept 拦截get/delete/head请求响应 已由中间件替代,请使用Use
 	GetResponseIntercept(f func(c Context, url string, request []byte, response []byte))
 
-	//PostRequestIntercept 拦截get请求
+	//PostRequestIntercept 拦截post/put/patch请求 已由中间件替代,请使用Use
 	PostRequestIntercept(f func(c Context, url string, request []byte) ([]byte, bool, error))
 
-	//PostResponseIntercept 拦截get请求响应
+	//PostResponseIntercept 拦截post/put/patch请求响应 已由中间件替代,请使用Use
 	PostResponseIntercept(f func(c Context, url string, request []byte, response []byte))
 
+	//Use 添加对全部路由生效的中间件
+	Use(handles ...Middleware)
+
+	//UsePrefix 添加对url前缀生效的中间件
+	UsePrefix(prefix string, handles ...Middleware)
+
+	//UseGroup 添加对api分组生效的中间件
+	UseGroup(group string, handles ...Middleware)
+
 	//OpenCustomGet 开启自定义get请求
 	OpenCustomGet(url string, f func(c *gin.Context))
 
 	//OpenCustomPost 开启自定义post请求
 	OpenCustomPost(url string, f func(c *gin.Context))
 
+	//Mirror 按比例将url的请求镜像到影子服务
+	Mirror(url string, service string, percent int)
+
+	//WebSocket 开启websocket 后端服务通过网关的WebSocket.Push RPC推送消息
+	//调用方需要在网关配置gateway_rpc.allow中 没有配置时需要开启mTLS并且证书身份为在该网关注册了API的服务
+	WebSocket(path string)
+
+	//GRPC 开启gRPC入口 port小于等于0时只开启gRPC-Web
+	GRPC(port int)
+
+	//Coalesce 开启GET请求合并
+	Coalesce(enable bool)
+
+	//Formatter 设置响应格式
+	Formatter(f Formatter)
+
+	//StatusMapping 设置错误码对应的http状态码
+	StatusMapping(code int, status int)
+
 	//GetClient 获取client
 	GetClient() Client
 
@@ -37,6 +75,15 @@ type Gateway interface {
 	//Auth 验证权限
 	Auth(f func(ctx Context, token, url string) error)
 
+	//Authenticator 设置身份验证插件 校验API声明的角色以及权限
+	Authenticator(authenticator Authenticator)
+
+	//KeyStore 设置API key存储 默认使用配置文件中的api_key
+	KeyStore(store KeyStore)
+
+	//SignRoutes 设置只允许API key签名访问的url前缀
+	SignRoutes(prefix ...string)
+
 	//Run 启动
 	Run(port int) error
 
@@ -0,0 +1,64 @@
+package plugins
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
+//Exchange 网关中间件处理的一次http请求
+type Exchange struct {
+	Gin      *gin.Context      //http请求 可通过Gin.Header设置响应头 websocket以及gRPC请求时为空
+	Ctx      Context           //请求上下文 已完成权限验证
+	URL      string            //请求路径
+	Service  string            //服务名称
+	API      *serviceinfo.API  //路由信息 包含IsAuth Level Group等
+	Params   map[string]string //路径参数
+	Request  []byte            //json请求参数 请求阶段可改写
+	Response []byte            //json服务响应 响应阶段可改写
+	Error    error             //请求错误 响应阶段可改写
+	replied  bool
+}
+
+//Reply 直接返回响应 不再请求服务
+func (e *Exchange) Reply(response []byte) {
+	e.Response = response
+	e.replied = true
+}
+
+//Replied 是否已经直接返回响应
+func (e *Exchange) Replied() bool {
+	return e.replied
+}
+
+//Middleware 网关中间件 请求阶段按注册顺序执行 响应阶段按相反顺序执行
+type Middleware interface {
+	//Request 请求阶段 返回错误或者调用Exchange.Reply时中断后续的中间件
+	Request(e *Exchange) error
+
+	//Response 响应阶段 只有执行过请求阶段的中间件才会执行
+	Response(e *Exchange)
+}
+
+//RequestFunc 只处理请求阶段的中间件
+type RequestFunc func(e *Exchange) error
+
+//Request 请求阶段
+func (f RequestFunc) Request(e *Exchange) error {
+	return f(e)
+}
+
+//Response 响应阶段
+func (f RequestFunc) Response(e *Exchange) {}
+
+//ResponseFunc 只处理响应阶段的中间件
+type ResponseFunc func(e *Exchange)
+
+//Request 请求阶段
+func (f ResponseFunc) Request(e *Exchange) error {
+	return nil
+}
+
+//Response 响应阶段
+func (f ResponseFunc) Response(e *Exchange) {
+	f(e)
+}
@@ -1,10 +1,14 @@
 package plugins
 
+import (
+	"github.com/tang-go/go-dog/serviceinfo"
+)
+
 //Router RPC路由
 type Router interface {
 
 	//RegisterByMethod 注册方法
-	RegisterByMethod(name string, fn interface{}) (arg map[string]interface{}, reply map[string]interface{})
+	RegisterByMethod(name string, fn interface{}) (arg *serviceinfo.Schema, reply *serviceinfo.Schema)
 
 	//GetMethodArg 获取方法请求的参数
 	GetMethodArg(method string) (interface{}, bool)
@@ -14,6 +14,12 @@ const (
 	PUT HTTPKind = "PUT"
 	//DELETE delete请求
 	DELETE HTTPKind = "DELETE"
+	//PATCH patch请求
+	PATCH HTTPKind = "PATCH"
+	//HEAD head请求
+	HEAD HTTPKind = "HEAD"
+	//SSE Server-Sent Events请求 客户端以GET方式访问
+	SSE HTTPKind = "SSE"
 )
 
 //HTTP HTTP接口
@@ -37,6 +43,21 @@ type HTTP interface {
 	//Class 对象
 	Class(class string) HTTP
 
+	//Roles 需要拥有其中一个角色 同时开启验证
+	Roles(roles ...string) HTTP
+
+	//Permissions 需要拥有全部权限 同时开启验证
+	Permissions(permissions ...string) HTTP
+
+	//Cache 网关缓存GET响应 ttl单位秒 vary为区分缓存的请求头
+	Cache(ttl int64, vary ...string) HTTP
+
+	//Stale 缓存过期后stale秒内返回旧数据并在后台刷新
+	Stale(stale int64) HTTP
+
+	//Tags 缓存标签 通过网关的Cache.Invalidate RPC按标签失效 支持{路径参数}
+	Tags(tags ...string) HTTP
+
 	//GET APi GET路由
 	GET(method string, path string, explain string, fn interface{})
 
@@ -48,6 +69,15 @@ type HTTP interface {
 
 	//DELETE DELETE路由
 	DELETE(method string, path string, explain string, fn interface{})
+
+	//PATCH PATCH路由
+	PATCH(method string, path string, explain string, fn interface{})
+
+	//HEAD HEAD路由 只返回响应头
+	HEAD(method string, path string, explain string, fn interface{})
+
+	//SSE SSE路由 处理函数返回(<-chan *Event, error)
+	SSE(method string, path string, explain string, fn interface{})
 }
 
 //RPC RPC接口
@@ -62,9 +92,21 @@ type RPC interface {
 	//Level 等级
 	Level(level int8) RPC
 
+	//Allow 只允许指定的服务调用 服务名称或者完整的证书身份
+	Allow(services ...string) RPC
+
+	//Deny 拒绝指定的服务调用 服务名称或者完整的证书身份
+	Deny(services ...string) RPC
+
 	//Class 对象
 	Class(class string) RPC
 
+	//Roles 需要拥有其中一个角色 同时开启验证
+	Roles(roles ...string) RPC
+
+	//Permissions 需要拥有全部权限 同时开启验证
+	Permissions(permissions ...string) RPC
+
 	//Method 方法
 	Method(method string, explain string, fn interface{})
 }
@@ -0,0 +1,15 @@
+package plugins
+
+//PushMessage 推送给websocket客户端的消息 User以及Conn都为空时推送给全部连接
+//后端服务通过 client.Broadcast(ctx, 网关名称, "WebSocket", "Push", msg, reply) 推送到全部网关实例
+type PushMessage struct {
+	User  string `json:"user"`  //用户标识 推送给该用户的全部连接
+	Conn  string `json:"conn"`  //连接ID 推送给指定连接
+	Event string `json:"event"` //事件名称
+	Data  []byte `json:"data"`  //消息内容 json编码
+}
+
+//PushReply 推送结果
+type PushReply struct {
+	Count int `json:"count"` //当前网关实例推送成功的连接数量
+}
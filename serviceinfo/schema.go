@@ -0,0 +1,26 @@
+package serviceinfo
+
+//Schema 参数结构描述 JSON Schema draft 2020-12
+type Schema struct {
+	Dialect              string             `json:"$schema,omitempty"`              //使用的JSON Schema版本
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`                //结构定义
+	Ref                  string             `json:"$ref,omitempty"`                 //引用的结构定义
+	Type                 string             `json:"type,omitempty"`                 //类型 object array string integer number boolean
+	Format               string             `json:"format,omitempty"`               //格式 例如:int64 date-time
+	Description          string             `json:"description,omitempty"`          //说明
+	Properties           map[string]*Schema `json:"properties,omitempty"`           //对象字段
+	Required             []string           `json:"required,omitempty"`             //必须的字段
+	Items                *Schema            `json:"items,omitempty"`                //数组元素
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"` //map的值
+	Enum                 []interface{}      `json:"enum,omitempty"`                 //枚举值
+	Minimum              *float64           `json:"minimum,omitempty"`              //最小值
+	Maximum              *float64           `json:"maximum,omitempty"`              //最大值
+	MinLength            *int               `json:"minLength,omitempty"`            //字符串最小长度
+	MaxLength            *int               `json:"maxLength,omitempty"`            //字符串最大长度
+	Pattern              string             `json:"pattern,omitempty"`              //字符串正则
+	MinItems             *int               `json:"minItems,omitempty"`             //数组最小长度
+	MaxItems             *int               `json:"maxItems,omitempty"`             //数组最大长度
+	Example              interface{}        `json:"example,omitempty"`              //示例
+	Sensitive            string             `json:"x-sensitive,omitempty"`          //敏感字段的脱敏规则 日志以及链路追踪中脱敏
+	Field                int32              `json:"x-field,omitempty"`              //protobuf字段编号 网关gRPC使用
+}
@@ -4,6 +4,9 @@ package serviceinfo
 type ServiceInfo struct {
 	Key       string    //唯一组件
 	Group     string    //组
+	Zone      string    //可用区
+	Version   string    //版本标签 例如:v1 canary
+	Shadow    bool      //是否影子实例 只接收测试流量
 	Name      string    //服务名称
 	Address   string    //服务地址
 	Port      int       //端口
@@ -17,27 +20,44 @@ type ServiceInfo struct {
 
 //Method 方法
 type Method struct {
-	Name     string                 //方法名称
-	Level    int8                   //方法等级
-	Request  map[string]interface{} //请求json格式展示
-	Response map[string]interface{} //响应格式
-	Explain  string                 //方法说明
-	IsAuth   bool                   //是否验证
+	Name     string  //方法名称
+	Level    int8    //方法等级
+	Request  *Schema //请求结构
+	Response *Schema //响应结构
+	Explain  string  //方法说明
+	IsAuth   bool    //是否验证
+	Access   *Access //访问权限要求 为空时只验证身份
 }
 
 //API 服务提供的API接口
 type API struct {
-	Gate     string                 //注册网关的名称
-	Name     string                 //方法名称
-	Group    string                 //api的分组
-	Level    int8                   //方法等级
-	Request  map[string]interface{} //请求json格式展示
-	Response map[string]interface{} //响应格式
-	Explain  string                 //方法说明
-	IsAuth   bool                   //是否验证
-	Version  string                 //版本 例如:v1 v2
-	Path     string                 //http请求路径
-	Kind     string                 //请求类型 POST GET DELETE PUT
+	Gate     string  //注册网关的名称
+	Name     string  //方法名称
+	Group    string  //api的分组
+	Level    int8    //方法等级
+	Request  *Schema //请求结构
+	Response *Schema //响应结构
+	Explain  string  //方法说明
+	IsAuth   bool    //是否验证
+	Version  string  //版本 例如:v1 v2
+	Path     string  //http请求路径
+	Kind     string  //请求类型 POST GET DELETE PUT
+	Cache    *Cache  //网关响应缓存 为空时不缓存
+	Access   *Access //访问权限要求 为空时只验证身份
+}
+
+//Access 访问权限要求
+type Access struct {
+	Roles       []string //需要拥有其中一个角色
+	Permissions []string //需要拥有全部权限
+}
+
+//Cache 网关响应缓存策略
+type Cache struct {
+	TTL   int64    //缓存时间,单位秒
+	Stale int64    //过期后仍可返回旧数据并在后台刷新的时间,单位秒
+	Vary  []string //除路径以及query参数外区分缓存的请求头 例如:token Accept-Language
+	Tags  []string //缓存标签 用于按标签失效 支持{路径参数}
 }
 
 //Flusing 熔断
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	customerror "github.com/tang-go/go-dog/error"
+	"github.com/tang-go/go-dog/pkg/config"
 	"github.com/tang-go/go-dog/plugins"
 	"xorm.io/core"
 	basexorm "xorm.io/xorm"
@@ -12,72 +14,59 @@ import (
 
 //Mysql mysql
 type Mysql struct {
-	read  *basexorm.Engine
-	write *basexorm.Engine
+	read        *basexorm.Engine
+	write       *basexorm.Engine
+	shadowRead  *basexorm.Engine
+	shadowWrite *basexorm.Engine
 }
 
 //NewMysql 初始化mysql
 func NewMysql(cfg plugins.Cfg) *Mysql {
 	mysql := new(Mysql)
-	readurl := fmt.Sprintf(`%s:%s@tcp(%s)/%s?charset=utf8&parseTime=True&loc=Local`,
-		cfg.GetReadMysql().DbUser,
-		cfg.GetReadMysql().DbPWd,
-		cfg.GetReadMysql().DbIP,
-		cfg.GetReadMysql().DbName)
-	read, err := basexorm.NewEngine("mysql", readurl)
-	if err != nil {
-		panic("connect to mysql error:" + err.Error())
-	}
-	//设置最大空闲连接数
-	if cfg.GetReadMysql().MaxIdleConns > 0 {
-		read.SetMaxIdleConns(cfg.GetReadMysql().MaxIdleConns)
-	}
-	//设置数据库最大打开连接数
-	if cfg.GetReadMysql().MaxOpenConns > 0 {
-		read.SetMaxOpenConns(cfg.GetReadMysql().MaxOpenConns)
+	//初始化读数据库
+	mysql.read = open(cfg.GetReadMysql(), cfg.GetReadMysql().DbName)
+	//初始化写数据库
+	mysql.write = open(cfg.GetWriteMysql(), cfg.GetWriteMysql().DbName)
+	//初始化影子数据库
+	if cfg.GetReadMysql().ShadowDbName != "" {
+		mysql.shadowRead = open(cfg.GetReadMysql(), cfg.GetReadMysql().ShadowDbName)
 	}
-	//设置链接可重用时间
-	if cfg.GetReadMysql().ConnMaxLifetime > 0 {
-		read.SetConnMaxLifetime(time.Duration(cfg.GetReadMysql().ConnMaxLifetime) * time.Second)
+	if cfg.GetWriteMysql().ShadowDbName != "" {
+		mysql.shadowWrite = open(cfg.GetWriteMysql(), cfg.GetWriteMysql().ShadowDbName)
 	}
-	//设置日志
-	read.SetLogger(new(Logger))
-	read.ShowSQL(cfg.GetReadMysql().OpenLog)
-	//设置规则
-	read.SetTableMapper(core.GonicMapper{})
-	read.SetColumnMapper(core.GonicMapper{})
-	mysql.read = read
-	//初始化写数据库
-	writeurl := fmt.Sprintf(`%s:%s@tcp(%s)/%s?charset=utf8&parseTime=True&loc=Local`,
-		cfg.GetWriteMysql().DbUser,
-		cfg.GetWriteMysql().DbPWd,
-		cfg.GetWriteMysql().DbIP,
-		cfg.GetWriteMysql().DbName)
-	write, err := basexorm.NewEngine("mysql", writeurl)
+	return mysql
+}
+
+//open 打开数据库链接
+func open(cfg *config.MysqlCfg, name string) *basexorm.Engine {
+	url := fmt.Sprintf(`%s:%s@tcp(%s)/%s?charset=utf8&parseTime=True&loc=Local`,
+		cfg.DbUser,
+		cfg.DbPWd,
+		cfg.DbIP,
+		name)
+	engine, err := basexorm.NewEngine("mysql", url)
 	if err != nil {
 		panic("connect to mysql error:" + err.Error())
 	}
 	//设置最大空闲连接数
-	if cfg.GetWriteMysql().MaxIdleConns > 0 {
-		write.SetMaxIdleConns(cfg.GetWriteMysql().MaxIdleConns)
+	if cfg.MaxIdleConns > 0 {
+		engine.SetMaxIdleConns(cfg.MaxIdleConns)
 	}
 	//设置数据库最大打开连接数
-	if cfg.GetWriteMysql().MaxOpenConns > 0 {
-		write.SetMaxOpenConns(cfg.GetWriteMysql().MaxOpenConns)
+	if cfg.MaxOpenConns > 0 {
+		engine.SetMaxOpenConns(cfg.MaxOpenConns)
 	}
 	//设置链接可重用时间
-	if cfg.GetWriteMysql().ConnMaxLifetime > 0 {
-		write.SetConnMaxLifetime(time.Duration(cfg.GetWriteMysql().ConnMaxLifetime) * time.Second)
+	if cfg.ConnMaxLifetime > 0 {
+		engine.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
 	}
 	//设置日志
-	write.SetLogger(new(Logger))
-	write.ShowSQL(cfg.GetWriteMysql().OpenLog)
+	engine.SetLogger(new(Logger))
+	engine.ShowSQL(cfg.OpenLog)
 	//设置规则
-	write.SetTableMapper(core.GonicMapper{})
-	write.SetColumnMapper(core.GonicMapper{})
-	//不为表增加s
-	mysql.write = write
-	return mysql
+	engine.SetTableMapper(core.GonicMapper{})
+	engine.SetColumnMapper(core.GonicMapper{})
+	return engine
 }
 
 //GetReadEngine 获取读Mysql
@@ -89,3 +78,25 @@ func (m *Mysql) GetReadEngine() *basexorm.Engine {
 func (m *Mysql) GetWriteEngine() *basexorm.Engine {
 	return m.write
 }
+
+//GetReadEngineByContext 通过请求获取读Mysql 测试请求只使用影子数据库 没有配置影子数据库时返回错误
+func (m *Mysql) GetReadEngineByContext(ctx plugins.Context) (*basexorm.Engine, error) {
+	if !ctx.GetIsTest() {
+		return m.read, nil
+	}
+	if m.shadowRead == nil {
+		return nil, customerror.EnCodeError(customerror.InternalServerError, "测试请求没有配置影子数据库")
+	}
+	return m.shadowRead, nil
+}
+
+//GetWriteEngineByContext 通过请求获取写Mysql 测试请求只使用影子数据库 没有配置影子数据库时返回错误
+func (m *Mysql) GetWriteEngineByContext(ctx plugins.Context) (*basexorm.Engine, error) {
+	if !ctx.GetIsTest() {
+		return m.write, nil
+	}
+	if m.shadowWrite == nil {
+		return nil, customerror.EnCodeError(customerror.InternalServerError, "测试请求没有配置影子数据库")
+	}
+	return m.shadowWrite, nil
+}